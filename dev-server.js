@@ -85,7 +85,7 @@ function startBackend() {
     log(`Starting backend server..., cwd: ${__dirname}`, colors.fgMagenta);
 
     // Use go run cmd/main.go to start the backend
-    backendProcess = spawn("go", ["run", ".", "serve"], {
+    backendProcess = spawn("go", ["run", ".", "serve", "--migrate"], {
         cwd: `${__dirname}/server`,
         stdio: ["pipe", "pipe", "pipe"],
         shell: true,
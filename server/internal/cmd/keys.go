@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"meeting/pkg/config"
+	"meeting/pkg/keyring"
+	"os"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+var Keys = &cli.Command{
+	Name:  "keys",
+	Usage: "manage signing keys",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "config",
+			Value: "./config.toml",
+			Usage: "config path",
+		},
+	},
+	Commands: []*cli.Command{
+		{
+			Name:  "rotate",
+			Usage: "generate a new active key and retire the previous one",
+			Flags: []cli.Flag{
+				&cli.DurationFlag{
+					Name:  "grace",
+					Value: 24 * time.Hour,
+					Usage: "how long the retired key is still accepted",
+				},
+			},
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				path, err := keyFile(cmd)
+				if err != nil {
+					return err
+				}
+
+				k, err := keyring.Load(path)
+				if errors.Is(err, os.ErrNotExist) {
+					k, err = &keyring.KeyRing{}, nil
+				}
+				if err != nil {
+					return err
+				}
+
+				key, err := k.Rotate(cmd.Duration("grace"))
+				if err != nil {
+					return err
+				}
+				if err = k.Save(path); err != nil {
+					return err
+				}
+
+				fmt.Printf("active key: %s\n", key.Id)
+				return printKeys(k)
+			},
+		},
+		{
+			Name:  "list",
+			Usage: "list signing keys",
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				path, err := keyFile(cmd)
+				if err != nil {
+					return err
+				}
+
+				k, err := keyring.Load(path)
+				if err != nil {
+					return err
+				}
+
+				return printKeys(k)
+			},
+		},
+	},
+}
+
+func keyFile(cmd *cli.Command) (string, error) {
+	config.InitializeConfig(cmd.String("config"))
+	path := config.GetConfig().Keys.File
+	if path == "" {
+		return "", errors.New("Keys.File is not configured")
+	}
+
+	return path, nil
+}
+
+func printKeys(k *keyring.KeyRing) error {
+	now := time.Now()
+	for _, key := range k.Keys {
+		status := "valid"
+		switch {
+		case key.Id == k.Active:
+			status = "active"
+		case key.ExpiresAt != nil && now.After(*key.ExpiresAt):
+			status = "expired"
+		case key.ExpiresAt != nil:
+			status = "retired, accepted until " + key.ExpiresAt.Format(time.RFC3339)
+		}
+		fmt.Printf("%s\t%s\t%s\n", key.Id, key.CreatedAt.Format(time.RFC3339), status)
+	}
+
+	return nil
+}
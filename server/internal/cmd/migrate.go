@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"meeting/internal/migration"
+	"meeting/pkg/config"
+	"meeting/pkg/database"
+
+	"github.com/urfave/cli/v3"
+)
+
+var Migrate = &cli.Command{
+	Name:  "migrate",
+	Usage: "manage database schema migrations",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "config",
+			Value: "./config.toml",
+			Usage: "config path",
+		},
+	},
+	Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+		config.InitializeConfig(cmd.String("config"))
+		database.InitializeDB()
+		return ctx, nil
+	},
+	Commands: []*cli.Command{
+		{
+			Name:  "up",
+			Usage: "apply all pending migrations",
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				applied, err := migration.Up(ctx)
+				for _, m := range applied {
+					fmt.Printf("applied %04d %s\n", m.Version, m.Name)
+				}
+				if err != nil {
+					return err
+				}
+				if len(applied) == 0 {
+					fmt.Println("schema is up to date")
+				}
+				return nil
+			},
+		},
+		{
+			Name:  "down",
+			Usage: "revert the latest applied migrations",
+			Flags: []cli.Flag{
+				&cli.IntFlag{
+					Name:  "steps",
+					Value: 1,
+					Usage: "number of migrations to revert",
+				},
+			},
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				reverted, err := migration.Down(ctx, cmd.Int("steps"))
+				for _, m := range reverted {
+					fmt.Printf("reverted %04d %s\n", m.Version, m.Name)
+				}
+				return err
+			},
+		},
+		{
+			Name:  "status",
+			Usage: "list migrations and whether they are applied",
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				statuses, err := migration.Statuses(ctx)
+				if err != nil {
+					return err
+				}
+				for _, s := range statuses {
+					state := "pending"
+					if s.AppliedAt != nil {
+						state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+					}
+					fmt.Printf("%04d  %-30s %s\n", s.Version, s.Name, state)
+				}
+				return nil
+			},
+		},
+	},
+}
+
+// checkSchema refuses to serve on a database whose schema is behind the migrations of this build
+func checkSchema(ctx context.Context, apply bool) error {
+	if apply {
+		applied, err := migration.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("applied %04d %s\n", m.Version, m.Name)
+		}
+		return err
+	}
+
+	pending, err := migration.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is %d migration(s) behind, run `met migrate up` or start with --migrate", len(pending))
+	}
+
+	return nil
+}
@@ -2,22 +2,32 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"meeting/internal/controller"
 	"meeting/internal/middleware"
-	"meeting/internal/model/entity"
+	"meeting/internal/service/upload"
+	"meeting/internal/service/webhook"
+	"meeting/internal/service/webrtc"
+	"meeting/pkg/broker"
 	"meeting/pkg/config"
 	"meeting/pkg/database"
+	"meeting/pkg/keyring"
+	"meeting/pkg/mailer"
+	"meeting/pkg/passport"
+	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
 	"syscall"
+	"time"
 
 	"github.com/gin-contrib/pprof"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/urfave/cli/v3"
 )
 
@@ -33,14 +43,31 @@ var Serve = &cli.Command{
 			Value: "./config.toml",
 			Usage: "config path",
 		},
+		&cli.BoolFlag{
+			Name:  "migrate",
+			Usage: "apply pending schema migrations before serving",
+		},
 	},
 	Action: func(ctx context.Context, cmd *cli.Command) error {
 		runtime.SetMutexProfileFraction(1) // (非必需)开启对锁调用的跟踪
 		runtime.SetBlockProfileRate(1)     // (非必需)开启对阻塞操作的跟踪
 		config.InitializeConfig(cmd.String("config"))
 		database.InitializeDB()
+		broker.InitializeBroker()
+		keyring.InitializeKeyRing()
+		mailer.InitializeMailer()
+		passport.InitializePassport()
+		webhook.InitializeWebhook()
+		upload.InitializeUpload()
 
-		database.DB(context.Background()).AutoMigrate(&entity.User{}, &entity.Room{}, &entity.RoomUser{})
+		if err := checkSchema(ctx, cmd.Bool("migrate")); err != nil {
+			return err
+		}
+		if n, err := webrtc.FailInterruptedRecordings(ctx); err != nil {
+			log.Printf("fail interrupted recordings error: %v", err)
+		} else if n > 0 {
+			log.Printf("marked %d interrupted recording(s) as failed", n)
+		}
 
 		r := gin.Default()
 		r.MaxMultipartMemory = 8 << 20 // 8MiB
@@ -50,7 +77,12 @@ var Serve = &cli.Command{
 		//r.StaticFS("/swagger", http.Dir("public/swagger"))
 		//r.StaticFile("/swagger.json", "./public/swagger.json")
 
-		store := cookie.NewStore([]byte("secret"))
+		// 会话 cookie 使用当前有效的全部密钥校验，轮换后需重启生效
+		var keyPairs [][]byte
+		for _, key := range keyring.Default().Valid() {
+			keyPairs = append(keyPairs, key.Derive("session"), nil)
+		}
+		store := cookie.NewStore(keyPairs...)
 		// store.Options(sessions.Options{
 		// 	SameSite: config.GetConfig().Session.SameSiteMode,
 		// 	Secure:   config.GetConfig().Session.Secure,
@@ -61,40 +93,140 @@ var Serve = &cli.Command{
 		r.GET("login", controller.AuthHandler.Login)
 		r.GET("login/callback", controller.AuthHandler.LoginCallback)
 		r.GET("logout", controller.AuthHandler.Logout)
+		r.GET("/api/auth/methods", controller.AuthHandler.Methods)
+		r.POST("/api/auth/register", controller.AuthHandler.Register)
+		r.POST("/api/auth/login", controller.AuthHandler.PasswordLogin)
+		r.POST("/api/auth/email/code", controller.AuthHandler.SendEmailCode)
+		r.POST("/api/auth/email/login", controller.AuthHandler.EmailLogin)
 		r.GET("/api/websocket", controller.HandleWebSocket)
 
 		p := r.Group("")
 		p.Use(middleware.Authentication())
-		{
-			p.GET("/api/info", controller.AuthHandler.Info)
-			p.GET("/api/user/center", controller.AuthHandler.UserCenter)
-			p.GET("/api/signature", controller.GenerateSignature)
-			p.GET("/api/room/:id", controller.GetRoomInfo)
-			p.GET("/api/rooms", controller.GetRoomList)            // 添加获取房间列表接口
-			p.POST("/api/room", controller.CreateRoom)             // 添加创建房间接口
-			p.DELETE("/api/room/:id", controller.DeleteRoom)       // 修改为使用 :id
-			p.GET("/api/monitoring", controller.GetMonitoringData) // 添加监控接口路由
-
-			// 房间管理接口 - 使用不同的路径避免冲突
-			p.POST("/api/rooms/:id/join", controller.JoinRoom)         // 加入房间
-			p.PUT("/api/rooms/:id/update", controller.UpdateRoom)      // 更新房间信息
-			p.POST("/api/rooms/:id/kick", controller.KickUser)         // 踢出用户
-			p.POST("/api/rooms/:id/block", controller.BlockUser)       // 拉黑用户
-			p.GET("/api/rooms/:id/members", controller.GetRoomMembers) // 获取房间成员
+		protectedRoutes(p)
+		srv := &http.Server{
+			Addr:    fmt.Sprintf(":%d", config.GetConfig().App.Port),
+			Handler: r.Handler(),
 		}
 		go func() {
-			log.Fatalln(r.Run(fmt.Sprintf(":%d", config.GetConfig().App.Port)))
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalln(err)
+			}
 		}()
+		// 指标不经过鉴权，使用独立的监听地址，避免暴露在公网
+		var metricsSrv *http.Server
+		if addr := config.GetConfig().Metrics.Addr; addr != "" {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", promhttp.Handler())
+			metricsSrv = &http.Server{Addr: addr, Handler: mux}
+			go func() {
+				if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					log.Fatalln(err)
+				}
+			}()
+		}
 		quit := make(chan os.Signal, 1)
 		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 		<-quit
 		log.Println("Shutdown Server ...")
 
-		return nil
+		// 再次收到信号时不再等待房间清空
+		drainCtx, stopDrain := context.WithCancel(context.Background())
+		defer stopDrain()
+		go func() {
+			<-quit
+			log.Println("Forced shutdown, disconnecting clients ...")
+			stopDrain()
+		}()
+		webrtc.WsServer.Shutdown(drainCtx, time.Duration(config.GetConfig().App.DrainSeconds)*time.Second)
+
 		//创建超时上下文，Shutdown可以让未处理的连接在这个时间内关闭
-		//ch, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		//defer cancel()
-		//
-		//return r.Server.Shutdown(ch)
+		ch, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ch); err != nil {
+			return err
+		}
+		if metricsSrv != nil {
+			_ = metricsSrv.Shutdown(ch)
+		}
+
+		webhook.Close()
+		upload.Close()
+		return broker.Default().Close()
 	},
 }
+
+// protectedRoutes registers the routes that need a login session or an API token, tokens
+// may only call the routes given a scope in middleware.RouteScope
+func protectedRoutes(p *gin.RouterGroup) {
+	p.GET("/api/info", controller.AuthHandler.Info)
+	p.GET("/api/user/center", controller.AuthHandler.UserCenter)
+	p.POST("/api/auth/email/verify", controller.AuthHandler.VerifyEmail)
+	p.GET("/api/signature", controller.GenerateSignature)
+	p.GET("/api/room/:id", controller.GetRoomInfo)
+	p.GET("/api/rooms", controller.GetRoomList)                                      // 添加获取房间列表接口
+	p.POST("/api/room", controller.CreateRoom)                                       // 添加创建房间接口
+	p.DELETE("/api/room/:id", controller.DeleteRoom)                                 // 修改为使用 :id
+	p.GET("/api/monitoring", middleware.Admin(), controller.GetMonitoringData)       // 添加监控接口路由
+	p.GET("/api/monitoring/events", middleware.Admin(), controller.MonitoringEvents) // 监控事件流
+
+	// 房间管理接口 - 使用不同的路径避免冲突
+	p.POST("/api/rooms/:id/join", controller.JoinRoom)                        // 加入房间
+	p.PUT("/api/rooms/:id/update", controller.UpdateRoom)                     // 更新房间信息
+	p.POST("/api/rooms/:id/kick", controller.KickUser)                        // 踢出用户
+	p.POST("/api/rooms/:id/block", controller.BlockUser)                      // 拉黑用户
+	p.GET("/api/rooms/:id/members", controller.GetRoomMembers)                // 获取房间成员
+	p.GET("/api/rooms/:id/messages", controller.GetRoomMessages)              // 获取聊天记录
+	p.PUT("/api/rooms/:id/schedule", controller.UpdateRoomSchedule)           // 设置会议时间
+	p.GET("/api/rooms/:id/invitees", controller.GetRoomInvitees)              // 获取受邀用户
+	p.PUT("/api/rooms/:id/invitees", controller.UpdateRoomInvitees)           // 设置受邀用户
+	p.GET("/api/rooms/:id/calendar.ics", controller.GetRoomCalendar)          // 导出日历
+	p.POST("/api/rooms/:id/lobby/admit", controller.AdmitClient)              // 等候室准入
+	p.PUT("/api/rooms/:id/members/:userId/role", controller.UpdateMemberRole) // 设置成员角色
+	p.GET("/api/rooms/:id/invite-code", controller.GetInviteCode)             // 获取邀请码
+	p.POST("/api/rooms/:id/invite-code", controller.ResetInviteCode)          // 重置邀请码
+	p.GET("/api/rooms/:id/invites", controller.GetInvites)                    // 获取邀请链接
+	p.POST("/api/rooms/:id/invites", controller.CreateInvite)                 // 创建邀请链接
+	p.DELETE("/api/rooms/:id/invites/:code", controller.RevokeInvite)         // 撤销邀请链接
+	p.POST("/api/invites/:code/redeem", controller.RedeemInvite)              // 兑换邀请链接
+
+	// 会议场次和参会记录
+	p.GET("/api/rooms/:id/sessions", controller.GetRoomSessions)
+	p.GET("/api/rooms/:id/sessions/:sessionId/attendance.csv", controller.ExportSessionAttendance) // 导出参会记录
+
+	// Webhook，房间 Webhook 由房主管理，全局 Webhook 由管理员管理
+	p.GET("/api/rooms/:id/webhooks", controller.GetWebhooks)
+	p.POST("/api/rooms/:id/webhooks", controller.CreateWebhook)
+	p.PUT("/api/rooms/:id/webhooks/:webhookId", controller.UpdateWebhook)
+	p.DELETE("/api/rooms/:id/webhooks/:webhookId", controller.DeleteWebhook)
+	p.GET("/api/rooms/:id/webhooks/:webhookId/deliveries", controller.GetWebhookDeliveries) // Webhook 投递记录
+	p.GET("/api/webhooks", middleware.Admin(), controller.GetWebhooks)
+	p.POST("/api/webhooks", middleware.Admin(), controller.CreateWebhook)
+	p.PUT("/api/webhooks/:webhookId", middleware.Admin(), controller.UpdateWebhook)
+	p.DELETE("/api/webhooks/:webhookId", middleware.Admin(), controller.DeleteWebhook)
+	p.GET("/api/webhooks/:webhookId/deliveries", middleware.Admin(), controller.GetWebhookDeliveries)
+
+	// 服务端录制，主持人可以下载，房主可以删除
+	p.GET("/api/rooms/:id/recordings", controller.GetRecordings)
+	p.GET("/api/rooms/:id/recordings/:recordingId/download", controller.DownloadRecording) // 打包下载全部文件
+	p.GET("/api/rooms/:id/recordings/:recordingId/files/:fileId", controller.DownloadRecordingFile)
+	p.DELETE("/api/rooms/:id/recordings/:recordingId", controller.DeleteRecording)
+
+	// 经服务端中转的聊天文件，使用 tus 协议断点续传，房间成员可以下载
+	p.GET("/api/rooms/:id/files", controller.GetRoomFiles)
+	p.POST("/api/rooms/:id/files", controller.CreateRoomFile)
+	p.HEAD("/api/rooms/:id/files/:fileId", controller.HeadRoomFile)
+	p.PATCH("/api/rooms/:id/files/:fileId", controller.PatchRoomFile)
+	p.GET("/api/rooms/:id/files/:fileId", controller.DownloadRoomFile)
+	p.DELETE("/api/rooms/:id/files/:fileId", controller.DeleteRoomFile)
+
+	// API 令牌和服务账号，只能通过登录会话管理
+	p.GET("/api/tokens", controller.GetTokens)                                                  // 获取个人令牌
+	p.POST("/api/tokens", controller.CreateToken)                                               // 创建个人令牌
+	p.DELETE("/api/tokens/:id", controller.RevokeToken)                                         // 撤销个人令牌
+	p.GET("/api/service-accounts", controller.GetServiceAccounts)                               // 获取服务账号
+	p.POST("/api/service-accounts", controller.CreateServiceAccount)                            // 创建服务账号
+	p.DELETE("/api/service-accounts/:id", controller.DeleteServiceAccount)                      // 删除服务账号
+	p.GET("/api/service-accounts/:id/tokens", controller.GetServiceAccountTokens)               // 获取服务账号令牌
+	p.POST("/api/service-accounts/:id/tokens", controller.CreateServiceAccountToken)            // 创建服务账号令牌
+	p.DELETE("/api/service-accounts/:id/tokens/:tokenId", controller.RevokeServiceAccountToken) // 撤销服务账号令牌
+}
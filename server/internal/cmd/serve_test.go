@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"meeting/internal/middleware"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestProtectedRoutesHaveScopes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	protectedRoutes(r.Group(""))
+
+	registered := make(map[string]bool)
+	for _, route := range r.Routes() {
+		key := route.Method + " " + route.Path
+		registered[key] = true
+		_, scoped := middleware.RouteScope(route.Method, route.Path)
+		sessionOnly := middleware.SessionOnly(route.Method, route.Path)
+		switch {
+		case !scoped && !sessionOnly:
+			t.Errorf("%s has no token scope and is not marked session only", key)
+		case scoped && sessionOnly:
+			t.Errorf("%s has a token scope and is marked session only", key)
+		}
+	}
+	// 路由改名后旧的条目不再匹配任何接口
+	for _, key := range middleware.Routes() {
+		if !registered[key] {
+			t.Errorf("%s is listed in the middleware but not registered", key)
+		}
+	}
+}
@@ -4,4 +4,13 @@ const (
 	RedirectURIKey = "redirect_uri"
 	UserIdKey      = "user_id"
 	UserKey        = "user"
+	// TokenKey 为通过 API 令牌访问时使用的令牌，会话访问时不存在
+	TokenKey = "api_token"
+
+	// 第三方登录过程中保存在会话中的 state、nonce 和服务 id
+	OAuthStateKey    = "oauth_state"
+	OAuthNonceKey    = "oauth_nonce"
+	OAuthProviderKey = "oauth_provider"
+	// 当前用户登录使用的第三方服务，退出时同时退出该服务
+	LoginProviderKey = "login_provider"
 )
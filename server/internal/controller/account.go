@@ -0,0 +1,403 @@
+package controller
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"meeting/internal/constants"
+	"meeting/internal/model/entity"
+	"meeting/internal/utility/auth"
+	"meeting/pkg/api"
+	"meeting/pkg/config"
+	"meeting/pkg/database"
+	"meeting/pkg/mailer"
+	"meeting/pkg/passport"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	AuthMethodPassport = "passport"
+	AuthMethodPassword = "password"
+	AuthMethodEmail    = "email"
+
+	// 验证码输错次数上限，超过后需要重新获取
+	loginCodeMaxAttempts = 5
+	// 同一邮箱两次发送验证码的最小间隔
+	loginCodeInterval = time.Minute
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+var errEmailTaken = errors.New("email is already taken")
+
+// dummyPasswordHash is compared when the account does not exist so both cases take the same time
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("met-dummy-password"), bcrypt.DefaultCost)
+	return hash
+})
+
+// AuthMethods represents the login methods enabled on the server
+type AuthMethods struct {
+	Passport     bool            `json:"passport"`
+	Providers    []*AuthProvider `json:"providers"`
+	Password     bool            `json:"password"`
+	Email        bool            `json:"email"`
+	Registration bool            `json:"registration"`
+}
+
+// AuthProvider represents an external login provider, login with /login?provider=Id
+type AuthProvider struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// RegisterRequest represents the request structure for creating a local account
+type RegisterRequest struct {
+	Username string `json:"username" binding:"required,min=3,max=64"`
+	Name     string `json:"name" binding:"max=100"`
+	Email    string `json:"email" binding:"omitempty,email,max=255"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
+
+// PasswordLoginRequest represents the request structure for logging in with a password, Username also accepts a verified email
+type PasswordLoginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// SendEmailCodeRequest represents the request structure for sending a login code
+type SendEmailCodeRequest struct {
+	Email string `json:"email" binding:"required,email,max=255"`
+}
+
+// EmailLoginRequest represents the request structure for logging in with a login code
+type EmailLoginRequest struct {
+	Email string `json:"email" binding:"required,email,max=255"`
+	Code  string `json:"code" binding:"required"`
+}
+
+// VerifyEmailRequest represents the request structure for confirming the email of the current user
+type VerifyEmailRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// requireAuthMethod responds with 404 when the login method is disabled
+func requireAuthMethod(ctx *gin.Context, method string) bool {
+	if !config.GetConfig().AuthEnabled(method) {
+		ctx.JSON(http.StatusNotFound, api.Fail(api.WithMessage("Login method is disabled")))
+		return false
+	}
+	return true
+}
+
+// signIn stores the user in the session
+func signIn(ctx *gin.Context, user *entity.User) error {
+	session := sessions.Default(ctx)
+	session.Set(constants.UserIdKey, user.Id)
+	return session.Save()
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// consumeLoginCode checks code against the latest login code of email and marks it used
+func consumeLoginCode(ctx *gin.Context, email, code string) bool {
+	var loginCode entity.LoginCode
+	if err := database.DB(ctx).Where("email = ?", email).Order("id DESC").First(&loginCode).Error; err != nil || !loginCode.IsUsable(time.Now(), loginCodeMaxAttempts) {
+		return false
+	}
+	if !loginCode.Check(strings.TrimSpace(code)) {
+		database.DB(ctx).Model(&loginCode).Update("attempts", gorm.Expr("attempts + 1"))
+		return false
+	}
+
+	// 条件更新保证验证码只能使用一次
+	res := database.DB(ctx).Model(&loginCode).Where("consumed_at IS NULL").Update("consumed_at", time.Now())
+	return res.Error == nil && res.RowsAffected > 0
+}
+
+// Methods returns the login methods enabled on the server
+func (a *authHandler) Methods(ctx *gin.Context) {
+	c := config.GetConfig()
+	providers := make([]*AuthProvider, 0)
+	if c.AuthEnabled(AuthMethodPassport) {
+		for _, p := range passport.Providers() {
+			providers = append(providers, &AuthProvider{Id: p.Id(), Name: p.Name()})
+		}
+	}
+	ctx.JSON(http.StatusOK, api.Okay(api.WithData(&AuthMethods{
+		Passport:     len(providers) > 0,
+		Providers:    providers,
+		Password:     c.AuthEnabled(AuthMethodPassword),
+		Email:        c.AuthEnabled(AuthMethodEmail),
+		Registration: c.Auth.Registration && (c.AuthEnabled(AuthMethodPassword) || c.AuthEnabled(AuthMethodEmail)),
+	})))
+}
+
+// Register creates a local account and logs it in, the email stays unverified until VerifyEmail confirms it
+func (a *authHandler) Register(ctx *gin.Context) {
+	if !requireAuthMethod(ctx, AuthMethodPassword) {
+		return
+	}
+	if !config.GetConfig().Auth.Registration {
+		ctx.JSON(http.StatusForbidden, api.Fail(api.WithMessage("Registration is disabled")))
+		return
+	}
+
+	var req RegisterRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.Fail(api.WithMessage(err.Error())))
+		return
+	}
+	if !usernamePattern.MatchString(req.Username) {
+		ctx.JSON(http.StatusBadRequest, api.Fail(api.WithMessage("Username may only contain letters, digits, '_', '.' and '-'")))
+		return
+	}
+
+	username := strings.ToLower(req.Username)
+	email := normalizeEmail(req.Email)
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = req.Username
+	}
+
+	var count int64
+	query := database.DB(ctx).Model(&entity.User{}).Where("username = ?", username)
+	if email != "" {
+		// 未验证的邮箱不占用，避免他人抢先注册别人的邮箱
+		query = query.Or("email = ? AND email_verified = ?", email, true)
+	}
+	if err := query.Count(&count).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to register")))
+		return
+	}
+	if count > 0 {
+		ctx.JSON(http.StatusConflict, api.Fail(api.WithMessage("Username or email is already taken")))
+		return
+	}
+
+	user := entity.User{
+		Uuid:     uuid.New().String(),
+		Username: &username,
+		Name:     name,
+		Email:    email,
+	}
+	if err := user.SetPassword(req.Password); err != nil {
+		ctx.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to register")))
+		return
+	}
+	// 并发注册时由唯一索引兜底
+	if err := database.DB(ctx).Create(&user).Error; err != nil {
+		ctx.JSON(http.StatusConflict, api.Fail(api.WithMessage("Username or email is already taken")))
+		return
+	}
+
+	if err := signIn(ctx, &user); err != nil {
+		ctx.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to login")))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, api.Okay(api.WithData(&UserInfo{User: &user, Admin: auth.IsAdmin(&user)})))
+}
+
+// PasswordLogin logs in a local account with its username or email and password
+func (a *authHandler) PasswordLogin(ctx *gin.Context) {
+	if !requireAuthMethod(ctx, AuthMethodPassword) {
+		return
+	}
+
+	var req PasswordLoginRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.Fail(api.WithMessage(err.Error())))
+		return
+	}
+
+	login := strings.ToLower(strings.TrimSpace(req.Username))
+	var user entity.User
+	err := database.DB(ctx).Where("password_hash <> ''").
+		Where(database.DB(ctx).Where("username = ?", login).Or("email = ? AND email_verified = ?", login, true)).
+		First(&user).Error
+	if err != nil {
+		// 账号不存在时也进行一次哈希比较，避免通过响应时间判断账号是否存在
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(req.Password))
+		ctx.JSON(http.StatusUnauthorized, api.Fail(api.WithMessage("Invalid username or password")))
+		return
+	}
+	if !user.CheckPassword(req.Password) {
+		ctx.JSON(http.StatusUnauthorized, api.Fail(api.WithMessage("Invalid username or password")))
+		return
+	}
+
+	if err := signIn(ctx, &user); err != nil {
+		ctx.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to login")))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, api.Okay(api.WithData(&UserInfo{User: &user, Admin: auth.IsAdmin(&user)})))
+}
+
+// SendEmailCode mails a one-time login code
+func (a *authHandler) SendEmailCode(ctx *gin.Context) {
+	if !requireAuthMethod(ctx, AuthMethodEmail) {
+		return
+	}
+
+	var req SendEmailCodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.Fail(api.WithMessage(err.Error())))
+		return
+	}
+	email := normalizeEmail(req.Email)
+
+	var last entity.LoginCode
+	if err := database.DB(ctx).Where("email = ?", email).Order("id DESC").First(&last).Error; err == nil && time.Since(last.CreatedAt) < loginCodeInterval {
+		ctx.JSON(http.StatusTooManyRequests, api.Fail(api.WithMessage("Please wait before requesting another code")))
+		return
+	}
+
+	// 不允许注册时只给已有账号发送验证码，响应保持一致避免泄露账号是否存在
+	if !config.GetConfig().Auth.Registration {
+		var count int64
+		database.DB(ctx).Model(&entity.User{}).Where("email = ?", email).Count(&count)
+		if count == 0 {
+			ctx.JSON(http.StatusOK, api.Okay(api.WithMessage("Code sent")))
+			return
+		}
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to send code")))
+		return
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+	minutes := config.GetConfig().Auth.CodeMinutes
+
+	loginCode := entity.LoginCode{
+		Email:     email,
+		CodeHash:  entity.HashLoginCode(code),
+		ExpiresAt: time.Now().Add(time.Duration(minutes) * time.Minute),
+	}
+	if err := database.DB(ctx).Create(&loginCode).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to send code")))
+		return
+	}
+
+	if err := mailer.Default().Send(ctx, &mailer.Message{
+		To:      email,
+		Subject: "Your login code",
+		Body:    fmt.Sprintf("Your login code is %s, it expires in %d minutes.\n\n您的登录验证码是 %s，%d 分钟内有效。", code, minutes, code, minutes),
+	}); err != nil {
+		log.Printf("send login code to %s error: %v", email, err)
+		ctx.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to send code")))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, api.Okay(api.WithMessage("Code sent")))
+}
+
+// EmailLogin logs in with a code sent by SendEmailCode, unknown emails are registered when registration is enabled
+func (a *authHandler) EmailLogin(ctx *gin.Context) {
+	if !requireAuthMethod(ctx, AuthMethodEmail) {
+		return
+	}
+
+	var req EmailLoginRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.Fail(api.WithMessage(err.Error())))
+		return
+	}
+	email := normalizeEmail(req.Email)
+	if !consumeLoginCode(ctx, email, req.Code) {
+		ctx.JSON(http.StatusUnauthorized, api.Fail(api.WithMessage("Invalid or expired code")))
+		return
+	}
+
+	// 只匹配已验证的邮箱，注册时填写但未验证的账号不能通过邮箱登录
+	var user entity.User
+	err := database.DB(ctx).Where("email = ? AND email_verified = ?", email, true).First(&user).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if !config.GetConfig().Auth.Registration {
+			ctx.JSON(http.StatusUnauthorized, api.Fail(api.WithMessage("Invalid or expired code")))
+			return
+		}
+		user = entity.User{
+			Uuid:          uuid.New().String(),
+			Name:          strings.SplitN(email, "@", 2)[0],
+			Email:         email,
+			EmailVerified: true,
+		}
+		if err := database.DB(ctx).Create(&user).Error; err != nil {
+			ctx.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to login")))
+			return
+		}
+	case err != nil:
+		ctx.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to login")))
+		return
+	}
+
+	if err := signIn(ctx, &user); err != nil {
+		ctx.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to login")))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, api.Okay(api.WithData(&UserInfo{User: &user, Admin: auth.IsAdmin(&user)})))
+}
+
+// VerifyEmail confirms the email of the current user with a code sent by SendEmailCode
+func (a *authHandler) VerifyEmail(ctx *gin.Context) {
+	if !requireAuthMethod(ctx, AuthMethodEmail) {
+		return
+	}
+
+	var req VerifyEmailRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, api.Fail(api.WithMessage(err.Error())))
+		return
+	}
+	user := auth.MustGetUserFromCtx(ctx)
+	if user.Email == "" || user.EmailVerified {
+		ctx.JSON(http.StatusBadRequest, api.Fail(api.WithMessage("No email to verify")))
+		return
+	}
+	if !consumeLoginCode(ctx, user.Email, req.Code) {
+		ctx.JSON(http.StatusUnauthorized, api.Fail(api.WithMessage("Invalid or expired code")))
+		return
+	}
+
+	err := database.DB(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&entity.User{}).Where("email = ? AND email_verified = ? AND id <> ?", user.Email, true, user.Id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errEmailTaken
+		}
+		return tx.Model(user).Update("email_verified", true).Error
+	})
+	switch {
+	case errors.Is(err, errEmailTaken):
+		ctx.JSON(http.StatusConflict, api.Fail(api.WithMessage("Email is already taken")))
+		return
+	case err != nil:
+		ctx.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to verify email")))
+		return
+	}
+	user.EmailVerified = true
+
+	ctx.JSON(http.StatusOK, api.Okay(api.WithData(&UserInfo{User: user, Admin: auth.IsAdmin(user)})))
+}
@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"meeting/internal/model/entity"
+	"meeting/pkg/config"
+	"meeting/pkg/database"
+	"meeting/pkg/mailer"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+)
+
+var loginCodePattern = regexp.MustCompile(`login code is (\d{6})`)
+
+// setupEmailLogin enables the email login and sends the codes to a FileMailer in a temporary directory
+func setupEmailLogin(t *testing.T, registration bool) (*gin.Engine, string) {
+	t.Helper()
+	setupDB(t)
+
+	var c config.TomlConfig
+	c.Auth.Methods = []string{AuthMethodPassword, AuthMethodEmail}
+	c.Auth.Registration = registration
+	c.Auth.CodeMinutes = 10
+	config.Use(c)
+	dir := t.TempDir()
+	mailer.Use(mailer.NewFileMailer(dir))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(sessions.Sessions("session", cookie.NewStore([]byte("test"))))
+	r.POST("/api/auth/register", AuthHandler.Register)
+	r.POST("/api/auth/email/code", AuthHandler.SendEmailCode)
+	r.POST("/api/auth/email/login", AuthHandler.EmailLogin)
+	return r, dir
+}
+
+func postJSON(r *gin.Engine, path string, body any) *httptest.ResponseRecorder {
+	b, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// sendCode requests a login code for email and reads it from the mail written by the FileMailer
+func sendCode(t *testing.T, r *gin.Engine, dir, email string) string {
+	t.Helper()
+	if w := postJSON(r, "/api/auth/email/code", &SendEmailCodeRequest{Email: email}); w.Code != http.StatusOK {
+		t.Fatalf("send code: got %d %s", w.Code, w.Body)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, email+"-*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("got %d mails to %s, want 1", len(files), email)
+	}
+	content, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := loginCodePattern.FindSubmatch(content)
+	if m == nil {
+		t.Fatalf("no code in mail:\n%s", content)
+	}
+	return string(m[1])
+}
+
+func emailLogin(r *gin.Engine, email, code string) int {
+	return postJSON(r, "/api/auth/email/login", &EmailLoginRequest{Email: email, Code: code}).Code
+}
+
+func TestSendEmailCode(t *testing.T) {
+	r, dir := setupEmailLogin(t, true)
+	code := sendCode(t, r, dir, "a@x.io")
+
+	var loginCode entity.LoginCode
+	if err := database.DB(context.Background()).Where("email = ?", "a@x.io").First(&loginCode).Error; err != nil {
+		t.Fatal(err)
+	}
+	if loginCode.CodeHash == code || !loginCode.Check(code) {
+		t.Fatal("code is not stored as its hash")
+	}
+
+	// 发送间隔内不再发送新的验证码
+	if w := postJSON(r, "/api/auth/email/code", &SendEmailCodeRequest{Email: "A@x.io"}); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("resend: got %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestEmailLoginCodeIsSingleUse(t *testing.T) {
+	r, dir := setupEmailLogin(t, true)
+	code := sendCode(t, r, dir, "a@x.io")
+
+	if got := emailLogin(r, "a@x.io", code); got != http.StatusOK {
+		t.Fatalf("first login: got %d, want %d", got, http.StatusOK)
+	}
+	if got := emailLogin(r, "a@x.io", code); got != http.StatusUnauthorized {
+		t.Fatalf("second login: got %d, want %d", got, http.StatusUnauthorized)
+	}
+
+	var users int64
+	database.DB(context.Background()).Model(&entity.User{}).Where("email = ? AND email_verified = ?", "a@x.io", true).Count(&users)
+	if users != 1 {
+		t.Fatalf("got %d verified users, want 1", users)
+	}
+}
+
+func TestEmailLoginAttemptLimit(t *testing.T) {
+	r, dir := setupEmailLogin(t, true)
+	code := sendCode(t, r, dir, "a@x.io")
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	for i := 0; i < loginCodeMaxAttempts; i++ {
+		if got := emailLogin(r, "a@x.io", wrong); got != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: got %d, want %d", i+1, got, http.StatusUnauthorized)
+		}
+	}
+	// 输错次数用完后，正确的验证码也不能使用
+	if got := emailLogin(r, "a@x.io", code); got != http.StatusUnauthorized {
+		t.Fatalf("login after %d wrong attempts: got %d, want %d", loginCodeMaxAttempts, got, http.StatusUnauthorized)
+	}
+}
+
+func TestEmailLoginRejectsUnverifiedEmail(t *testing.T) {
+	r, dir := setupEmailLogin(t, false)
+	username := "owner"
+	owner := entity.User{Uuid: "owner", Username: &username, Name: "owner", Email: "a@x.io"}
+	if err := database.DB(context.Background()).Create(&owner).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 不允许注册时，邮箱未验证的账号不能通过验证码登录
+	code := sendCode(t, r, dir, "a@x.io")
+	if got := emailLogin(r, "a@x.io", code); got != http.StatusUnauthorized {
+		t.Fatalf("got %d, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+func TestEmailLoginDoesNotTakeOverUnverifiedAccount(t *testing.T) {
+	r, dir := setupEmailLogin(t, true)
+	if w := postJSON(r, "/api/auth/register", &RegisterRequest{Username: "squatter", Email: "a@x.io", Password: "password1"}); w.Code != http.StatusOK {
+		t.Fatalf("register: got %d %s", w.Code, w.Body)
+	}
+
+	code := sendCode(t, r, dir, "a@x.io")
+	w := postJSON(r, "/api/auth/email/login", &EmailLoginRequest{Email: "a@x.io", Code: code})
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data struct {
+			Username *string `json:"username"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.Username != nil {
+		t.Fatalf("logged in as %s, the account registered with the unverified email", *resp.Data.Username)
+	}
+}
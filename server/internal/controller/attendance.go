@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"meeting/internal/model/entity"
+	"meeting/pkg/api"
+	"meeting/pkg/database"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SessionInfo represents a meeting of a room and who attended it
+type SessionInfo struct {
+	Id        uint       `json:"id"`
+	StartedAt time.Time  `json:"startedAt"`
+	EndedAt   *time.Time `json:"endedAt,omitempty"`
+	// Duration 单位为秒，进行中的会议计算到当前时间
+	Duration     int64             `json:"duration"`
+	MaxOnline    int               `json:"maxOnline"`
+	Participants int               `json:"participants"`
+	Attendances  []*AttendanceInfo `json:"attendances"`
+}
+
+// AttendanceInfo represents the attendance of a user in a meeting
+type AttendanceInfo struct {
+	UserId   string     `json:"userId"`
+	Name     string     `json:"name"`
+	JoinedAt time.Time  `json:"joinedAt"`
+	LeftAt   *time.Time `json:"leftAt,omitempty"`
+	// Duration 为在会议中的总秒数
+	Duration   int64 `json:"duration"`
+	Reconnects int   `json:"reconnects"`
+	Online     bool  `json:"online"`
+}
+
+func newAttendanceInfo(a *entity.MeetingAttendance, now time.Time) *AttendanceInfo {
+	info := &AttendanceInfo{
+		UserId:     a.UserUuid,
+		Name:       a.UserName,
+		JoinedAt:   a.JoinedAt,
+		LeftAt:     a.LeftAt,
+		Duration:   int64(a.Duration(now).Seconds()),
+		Reconnects: a.Reconnects,
+		Online:     a.IsOnline(),
+	}
+	// 仍在会议中的用户没有离开时间
+	if info.Online {
+		info.LeftAt = nil
+	}
+
+	return info
+}
+
+func newSessionInfo(s *entity.MeetingSession, now time.Time) *SessionInfo {
+	info := &SessionInfo{
+		Id:           s.Id,
+		StartedAt:    s.StartedAt,
+		EndedAt:      s.EndedAt,
+		Duration:     int64(s.Duration(now).Seconds()),
+		MaxOnline:    s.MaxOnline,
+		Participants: len(s.Attendances),
+		Attendances:  make([]*AttendanceInfo, 0, len(s.Attendances)),
+	}
+	for _, a := range s.Attendances {
+		info.Attendances = append(info.Attendances, newAttendanceInfo(a, now))
+	}
+
+	return info
+}
+
+// GetRoomSessions returns the latest meetings of a room with their attendance, paged by the before id (moderators only)
+func GetRoomSessions(c *gin.Context) {
+	room, ok := findManagedRoom(c, entity.RoleModerator)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	limit = min(max(limit, 1), 100)
+	query := database.DB(c).Preload("Attendances", func(db *gorm.DB) *gorm.DB {
+		return db.Order("joined_at")
+	}).Where("room_id = ?", room.Id).Order("id DESC").Limit(limit)
+	if before, err := strconv.ParseUint(c.Query("before"), 10, 64); err == nil {
+		query = query.Where("id < ?", before)
+	}
+
+	var sessions []*entity.MeetingSession
+	if err := query.Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to get sessions")))
+		return
+	}
+
+	now := time.Now()
+	infos := make([]*SessionInfo, 0, len(sessions))
+	for _, s := range sessions {
+		infos = append(infos, newSessionInfo(s, now))
+	}
+	c.JSON(http.StatusOK, api.Okay(api.WithData(infos)))
+}
+
+// ExportSessionAttendance exports the attendance of a meeting as CSV (moderators only)
+func ExportSessionAttendance(c *gin.Context) {
+	room, ok := findManagedRoom(c, entity.RoleModerator)
+	if !ok {
+		return
+	}
+
+	var session entity.MeetingSession
+	err := database.DB(c).Preload("Attendances", func(db *gorm.DB) *gorm.DB {
+		return db.Order("joined_at")
+	}).Where("id = ? AND room_id = ?", c.Param("sessionId"), room.Id).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, api.Fail(api.WithMessage("Session not found")))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to get session")))
+		return
+	}
+
+	now := time.Now()
+	var buf bytes.Buffer
+	// BOM 让 Excel 以 UTF-8 打开中文姓名
+	buf.WriteString("\ufeff")
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{"Name", "User ID", "Joined At", "Left At", "Duration (s)", "Reconnects", "Online"})
+	for _, a := range session.Attendances {
+		info := newAttendanceInfo(a, now)
+		leftAt := ""
+		if info.LeftAt != nil {
+			leftAt = info.LeftAt.Format(time.RFC3339)
+		}
+		_ = w.Write([]string{
+			csvSafe(info.Name),
+			info.UserId,
+			info.JoinedAt.Format(time.RFC3339),
+			leftAt,
+			strconv.FormatInt(info.Duration, 10),
+			strconv.Itoa(info.Reconnects),
+			strconv.FormatBool(info.Online),
+		})
+	}
+	w.Flush()
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%d.csv"`, room.Uuid, session.Id))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
+
+// csvSafe keeps user provided names from being evaluated as formulas by spreadsheets
+func csvSafe(s string) string {
+	// 制表符和回车开头的内容同样会被部分表格软件当作公式
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"meeting/internal/constants"
+	"meeting/internal/model/entity"
+	"meeting/pkg/database"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCSVSafe(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"Alice", "Alice"},
+		{"张三", "张三"},
+		{"a=b", "a=b"},
+		{"=HYPERLINK(\"x\")", "'=HYPERLINK(\"x\")"},
+		{"+1", "'+1"},
+		{"-1", "'-1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+	}
+	for _, tt := range tests {
+		if got := csvSafe(tt.in); got != tt.want {
+			t.Errorf("csvSafe(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestExportSessionAttendance(t *testing.T) {
+	setupDB(t)
+	db := database.DB(context.Background())
+	user := entity.User{Uuid: "host", Name: "host"}
+	room := entity.Room{Uuid: "room", Name: "room"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&room).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&entity.RoomUser{RoomId: room.Id, UserId: user.Id, Role: entity.RoleHost}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	session := entity.MeetingSession{RoomId: room.Id, StartedAt: start, EndedAt: &end, MaxOnline: 2}
+	if err := db.Create(&session).Error; err != nil {
+		t.Fatal(err)
+	}
+	attendances := []*entity.MeetingAttendance{
+		{SessionId: session.Id, RoomId: room.Id, UserUuid: "u1", UserName: "张三", JoinedAt: start, LeftAt: &end, DurationSeconds: 3000, Reconnects: 2},
+		{SessionId: session.Id, RoomId: room.Id, UserUuid: "u2", UserName: "=cmd|' /C calc'!A0", JoinedAt: start.Add(time.Minute), LeftAt: &end, DurationSeconds: 60},
+	}
+	if err := db.Create(attendances).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set(constants.UserKey, &user) })
+	r.GET("/api/rooms/:id/sessions/:sessionId/attendance.csv", ExportSessionAttendance)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/rooms/%s/sessions/%d/attendance.csv", room.Uuid, session.Id), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+
+	body, ok := bytes.CutPrefix(w.Body.Bytes(), []byte("\ufeff"))
+	if !ok {
+		t.Fatal("missing UTF-8 BOM")
+	}
+	records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"Name", "User ID", "Joined At", "Left At", "Duration (s)", "Reconnects", "Online"},
+		{"张三", "u1", "2026-03-01T09:00:00Z", "2026-03-01T10:00:00Z", "3000", "2", "false"},
+		{"'=cmd|' /C calc'!A0", "u2", "2026-03-01T09:01:00Z", "2026-03-01T10:00:00Z", "60", "0", "false"},
+	}
+	if fmt.Sprint(records) != fmt.Sprint(want) {
+		t.Fatalf("got %q, want %q", records, want)
+	}
+
+	// 其他房间的场次不能导出
+	other := entity.Room{Uuid: "other", Name: "other"}
+	db.Create(&other)
+	db.Create(&entity.RoomUser{RoomId: other.Id, UserId: user.Id, Role: entity.RoleHost})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/rooms/%s/sessions/%d/attendance.csv", other.Uuid, session.Id), nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("session of another room: got %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"meeting/internal/model/entity"
+	"meeting/internal/utility/auth"
+	"meeting/pkg/api"
+	"meeting/pkg/database"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetRoomMessages returns the chat history of a room, newest first (members only)
+func GetRoomMessages(c *gin.Context) {
+	roomUuid := c.Param("id")
+	user := auth.MustGetUserFromCtx(c)
+
+	// 查找房间
+	var room entity.Room
+	if err := database.DB(c).Where("uuid = ?", roomUuid).First(&room).Error; err != nil {
+		c.JSON(http.StatusNotFound, api.Fail(api.WithMessage("Room not found")))
+		return
+	}
+
+	// 检查用户是否为房间成员
+	var roomUser entity.RoomUser
+	if err := database.DB(c).Where("room_id = ? AND user_id = ?", room.Id, user.Id).First(&roomUser).Error; err != nil || roomUser.IsBlocked() {
+		c.JSON(http.StatusForbidden, api.Fail(api.WithMessage("Access denied")))
+		return
+	}
+
+	page, offset, limit := api.PageParamsFromCtx(c, 50, 200)
+
+	var total int64
+	if err := database.DB(c).Model(&entity.ChatMessage{}).Where("room_id = ?", room.Id).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to fetch messages")))
+		return
+	}
+
+	var messages = make([]entity.ChatMessage, 0)
+	if err := database.DB(c).Preload("File").Where("room_id = ?", room.Id).Order("created_at desc").Order("id desc").Offset(offset).Limit(limit).Find(&messages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to fetch messages")))
+		return
+	}
+
+	c.JSON(http.StatusOK, api.Okay(api.WithData(api.PageList(total, messages, page, limit))))
+}
@@ -0,0 +1,387 @@
+package controller
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"log"
+	"meeting/internal/model/entity"
+	"meeting/internal/service/upload"
+	"meeting/internal/service/webrtc"
+	"meeting/internal/utility/auth"
+	"meeting/pkg/api"
+	"meeting/pkg/config"
+	"meeting/pkg/database"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// 断点续传遵循 tus 1.0.0 核心协议，支持 creation、termination 和 expiration 扩展
+const (
+	tusVersion = "1.0.0"
+	// tusContentType is the content type of PATCH requests
+	tusContentType = "application/offset+octet-stream"
+	maxFileName    = 255
+)
+
+// RoomFileInfo represents a file shared in a room
+type RoomFileInfo struct {
+	*entity.RoomFile
+	UploadedBy string `json:"uploadedBy"`
+}
+
+// findRoomMember loads the room in the path, writing the error response if the user is not a member
+func findRoomMember(c *gin.Context) (*entity.Room, *entity.RoomUser, bool) {
+	user := auth.MustGetUserFromCtx(c)
+
+	var room entity.Room
+	if err := database.DB(c).Where("uuid = ?", c.Param("id")).First(&room).Error; err != nil {
+		c.JSON(http.StatusNotFound, api.Fail(api.WithMessage("Room not found")))
+		return nil, nil, false
+	}
+
+	var roomUser entity.RoomUser
+	if err := database.DB(c).Where("room_id = ? AND user_id = ?", room.Id, user.Id).First(&roomUser).Error; err != nil || roomUser.IsBlocked() {
+		c.JSON(http.StatusForbidden, api.Fail(api.WithMessage("Access denied")))
+		return nil, nil, false
+	}
+
+	return &room, &roomUser, true
+}
+
+// findRoomFile loads the file in the path, expired files are gone even before they are removed
+func findRoomFile(c *gin.Context) (*entity.Room, *entity.RoomUser, *entity.RoomFile, bool) {
+	room, roomUser, ok := findRoomMember(c)
+	if !ok {
+		return nil, nil, nil, false
+	}
+
+	var file entity.RoomFile
+	err := database.DB(c).Where("uuid = ? AND room_id = ?", c.Param("fileId"), room.Id).First(&file).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, api.Fail(api.WithMessage("File not found")))
+		return nil, nil, nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to get file")))
+		return nil, nil, nil, false
+	}
+	if file.IsExpired() {
+		c.JSON(http.StatusGone, api.Fail(api.WithMessage("File has expired")))
+		return nil, nil, nil, false
+	}
+
+	return room, roomUser, &file, true
+}
+
+// tusHeaders sets the headers every tus response carries
+func tusHeaders(c *gin.Context, file *entity.RoomFile) {
+	c.Header("Tus-Resumable", tusVersion)
+	if file != nil {
+		c.Header("Upload-Offset", strconv.FormatInt(file.Received, 10))
+		c.Header("Upload-Length", strconv.FormatInt(file.Size, 10))
+		c.Header("Upload-Expires", file.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+// checkTusVersion rejects clients speaking another version of the protocol
+func checkTusVersion(c *gin.Context) bool {
+	if v := c.GetHeader("Tus-Resumable"); v != "" && v != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.JSON(http.StatusPreconditionFailed, api.Fail(api.WithMessage("Unsupported tus version")))
+		return false
+	}
+	return true
+}
+
+// parseUploadMetadata decodes the Upload-Metadata header, pairs of key and base64 value separated by commas
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, " ")
+		b, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, errors.New("invalid Upload-Metadata")
+		}
+		metadata[key] = string(b)
+	}
+	return metadata, nil
+}
+
+// GetRoomFiles returns the unexpired files shared in a room, newest first (members only)
+func GetRoomFiles(c *gin.Context) {
+	room, _, ok := findRoomMember(c)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	limit = min(max(limit, 1), 200)
+	var files []*entity.RoomFile
+	if err := database.DB(c).Preload("Uploader").Where("room_id = ? AND status = ? AND expires_at > ?", room.Id, entity.RoomFileStatusCompleted, time.Now()).
+		Order("id DESC").Limit(limit).Find(&files).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to get files")))
+		return
+	}
+
+	infos := make([]*RoomFileInfo, 0, len(files))
+	for _, f := range files {
+		info := &RoomFileInfo{RoomFile: f}
+		if f.Uploader != nil {
+			info.UploadedBy = f.Uploader.Name
+		}
+		infos = append(infos, info)
+	}
+	c.JSON(http.StatusOK, api.Okay(api.WithData(infos)))
+}
+
+// CreateRoomFile starts an upload, the size is given by Upload-Length and the name by the filename metadata
+func CreateRoomFile(c *gin.Context) {
+	if !checkTusVersion(c) {
+		return
+	}
+	room, roomUser, ok := findRoomMember(c)
+	if !ok {
+		return
+	}
+	if !slices.Contains(roomUser.Role.Capabilities(), entity.CapabilityChat) {
+		c.JSON(http.StatusForbidden, api.Fail(api.WithMessage("File sharing is not allowed for your role")))
+		return
+	}
+
+	size, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || size < 0 {
+		c.JSON(http.StatusBadRequest, api.Fail(api.WithMessage("Upload-Length is required")))
+		return
+	}
+	metadata, err := parseUploadMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.Fail(api.WithMessage(err.Error())))
+		return
+	}
+	// 文件名只用于展示和下载，内容按 uuid 存储
+	name := strings.TrimSpace(filepath.Base(strings.ReplaceAll(metadata["filename"], "\\", "/")))
+	if name == "" || name == "." || name == "/" {
+		c.JSON(http.StatusBadRequest, api.Fail(api.WithMessage("filename metadata is required")))
+		return
+	}
+	name = truncateString(name, maxFileName)
+
+	cfg := config.GetConfig().Upload
+	if size > cfg.MaxFileMB<<20 {
+		c.JSON(http.StatusRequestEntityTooLarge, api.Fail(api.WithMessage("File exceeds the size limit")))
+		return
+	}
+	user := auth.MustGetUserFromCtx(c)
+	file := &entity.RoomFile{
+		Uuid:       uuid.New().String(),
+		RoomId:     room.Id,
+		UploadedBy: user.Id,
+		Name:       name,
+		MimeType:   truncateString(metadata["filetype"], 100),
+		Size:       size,
+		Status:     entity.RoomFileStatusUploading,
+		ExpiresAt:  time.Now().Add(time.Duration(cfg.ExpireHours) * time.Hour),
+	}
+	path := upload.Path(file, room.Uuid)
+	if err = os.MkdirAll(filepath.Dir(path), 0750); err == nil {
+		var out *os.File
+		if out, err = os.Create(path); err == nil {
+			err = out.Close()
+		}
+	}
+	if err != nil {
+		log.Printf("create upload %s of room %s error: %v", file.Uuid, room.Uuid, err)
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to create file")))
+		return
+	}
+	// 配额在创建记录的事务中检查，并发上传不会超出
+	if err = upload.Reserve(c, file, cfg.RoomQuotaMB<<20); err != nil {
+		_ = os.Remove(path)
+		if errors.Is(err, upload.ErrQuotaExceeded) {
+			c.JSON(http.StatusRequestEntityTooLarge, api.Fail(api.WithMessage("Room file quota exceeded")))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to create file")))
+		return
+	}
+	// 空文件不需要再上传内容
+	if size == 0 {
+		completeRoomFile(c, room, file)
+	}
+
+	tusHeaders(c, file)
+	c.Header("Location", "/api/rooms/"+room.Uuid+"/files/"+file.Uuid)
+	c.JSON(http.StatusCreated, api.Okay(api.WithData(file)))
+}
+
+// HeadRoomFile returns the offset to resume an upload from
+func HeadRoomFile(c *gin.Context) {
+	if !checkTusVersion(c) {
+		return
+	}
+	_, _, file, ok := findRoomFile(c)
+	if !ok {
+		return
+	}
+
+	tusHeaders(c, file)
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+}
+
+// PatchRoomFile appends the request body to an upload at Upload-Offset (uploader only)
+func PatchRoomFile(c *gin.Context) {
+	if !checkTusVersion(c) {
+		return
+	}
+	if c.ContentType() != tusContentType {
+		c.JSON(http.StatusUnsupportedMediaType, api.Fail(api.WithMessage("Content-Type must be "+tusContentType)))
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, api.Fail(api.WithMessage("Upload-Offset is required")))
+		return
+	}
+	room, _, file, ok := findRoomFile(c)
+	if !ok {
+		return
+	}
+	if file.UploadedBy != auth.MustGetUserFromCtx(c).Id {
+		c.JSON(http.StatusForbidden, api.Fail(api.WithMessage("Only the uploader can upload the file")))
+		return
+	}
+
+	if file.IsCompleted() || offset != file.Received {
+		tusHeaders(c, file)
+		c.JSON(http.StatusConflict, api.Fail(api.WithMessage("Upload-Offset does not match the upload")))
+		return
+	}
+	remaining := file.Size - file.Received
+	if c.Request.ContentLength > remaining {
+		c.JSON(http.StatusRequestEntityTooLarge, api.Fail(api.WithMessage("Body exceeds Upload-Length")))
+		return
+	}
+
+	// 租约保存在数据库中，多节点时同一上传同一时间只有一个请求写入
+	lease, err := upload.Acquire(c, file, offset)
+	if errors.Is(err, upload.ErrBusy) {
+		// 其他请求正在写入或刚刚写入，返回最新的进度
+		if database.DB(c).First(file, file.Id).Error == nil {
+			tusHeaders(c, file)
+		}
+		c.JSON(http.StatusConflict, api.Fail(api.WithMessage("Upload is in progress or Upload-Offset does not match the upload")))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to write file")))
+		return
+	}
+
+	path := upload.Path(file, room.Uuid)
+	out, err := os.OpenFile(path, os.O_WRONLY, 0)
+	var n int64
+	if err == nil {
+		// 丢弃上次中断时未记录的内容
+		if err = out.Truncate(offset); err == nil {
+			_, err = out.Seek(offset, io.SeekStart)
+		}
+		if err == nil {
+			// 连接中断时保留已经收到的部分，客户端从新的偏移继续上传
+			n, err = io.Copy(lease.Writer(out), io.LimitReader(c.Request.Body, remaining))
+		}
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	if releaseErr := lease.Release(c, offset+n); releaseErr != nil {
+		log.Printf("save offset of upload %s error: %v", file.Uuid, releaseErr)
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to save upload offset")))
+		return
+	}
+	if err != nil {
+		log.Printf("write upload %s error: %v", file.Uuid, err)
+		tusHeaders(c, file)
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to write file")))
+		return
+	}
+	if file.Received == file.Size {
+		completeRoomFile(c, room, file)
+	}
+
+	tusHeaders(c, file)
+	c.Status(http.StatusNoContent)
+}
+
+// completeRoomFile marks the upload completed and shares it in the chat of the room
+func completeRoomFile(c *gin.Context, room *entity.Room, file *entity.RoomFile) {
+	file.Status = entity.RoomFileStatusCompleted
+	if err := database.DB(c).Model(file).Update("status", file.Status).Error; err != nil {
+		log.Printf("complete upload %s error: %v", file.Uuid, err)
+		return
+	}
+
+	user := auth.MustGetUserFromCtx(c)
+	webrtc.WsServer.ShareFile(room, &webrtc.User{Id: user.Uuid, Name: user.Name, Avatar: user.Avatar}, file)
+}
+
+// DownloadRoomFile sends a completed file (members only)
+func DownloadRoomFile(c *gin.Context) {
+	room, _, file, ok := findRoomFile(c)
+	if !ok {
+		return
+	}
+	if !file.IsCompleted() {
+		c.JSON(http.StatusConflict, api.Fail(api.WithMessage("File is still uploading")))
+		return
+	}
+
+	c.FileAttachment(upload.Path(file, room.Uuid), file.Name)
+}
+
+// DeleteRoomFile removes a file or cancels an upload (uploader or moderators)
+func DeleteRoomFile(c *gin.Context) {
+	if !checkTusVersion(c) {
+		return
+	}
+	room, roomUser, file, ok := findRoomFile(c)
+	if !ok {
+		return
+	}
+	if file.UploadedBy != auth.MustGetUserFromCtx(c).Id && !roomUser.HasRole(entity.RoleModerator) {
+		c.JSON(http.StatusForbidden, api.Fail(api.WithMessage("Only the uploader or a moderator can delete the file")))
+		return
+	}
+
+	if err := upload.Remove(c, file, room.Uuid); err != nil {
+		log.Printf("remove file %s of room %s error: %v", file.Uuid, room.Uuid, err)
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to delete file")))
+		return
+	}
+
+	tusHeaders(c, nil)
+	c.Status(http.StatusNoContent)
+}
+
+func truncateString(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,325 @@
+package controller
+
+import (
+	"errors"
+	"meeting/internal/model/entity"
+	"meeting/internal/utility/auth"
+	"meeting/pkg/api"
+	"meeting/pkg/database"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errInviteUnusable = errors.New("invite is no longer valid")
+	errAlreadyMember  = errors.New("already a member of the room")
+)
+
+// InviteCodeResponse represents the shareable invite code of a room and the link to share
+type InviteCodeResponse struct {
+	Code string `json:"code"`
+	Link string `json:"link"`
+}
+
+func newInviteCodeResponse(room *entity.Room, invite *entity.RoomInvite) *InviteCodeResponse {
+	return &InviteCodeResponse{
+		Code: invite.Code,
+		Link: inviteLink(room, invite.Code),
+	}
+}
+
+// inviteLink returns the meeting link that joins the room with an invite code
+func inviteLink(room *entity.Room, code string) string {
+	return meetingURL(room) + "?code=" + code
+}
+
+// shareableInvite returns the invite shared from the meeting, an attendee invite without
+// limits, it is created when the moderators have not created one or revoked it
+func shareableInvite(db *gorm.DB, room *entity.Room, createdBy uint) (*entity.RoomInvite, error) {
+	var invite entity.RoomInvite
+	err := db.Where("room_id = ? AND role = ? AND max_uses = 0 AND expires_at IS NULL AND revoked_at IS NULL", room.Id, entity.RoleUser).
+		Order("id DESC").First(&invite).Error
+	if err == nil {
+		return &invite, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	return createInvite(db, room.Id, createdBy, entity.RoleUser, 0, nil)
+}
+
+// createInvite stores a new invite of a room with a random code
+func createInvite(db *gorm.DB, roomId, createdBy uint, role entity.Role, maxUses int, expiresAt *time.Time) (*entity.RoomInvite, error) {
+	code, err := entity.NewInviteCode()
+	if err != nil {
+		return nil, err
+	}
+	invite := &entity.RoomInvite{
+		RoomId:    roomId,
+		Code:      code,
+		Role:      role,
+		MaxUses:   maxUses,
+		ExpiresAt: expiresAt,
+		CreatedBy: createdBy,
+	}
+	if err = db.Omit("Room", "Creator").Create(invite).Error; err != nil {
+		return nil, err
+	}
+
+	return invite, nil
+}
+
+// redeemInvite makes the user a member of the room of the invite with its role, members keep
+// their role and do not use the invite up, the caller checks whether the member is blocked
+func redeemInvite(db *gorm.DB, userId uint, invite *entity.RoomInvite) (*entity.RoomUser, error) {
+	var roomUser entity.RoomUser
+	err := db.Where("room_id = ? AND user_id = ?", invite.RoomId, userId).First(&roomUser).Error
+	if err == nil {
+		return &roomUser, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if !invite.IsUsable(time.Now()) {
+		return nil, errInviteUnusable
+	}
+
+	roomUser = entity.RoomUser{RoomId: invite.RoomId, UserId: userId, Role: invite.Role}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// 条件更新保证并发兑换时不会超过次数上限
+		res := tx.Model(&entity.RoomInvite{}).
+			Where("id = ? AND revoked_at IS NULL AND (max_uses = 0 OR uses < max_uses)", invite.Id).
+			Update("uses", gorm.Expr("uses + 1"))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errInviteUnusable
+		}
+
+		// 唯一索引保证并发兑换时只创建一条成员记录，已被其他请求创建时回滚兑换次数
+		res = tx.Omit("Room", "User").Clauses(clause.OnConflict{DoNothing: true}).Create(&roomUser)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errAlreadyMember
+		}
+		return nil
+	})
+	if errors.Is(err, errAlreadyMember) {
+		if err = db.Where("room_id = ? AND user_id = ?", invite.RoomId, userId).First(&roomUser).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &roomUser, nil
+}
+
+// GetInviteCode returns the shareable invite code of a room (moderators only)
+func GetInviteCode(c *gin.Context) {
+	room, ok := findManagedRoom(c, entity.RoleModerator)
+	if !ok {
+		return
+	}
+
+	invite, err := shareableInvite(database.DB(c), room, auth.MustGetUserFromCtx(c).Id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to get invite code")))
+		return
+	}
+
+	c.JSON(http.StatusOK, api.Okay(api.WithData(newInviteCodeResponse(room, invite))))
+}
+
+// ResetInviteCode revokes the shareable invite code of a room and creates a new one, links shared before stop working (moderators only)
+func ResetInviteCode(c *gin.Context) {
+	room, ok := findManagedRoom(c, entity.RoleModerator)
+	if !ok {
+		return
+	}
+
+	user := auth.MustGetUserFromCtx(c)
+	var invite *entity.RoomInvite
+	err := database.DB(c).Transaction(func(tx *gorm.DB) error {
+		current, err := shareableInvite(tx, room, user.Id)
+		if err != nil {
+			return err
+		}
+		if err = tx.Model(current).Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		invite, err = createInvite(tx, room.Id, user.Id, entity.RoleUser, 0, nil)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to reset invite code")))
+		return
+	}
+
+	c.JSON(http.StatusOK, api.Okay(api.WithData(newInviteCodeResponse(room, invite))))
+}
+
+// CreateInviteRequest represents the request structure for creating an invite link
+type CreateInviteRequest struct {
+	Role      string     `json:"role" binding:"omitempty,oneof=co-host presenter attendee viewer guest"`
+	MaxUses   int        `json:"maxUses" binding:"min=0"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// InviteInfo represents an invite link of a room
+type InviteInfo struct {
+	Code      string     `json:"code"`
+	Link      string     `json:"link"`
+	Role      string     `json:"role"`
+	MaxUses   int        `json:"maxUses"`
+	Uses      int        `json:"uses"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+	Usable    bool       `json:"usable"`
+	CreatedBy string     `json:"createdBy"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// RedeemInviteResponse represents the room joined through an invite
+type RedeemInviteResponse struct {
+	RoomId string `json:"roomId"`
+	Role   string `json:"role"`
+}
+
+func newInviteInfo(room *entity.Room, invite *entity.RoomInvite) *InviteInfo {
+	info := &InviteInfo{
+		Code:      invite.Code,
+		Link:      inviteLink(room, invite.Code),
+		Role:      invite.Role.String(),
+		MaxUses:   invite.MaxUses,
+		Uses:      invite.Uses,
+		ExpiresAt: invite.ExpiresAt,
+		RevokedAt: invite.RevokedAt,
+		Usable:    invite.IsUsable(time.Now()),
+		CreatedAt: invite.CreatedAt,
+	}
+	if invite.Creator != nil {
+		info.CreatedBy = invite.Creator.Name
+	}
+
+	return info
+}
+
+// CreateInvite creates an invite link with an optional expiry, usage limit and role (moderators only)
+func CreateInvite(c *gin.Context) {
+	var req CreateInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, api.Fail(api.WithMessage(err.Error())))
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, api.Fail(api.WithMessage("expiresAt must be in the future")))
+		return
+	}
+	role := entity.RoleUser
+	if req.Role != "" {
+		role, _ = entity.ParseRole(req.Role)
+	}
+
+	room, ok := findManagedRoom(c, entity.RoleModerator)
+	if !ok {
+		return
+	}
+
+	user := auth.MustGetUserFromCtx(c)
+	// 只有房主可以邀请联席主持人
+	if role == entity.RoleCoHost {
+		var roomUser entity.RoomUser
+		if err := database.DB(c).Where("room_id = ? AND user_id = ?", room.Id, user.Id).First(&roomUser).Error; err != nil || !roomUser.IsHost() {
+			c.JSON(http.StatusForbidden, api.Fail(api.WithMessage("Only the room owner can appoint co-hosts")))
+			return
+		}
+	}
+
+	invite, err := createInvite(database.DB(c), room.Id, user.Id, role, req.MaxUses, req.ExpiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to create invite")))
+		return
+	}
+	invite.Creator = user
+
+	c.JSON(http.StatusOK, api.Okay(api.WithData(newInviteInfo(room, invite))))
+}
+
+// GetInvites returns the invite links of a room, newest first (moderators only)
+func GetInvites(c *gin.Context) {
+	room, ok := findManagedRoom(c, entity.RoleModerator)
+	if !ok {
+		return
+	}
+
+	var invites []entity.RoomInvite
+	if err := database.DB(c).Preload("Creator").Where("room_id = ?", room.Id).Order("id DESC").Find(&invites).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to get invites")))
+		return
+	}
+
+	infos := make([]*InviteInfo, 0, len(invites))
+	for i := range invites {
+		infos = append(infos, newInviteInfo(room, &invites[i]))
+	}
+
+	c.JSON(http.StatusOK, api.Okay(api.WithData(infos)))
+}
+
+// RevokeInvite stops an invite link from being redeemed, members who joined through it stay (moderators only)
+func RevokeInvite(c *gin.Context) {
+	room, ok := findManagedRoom(c, entity.RoleModerator)
+	if !ok {
+		return
+	}
+
+	var invite entity.RoomInvite
+	if err := database.DB(c).Preload("Creator").Where("room_id = ? AND code = ?", room.Id, c.Param("code")).First(&invite).Error; err != nil {
+		c.JSON(http.StatusNotFound, api.Fail(api.WithMessage("Invite not found")))
+		return
+	}
+
+	if invite.RevokedAt == nil {
+		now := time.Now()
+		invite.RevokedAt = &now
+		if err := database.DB(c).Model(&invite).Update("revoked_at", now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to revoke invite")))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, api.Okay(api.WithData(newInviteInfo(room, &invite))))
+}
+
+// RedeemInvite makes the current user a member of the room with the role of the invite
+func RedeemInvite(c *gin.Context) {
+	user := auth.MustGetUserFromCtx(c)
+
+	var invite entity.RoomInvite
+	if err := database.DB(c).Preload("Room").Where("code = ?", c.Param("code")).First(&invite).Error; err != nil || invite.Room == nil {
+		c.JSON(http.StatusNotFound, api.Fail(api.WithMessage("Invite not found")))
+		return
+	}
+
+	roomUser, err := redeemInvite(database.DB(c), user.Id, &invite)
+	switch {
+	case errors.Is(err, errInviteUnusable):
+		c.JSON(http.StatusGone, api.Fail(api.WithMessage("Invite is no longer valid")))
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to redeem invite")))
+	case roomUser.IsBlocked():
+		c.JSON(http.StatusForbidden, api.Fail(api.WithMessage("You are blocked from this room")))
+	default:
+		c.JSON(http.StatusOK, api.Okay(api.WithData(&RedeemInviteResponse{RoomId: invite.Room.Uuid, Role: roomUser.Role.String()})))
+	}
+}
@@ -0,0 +1,29 @@
+package controller
+
+import (
+	"meeting/internal/model/entity"
+	"meeting/internal/service/webrtc"
+	"meeting/pkg/api"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdmitClient admits or denies a client waiting in the lobby (admin only)
+func AdmitClient(c *gin.Context) {
+	var req AdmitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, api.Fail(api.WithMessage(err.Error())))
+		return
+	}
+
+	room, ok := findManagedRoom(c, entity.RoleModerator)
+	if !ok {
+		return
+	}
+
+	// 等待的客户端可能连接在其他节点，由其所在节点处理
+	webrtc.WsServer.Admit(room.Uuid, req.ClientId, req.Admitted)
+
+	c.JSON(http.StatusOK, api.Okay(api.WithMessage("Lobby decision sent")))
+}
@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"meeting/internal/model/entity"
+	"meeting/internal/service/webrtc"
+	"meeting/internal/utility/auth"
+	"meeting/pkg/api"
+	"meeting/pkg/database"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UpdateMemberRoleRequest represents the request structure for promoting or demoting a member
+type UpdateMemberRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=co-host presenter attendee viewer guest"`
+}
+
+// UpdateMemberRole promotes or demotes a room member, connected clients get the new role immediately (admin only)
+func UpdateMemberRole(c *gin.Context) {
+	var req UpdateMemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, api.Fail(api.WithMessage(err.Error())))
+		return
+	}
+	role, _ := entity.ParseRole(req.Role)
+
+	user := auth.MustGetUserFromCtx(c)
+
+	// 查找房间
+	var room entity.Room
+	if err := database.DB(c).Where("uuid = ?", c.Param("id")).First(&room).Error; err != nil {
+		c.JSON(http.StatusNotFound, api.Fail(api.WithMessage("Room not found")))
+		return
+	}
+
+	// 检查用户是否为房间管理员
+	var adminRoomUser entity.RoomUser
+	if err := database.DB(c).Where("room_id = ? AND user_id = ?", room.Id, user.Id).First(&adminRoomUser).Error; err != nil || !adminRoomUser.IsModerator() {
+		c.JSON(http.StatusForbidden, api.Fail(api.WithMessage("Only room admin can change roles")))
+		return
+	}
+
+	var targetRoomUser entity.RoomUser
+	if err := database.DB(c).Preload("User").Where("room_id = ? AND user_id = ?", room.Id, c.Param("userId")).First(&targetRoomUser).Error; err != nil || targetRoomUser.User == nil {
+		c.JSON(http.StatusNotFound, api.Fail(api.WithMessage("Member not found")))
+		return
+	}
+
+	if targetRoomUser.UserId == user.Id {
+		c.JSON(http.StatusBadRequest, api.Fail(api.WithMessage("Cannot change your own role")))
+		return
+	}
+	if targetRoomUser.IsHost() {
+		c.JSON(http.StatusForbidden, api.Fail(api.WithMessage("Cannot change the role of the room owner")))
+		return
+	}
+	// 只有房主可以任免联席主持人
+	if (role == entity.RoleCoHost || targetRoomUser.HasRole(entity.RoleCoHost)) && !adminRoomUser.IsHost() {
+		c.JSON(http.StatusForbidden, api.Fail(api.WithMessage("Only the room owner can appoint co-hosts")))
+		return
+	}
+
+	if err := database.DB(c).Model(&targetRoomUser).Update("role", role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to update role")))
+		return
+	}
+
+	// 通知在线的客户端，客户端可能连接在其他节点
+	webrtc.WsServer.SetRole(room.Uuid, targetRoomUser.User.Uuid, role)
+
+	c.JSON(http.StatusOK, api.Okay(api.WithData(RoomMemberInfo{
+		UserId:   targetRoomUser.UserId,
+		UserName: targetRoomUser.User.Name,
+		Role:     role.String(),
+		Blocked:  targetRoomUser.Blocked,
+	})))
+}
@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"io"
+	"meeting/internal/service/webrtc"
+	"meeting/pkg/api"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// monitoringKeepAlive is the interval of the comments keeping the event stream open behind proxies
+const monitoringKeepAlive = 15 * time.Second
+
+// GetMonitoringData returns the monitoring data of all rooms (admin only)
+func GetMonitoringData(c *gin.Context) {
+	c.JSON(http.StatusOK, api.Okay(api.WithData(monitoringRooms())))
+}
+
+// MonitoringEvents streams room lifecycle events as server-sent events (admin only),
+// the stream starts with a snapshot event holding the current rooms
+func MonitoringEvents(c *gin.Context) {
+	events, cancel := webrtc.WsServer.Subscribe()
+	defer cancel()
+
+	c.Header("Cache-Control", "no-cache")
+	// 关闭 nginx 缓冲，事件才能及时送达
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("snapshot", monitoringRooms())
+	c.Writer.Flush()
+
+	ticker := time.NewTicker(monitoringKeepAlive)
+	defer ticker.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(string(event.Type), event)
+		case <-ticker.C:
+			_, _ = io.WriteString(w, ": keep-alive\n\n")
+		case <-c.Request.Context().Done():
+			return false
+		}
+		return true
+	})
+}
+
+// monitoringRooms returns the rooms of this node ordered by start time
+func monitoringRooms() []*webrtc.RoomInfo {
+	rooms := webrtc.WsServer.GetRooms()
+	sort.Slice(rooms, func(i, j int) bool {
+		return rooms[i].StartTime.Before(rooms[j].StartTime)
+	})
+
+	return rooms
+}
@@ -1,84 +1,187 @@
 package controller
 
 import (
-	"context"
+	"crypto/subtle"
 	"errors"
+	"log"
 	"meeting/internal/constants"
 	"meeting/internal/model/entity"
 	"meeting/internal/utility/auth"
 	"meeting/pkg/api"
+	"meeting/pkg/config"
 	"meeting/pkg/database"
 	"meeting/pkg/passport"
 	"net/http"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type authHandler struct{}
 
+// UserInfo represents the current user, Admin grants access to the monitoring pages
+type UserInfo struct {
+	*entity.User
+	Admin bool `json:"admin"`
+}
+
 var AuthHandler = &authHandler{}
 
+// Login redirects to the provider selected by the provider query, the first one by default
 func (a *authHandler) Login(ctx *gin.Context) {
+	if !requireAuthMethod(ctx, AuthMethodPassport) {
+		return
+	}
+	provider := passport.Find(ctx.Query("provider"))
+	if provider == nil {
+		ctx.JSON(http.StatusNotFound, api.Fail(api.WithMessage("Login provider not found")))
+		return
+	}
+
+	// state 防止 CSRF，nonce 绑定 ID token 防止重放
+	state, err := passport.RandomString()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to login")))
+		return
+	}
+	nonce, err := passport.RandomString()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to login")))
+		return
+	}
+	authURL := provider.AuthCodeURL(state, nonce)
+	if authURL == "" {
+		ctx.JSON(http.StatusBadGateway, api.Fail(api.WithMessage("Login provider is unavailable")))
+		return
+	}
+
 	session := sessions.Default(ctx)
 	session.Set(constants.RedirectURIKey, ctx.Query("redirect_uri"))
+	session.Set(constants.OAuthStateKey, state)
+	session.Set(constants.OAuthNonceKey, nonce)
+	session.Set(constants.OAuthProviderKey, provider.Id())
 	_ = session.Save()
-	ctx.Redirect(http.StatusFound, passport.Redirect("state"))
+	ctx.Redirect(http.StatusFound, authURL)
 }
 
 func (a *authHandler) LoginCallback(ctx *gin.Context) {
+	if !requireAuthMethod(ctx, AuthMethodPassport) {
+		return
+	}
 	session := sessions.Default(ctx)
 	redirectURI := "/"
-	if r := session.Get(constants.RedirectURIKey); r != nil {
-		redirectURI = r.(string)
+	if r, _ := session.Get(constants.RedirectURIKey).(string); r != "" {
+		redirectURI = r
 	}
+	state, _ := session.Get(constants.OAuthStateKey).(string)
+	nonce, _ := session.Get(constants.OAuthNonceKey).(string)
+	providerId, _ := session.Get(constants.OAuthProviderKey).(string)
+	// state 只能使用一次
 	session.Delete(constants.RedirectURIKey)
+	session.Delete(constants.OAuthStateKey)
+	session.Delete(constants.OAuthNonceKey)
+	session.Delete(constants.OAuthProviderKey)
+	_ = session.Save()
+
 	code := ctx.Query("code")
 	if code == "" {
-		_ = session.Save()
 		ctx.Redirect(http.StatusFound, redirectURI)
 		return
 	}
-
-	token, err := passport.Exchange(context.Background(), code)
-	if err != nil {
-		_ = session.Save()
-		ctx.Redirect(http.StatusFound, redirectURI)
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(ctx.Query("state"))) != 1 {
+		ctx.JSON(http.StatusBadRequest, api.Fail(api.WithMessage("Invalid login state")))
 		return
 	}
-
-	info, err := passport.GetUserInfo(token)
-	if err != nil || info.Uuid == "" {
-		_ = session.Save()
-		ctx.JSON(http.StatusBadRequest, err)
+	provider := passport.Find(providerId)
+	if provider == nil || providerId == "" {
+		ctx.JSON(http.StatusBadRequest, api.Fail(api.WithMessage("Login provider not found")))
 		return
 	}
 
-	var u entity.User
-	if tx := database.DB(context.Background()).Where("uuid=?", info.Uuid).Find(&u); tx.Error != nil && errors.Is(tx.Error, gorm.ErrRecordNotFound) {
-		_ = session.Save()
-		ctx.Redirect(http.StatusFound, redirectURI)
+	identity, err := provider.Exchange(ctx, code, nonce)
+	if err != nil {
+		log.Printf("login with %s error: %v", providerId, err)
+		ctx.JSON(http.StatusBadRequest, api.Fail(api.WithMessage("Failed to login")))
 		return
 	}
 
-	u.Uuid = info.Uuid
-	u.Avatar = info.Avatar
-	u.Email = info.Email
-	u.Name = info.Nickname
-
-	if tx := database.DB(context.Background()).Save(&u); tx.Error != nil {
-		_ = session.Save()
+	u, err := saveIdentity(ctx, identity)
+	if err != nil {
+		log.Printf("save %s identity error: %v", providerId, err)
 		ctx.Redirect(http.StatusFound, redirectURI)
 		return
 	}
 
 	// 设置Session
 	session.Set(constants.UserIdKey, u.Id)
+	session.Set(constants.LoginProviderKey, provider.Id())
 	_ = session.Save()
 	ctx.Redirect(http.StatusFound, redirectURI)
 }
 
+// saveIdentity finds or creates the user of a provider identity and refreshes its profile
+func saveIdentity(ctx *gin.Context, identity *passport.Identity) (*entity.User, error) {
+	var u entity.User
+	err := database.DB(ctx).Transaction(func(tx *gorm.DB) error {
+		var ui entity.UserIdentity
+		err := tx.Preload("User").Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).First(&ui).Error
+		switch {
+		case err == nil && ui.User != nil:
+			u = *ui.User
+		case err == nil, errors.Is(err, gorm.ErrRecordNotFound):
+			// CodeEMO 登录的已有用户以 uuid 关联
+			if identity.Uuid != "" {
+				if err := tx.Where("uuid = ?", identity.Uuid).Find(&u).Error; err != nil {
+					return err
+				}
+			}
+			if u.Id == 0 {
+				u.Uuid = identity.Uuid
+				if u.Uuid == "" {
+					u.Uuid = uuid.New().String()
+				}
+			}
+		default:
+			return err
+		}
+
+		u.Name = identity.Name
+		if u.Name == "" {
+			u.Name = identity.Subject
+		}
+		u.Email = identity.Email
+		u.EmailVerified = false
+		if identity.Email != "" && identity.EmailVerified {
+			// 邮箱已被其他账号验证时保存为未验证，邮箱登录不会登录到两个账号
+			var count int64
+			if err := tx.Model(&entity.User{}).Where("email = ? AND email_verified = ? AND id <> ?", identity.Email, true, u.Id).Count(&count).Error; err != nil {
+				return err
+			}
+			u.EmailVerified = count == 0
+		}
+		u.Avatar = identity.Avatar
+		if err := tx.Save(&u).Error; err != nil {
+			return err
+		}
+
+		if ui.Id == 0 {
+			ui = entity.UserIdentity{UserId: u.Id, Provider: identity.Provider, Subject: identity.Subject}
+			return tx.Create(&ui).Error
+		}
+		if ui.UserId != u.Id {
+			return tx.Model(&ui).Update("user_id", u.Id).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+}
+
 func (a *authHandler) Logout(ctx *gin.Context) {
 	r := ctx.Query("redirect_uri")
 	if r == "" {
@@ -88,10 +191,20 @@ func (a *authHandler) Logout(ctx *gin.Context) {
 		r = ctx.Request.URL.String()
 	}
 	session := sessions.Default(ctx)
+	providerId, _ := session.Get(constants.LoginProviderKey).(string)
 	session.Clear()
 	_ = session.Save()
 
-	ctx.Redirect(http.StatusFound, passport.Logout(r))
+	// 使用第三方服务登录时同时退出该服务，内置账号只需要清除本地会话
+	if providerId != "" && config.GetConfig().AuthEnabled(AuthMethodPassport) {
+		if provider := passport.Find(providerId); provider != nil {
+			if logoutURL := provider.LogoutURL(ctx, r); logoutURL != "" {
+				ctx.Redirect(http.StatusFound, logoutURL)
+				return
+			}
+		}
+	}
+	ctx.Redirect(http.StatusFound, r)
 }
 
 func (a *authHandler) UserCenter(ctx *gin.Context) {
@@ -100,10 +213,19 @@ func (a *authHandler) UserCenter(ctx *gin.Context) {
 		redirectURI = r
 	}
 
-	ctx.Redirect(http.StatusFound, passport.UserCenter(redirectURI))
+	providerId, _ := sessions.Default(ctx).Get(constants.LoginProviderKey).(string)
+	if providerId != "" && config.GetConfig().AuthEnabled(AuthMethodPassport) {
+		if provider := passport.Find(providerId); provider != nil {
+			if centerURL := provider.UserCenterURL(redirectURI); centerURL != "" {
+				ctx.Redirect(http.StatusFound, centerURL)
+				return
+			}
+		}
+	}
+	ctx.Redirect(http.StatusFound, redirectURI)
 }
 
 func (a *authHandler) Info(ctx *gin.Context) {
 	user := auth.MustGetUserFromCtx(ctx)
-	ctx.JSON(http.StatusOK, api.Okay(api.WithData(user)))
+	ctx.JSON(http.StatusOK, api.Okay(api.WithData(&UserInfo{User: user, Admin: auth.IsAdmin(user)})))
 }
@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"context"
+	"meeting/internal/migration"
+	"meeting/internal/model/entity"
+	"meeting/pkg/database"
+	"meeting/pkg/passport"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库只存在于一个连接中
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	database.UseDB(db)
+	if _, err = migration.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestContext() *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	return c
+}
+
+func TestSaveIdentityKeepsVerifiedEmailUnique(t *testing.T) {
+	setupDB(t)
+	owner := entity.User{Uuid: "owner", Name: "owner", Email: "a@x.io", EmailVerified: true}
+	if err := database.DB(context.Background()).Create(&owner).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	identity := &passport.Identity{Provider: "idp", Subject: "1", Name: "other", Email: "a@x.io", EmailVerified: true}
+	u, err := saveIdentity(newTestContext(), identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Id == owner.Id || u.EmailVerified {
+		t.Fatal("second account was created with the verified email of another account")
+	}
+
+	// 已验证邮箱的账号再次登录时保持已验证
+	identity = &passport.Identity{Provider: "idp", Subject: "2", Uuid: owner.Uuid, Name: "owner", Email: "a@x.io", EmailVerified: true}
+	if u, err = saveIdentity(newTestContext(), identity); err != nil {
+		t.Fatal(err)
+	}
+	if u.Id != owner.Id || !u.EmailVerified {
+		t.Fatalf("owner %d verified %v, want %d verified", u.Id, u.EmailVerified, owner.Id)
+	}
+
+	var verified int64
+	database.DB(context.Background()).Model(&entity.User{}).Where("email = ? AND email_verified = ?", "a@x.io", true).Count(&verified)
+	if verified != 1 {
+		t.Fatalf("%d accounts verified the email, want 1", verified)
+	}
+}
@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"meeting/internal/model/entity"
+	"meeting/pkg/api"
+	"meeting/pkg/config"
+	"meeting/pkg/database"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RecordingInfo represents a server side recording of a room and its files
+type RecordingInfo struct {
+	Id        string                  `json:"id"`
+	Status    string                  `json:"status"`
+	StartedBy string                  `json:"startedBy"`
+	StartedAt time.Time               `json:"startedAt"`
+	StoppedAt *time.Time              `json:"stoppedAt,omitempty"`
+	Size      int64                   `json:"size"`
+	Files     []*entity.RecordingFile `json:"files"`
+}
+
+func newRecordingInfo(r *entity.Recording) *RecordingInfo {
+	info := &RecordingInfo{
+		Id:        r.Uuid,
+		Status:    r.Status,
+		StartedAt: r.StartedAt,
+		StoppedAt: r.StoppedAt,
+		Size:      r.Size,
+		Files:     r.Files,
+	}
+	if r.Starter != nil {
+		info.StartedBy = r.Starter.Name
+	}
+	if info.Files == nil {
+		info.Files = make([]*entity.RecordingFile, 0)
+	}
+
+	return info
+}
+
+// findRecording loads the recording in the path, writing the error response if not found
+func findRecording(c *gin.Context, role entity.Role) (*entity.Room, *entity.Recording, bool) {
+	room, ok := findManagedRoom(c, role)
+	if !ok {
+		return nil, nil, false
+	}
+
+	var recording entity.Recording
+	err := database.DB(c).Preload("Files", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Where("uuid = ? AND room_id = ?", c.Param("recordingId"), room.Id).First(&recording).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, api.Fail(api.WithMessage("Recording not found")))
+		return nil, nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to get recording")))
+		return nil, nil, false
+	}
+
+	return room, &recording, true
+}
+
+// findFinishedRecording is findRecording for downloads, files are incomplete while recording
+func findFinishedRecording(c *gin.Context) (*entity.Room, *entity.Recording, bool) {
+	room, recording, ok := findRecording(c, entity.RoleModerator)
+	if !ok {
+		return nil, nil, false
+	}
+	if !recording.IsFinished() {
+		c.JSON(http.StatusConflict, api.Fail(api.WithMessage("Recording is still in progress")))
+		return nil, nil, false
+	}
+
+	return room, recording, true
+}
+
+// GetRecordings returns the latest recordings of a room (moderators only)
+func GetRecordings(c *gin.Context) {
+	room, ok := findManagedRoom(c, entity.RoleModerator)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	limit = min(max(limit, 1), 100)
+	var recordings []*entity.Recording
+	if err := database.DB(c).Preload("Starter").Preload("Files", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Where("room_id = ?", room.Id).Order("id DESC").Limit(limit).Find(&recordings).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to get recordings")))
+		return
+	}
+
+	infos := make([]*RecordingInfo, 0, len(recordings))
+	for _, r := range recordings {
+		infos = append(infos, newRecordingInfo(r))
+	}
+	c.JSON(http.StatusOK, api.Okay(api.WithData(infos)))
+}
+
+// DownloadRecordingFile sends a single file of a finished recording (moderators only)
+func DownloadRecordingFile(c *gin.Context) {
+	room, recording, ok := findFinishedRecording(c)
+	if !ok {
+		return
+	}
+
+	for _, f := range recording.Files {
+		if strconv.FormatUint(uint64(f.Id), 10) == c.Param("fileId") {
+			c.FileAttachment(filepath.Join(recording.Dir(config.GetConfig().Recording.Dir, room.Uuid), f.Name), f.Name)
+			return
+		}
+	}
+	c.JSON(http.StatusNotFound, api.Fail(api.WithMessage("File not found")))
+}
+
+// DownloadRecording sends every file of a finished recording as a zip archive (moderators only)
+func DownloadRecording(c *gin.Context) {
+	room, recording, ok := findFinishedRecording(c)
+	if !ok {
+		return
+	}
+
+	dir := recording.Dir(config.GetConfig().Recording.Dir, room.Uuid)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, recording.Uuid))
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+
+	w := zip.NewWriter(c.Writer)
+	defer w.Close()
+	for _, f := range recording.Files {
+		// 音视频已经压缩过，直接存储
+		if err := addZipFile(w, filepath.Join(dir, f.Name), f.Name); err != nil {
+			log.Printf("add %s of recording %s to zip error: %v", f.Name, recording.Uuid, err)
+			return
+		}
+	}
+}
+
+func addZipFile(w *zip.Writer, path, name string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	out, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, file)
+	return err
+}
+
+// DeleteRecording removes a finished recording and its files (host only)
+func DeleteRecording(c *gin.Context) {
+	room, recording, ok := findRecording(c, entity.RoleHost)
+	if !ok {
+		return
+	}
+	if !recording.IsFinished() {
+		c.JSON(http.StatusConflict, api.Fail(api.WithMessage("Stop the recording before deleting it")))
+		return
+	}
+
+	if err := os.RemoveAll(recording.Dir(config.GetConfig().Recording.Dir, room.Uuid)); err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to delete recording files")))
+		return
+	}
+	err := database.DB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("recording_id = ?", recording.Id).Delete(&entity.RecordingFile{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(recording).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to delete recording")))
+		return
+	}
+
+	c.JSON(http.StatusOK, api.Okay())
+}
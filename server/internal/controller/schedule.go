@@ -0,0 +1,290 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"meeting/internal/model/entity"
+	"meeting/internal/utility/auth"
+	"meeting/internal/utility/ical"
+	"meeting/pkg/api"
+	"meeting/pkg/config"
+	"meeting/pkg/database"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ScheduleRequest represents the schedule of a meeting, an empty StartAt clears the schedule
+type ScheduleRequest struct {
+	StartAt         *time.Time `json:"startAt,omitempty"`
+	EndAt           *time.Time `json:"endAt,omitempty"`
+	Recurrence      string     `json:"recurrence,omitempty" binding:"omitempty,oneof=daily weekly"`
+	RecurrenceUntil *time.Time `json:"recurrenceUntil,omitempty"`
+	TimeZone        string     `json:"timeZone,omitempty"` // IANA 时区，例如 Asia/Shanghai
+}
+
+// UpdateInviteesRequest represents the request structure for replacing the invitee list
+type UpdateInviteesRequest struct {
+	UserIds []uint `json:"userIds"`
+}
+
+// InviteeInfo represents an invited user
+type InviteeInfo struct {
+	UserId   uint   `json:"userId"`
+	UserName string `json:"userName"`
+	Email    string `json:"email"`
+	Avatar   string `json:"avatar"`
+}
+
+// validate checks the schedule is consistent
+func (req *ScheduleRequest) validate() error {
+	if req.StartAt == nil {
+		if req.EndAt != nil || req.Recurrence != "" || req.RecurrenceUntil != nil || req.TimeZone != "" {
+			return errors.New("startAt is required")
+		}
+		return nil
+	}
+	if req.TimeZone != "" {
+		if _, err := time.LoadLocation(req.TimeZone); err != nil {
+			return errors.New("unknown timeZone")
+		}
+	}
+	if req.EndAt != nil && !req.EndAt.After(*req.StartAt) {
+		return errors.New("endAt must be after startAt")
+	}
+	if req.Recurrence != "" && req.EndAt != nil {
+		days := 1
+		if req.Recurrence == entity.RecurrenceWeekly {
+			days = 7
+		}
+		if req.EndAt.After(req.StartAt.AddDate(0, 0, days)) {
+			return errors.New("meeting is longer than its recurrence interval")
+		}
+	}
+	if req.RecurrenceUntil != nil && req.Recurrence == "" {
+		return errors.New("recurrenceUntil requires recurrence")
+	}
+	if req.RecurrenceUntil != nil && req.RecurrenceUntil.Before(*req.StartAt) {
+		return errors.New("recurrenceUntil must not be before startAt")
+	}
+
+	return nil
+}
+
+// apply copies the schedule to the room
+func (req *ScheduleRequest) apply(room *entity.Room) {
+	room.StartAt = req.StartAt
+	room.EndAt = req.EndAt
+	room.Recurrence = req.Recurrence
+	room.RecurrenceUntil = req.RecurrenceUntil
+	room.TimeZone = req.TimeZone
+}
+
+// earlyJoinGrace returns how long before the start a scheduled meeting can be joined
+func earlyJoinGrace() time.Duration {
+	return time.Duration(config.GetConfig().Schedule.EarlyJoinMinutes) * time.Minute
+}
+
+// meetingURL returns the link of the meeting page
+func meetingURL(room *entity.Room) string {
+	return strings.TrimRight(config.GetConfig().App.URL, "/") + "/meeting/" + room.Uuid
+}
+
+// findManagedRoom loads the room of the request and checks the current user has one of the roles
+func findManagedRoom(c *gin.Context, role entity.Role) (*entity.Room, bool) {
+	user := auth.MustGetUserFromCtx(c)
+
+	var room entity.Room
+	if err := database.DB(c).Where("uuid = ?", c.Param("id")).First(&room).Error; err != nil {
+		c.JSON(http.StatusNotFound, api.Fail(api.WithMessage("Room not found")))
+		return nil, false
+	}
+
+	var roomUser entity.RoomUser
+	if err := database.DB(c).Where("room_id = ? AND user_id = ?", room.Id, user.Id).First(&roomUser).Error; err != nil || !roomUser.HasRole(role) {
+		c.JSON(http.StatusForbidden, api.Fail(api.WithMessage("Only room admin can manage the room")))
+		return nil, false
+	}
+
+	return &room, true
+}
+
+// UpdateRoomSchedule sets or clears the schedule of a room (admin only)
+func UpdateRoomSchedule(c *gin.Context) {
+	var req ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, api.Fail(api.WithMessage(err.Error())))
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, api.Fail(api.WithMessage(err.Error())))
+		return
+	}
+
+	room, ok := findManagedRoom(c, entity.RoleHost)
+	if !ok {
+		return
+	}
+
+	req.apply(room)
+	if err := database.DB(c).Model(room).Select("start_at", "end_at", "recurrence", "recurrence_until", "time_zone").Updates(room).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to update schedule")))
+		return
+	}
+
+	c.JSON(http.StatusOK, api.Okay(api.WithData(room)))
+}
+
+// GetRoomInvitees returns the invitees of a room (admin only)
+func GetRoomInvitees(c *gin.Context) {
+	room, ok := findManagedRoom(c, entity.RoleHost)
+	if !ok {
+		return
+	}
+
+	var invitees = make([]entity.RoomInvitee, 0)
+	if err := database.DB(c).Preload("User").Where("room_id = ?", room.Id).Find(&invitees).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to fetch invitees")))
+		return
+	}
+
+	c.JSON(http.StatusOK, api.Okay(api.WithData(inviteeInfos(invitees))))
+}
+
+// UpdateRoomInvitees replaces the invitees of a room, invited users become room members (admin only)
+func UpdateRoomInvitees(c *gin.Context) {
+	var req UpdateInviteesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, api.Fail(api.WithMessage(err.Error())))
+		return
+	}
+
+	room, ok := findManagedRoom(c, entity.RoleHost)
+	if !ok {
+		return
+	}
+
+	var users = make([]entity.User, 0)
+	if len(req.UserIds) > 0 {
+		if err := database.DB(c).Where("id IN ?", req.UserIds).Find(&users).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to fetch users")))
+			return
+		}
+	}
+	if len(users) != len(uniqueIds(req.UserIds)) {
+		c.JSON(http.StatusBadRequest, api.Fail(api.WithMessage("User not found")))
+		return
+	}
+
+	err := database.DB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("room_id = ?", room.Id).Delete(&entity.RoomInvitee{}).Error; err != nil {
+			return err
+		}
+		for _, u := range users {
+			if err := tx.Create(&entity.RoomInvitee{RoomId: room.Id, UserId: u.Id}).Error; err != nil {
+				return err
+			}
+
+			// 受邀用户自动成为房间成员，无需输入密码
+			var roomUser entity.RoomUser
+			if err := tx.Where("room_id = ? AND user_id = ?", room.Id, u.Id).Find(&roomUser).Error; err != nil {
+				return err
+			}
+			if roomUser.Id == 0 {
+				roomUser = entity.RoomUser{RoomId: room.Id, UserId: u.Id, Role: entity.RoleUser}
+				if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&roomUser).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to update invitees")))
+		return
+	}
+
+	invitees := make([]entity.RoomInvitee, len(users))
+	for i := range users {
+		invitees[i] = entity.RoomInvitee{RoomId: room.Id, UserId: users[i].Id, User: &users[i]}
+	}
+
+	c.JSON(http.StatusOK, api.Okay(api.WithData(inviteeInfos(invitees))))
+}
+
+// GetRoomCalendar exports a scheduled meeting as an iCalendar file (members only)
+func GetRoomCalendar(c *gin.Context) {
+	user := auth.MustGetUserFromCtx(c)
+
+	var room entity.Room
+	if err := database.DB(c).Where("uuid = ?", c.Param("id")).First(&room).Error; err != nil {
+		c.JSON(http.StatusNotFound, api.Fail(api.WithMessage("Room not found")))
+		return
+	}
+
+	var roomUser entity.RoomUser
+	if err := database.DB(c).Where("room_id = ? AND user_id = ?", room.Id, user.Id).First(&roomUser).Error; err != nil || roomUser.IsBlocked() {
+		c.JSON(http.StatusForbidden, api.Fail(api.WithMessage("Access denied")))
+		return
+	}
+
+	if !room.IsScheduled() {
+		c.JSON(http.StatusBadRequest, api.Fail(api.WithMessage("Room is not scheduled")))
+		return
+	}
+
+	var invitees = make([]entity.RoomInvitee, 0)
+	database.DB(c).Preload("User").Where("room_id = ?", room.Id).Find(&invitees)
+
+	event := ical.Event{
+		Uid:       room.Uuid + "@met",
+		Summary:   room.Name,
+		URL:       meetingURL(&room),
+		Start:     *room.StartAt,
+		Frequency: strings.ToUpper(room.Recurrence),
+		Until:     room.RecurrenceUntil,
+	}
+	if room.TimeZone != "" {
+		event.Location = room.Location()
+	}
+	event.Description = event.URL
+	if room.EndAt != nil {
+		event.End = *room.EndAt
+	}
+	for _, invitee := range invitees {
+		if invitee.User != nil && invitee.User.Email != "" {
+			event.Attendees = append(event.Attendees, ical.Attendee{Name: invitee.User.Name, Email: invitee.User.Email})
+		}
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.ics"`, room.Uuid))
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", ical.Calendar(event))
+}
+
+func inviteeInfos(invitees []entity.RoomInvitee) []InviteeInfo {
+	infos := make([]InviteeInfo, 0, len(invitees))
+	for _, invitee := range invitees {
+		info := InviteeInfo{UserId: invitee.UserId}
+		if invitee.User != nil {
+			info.UserName = invitee.User.Name
+			info.Email = invitee.User.Email
+			info.Avatar = invitee.User.Avatar
+		}
+		infos = append(infos, info)
+	}
+
+	return infos
+}
+
+func uniqueIds(ids []uint) map[uint]struct{} {
+	m := make(map[uint]struct{}, len(ids))
+	for _, id := range ids {
+		m[id] = struct{}{}
+	}
+
+	return m
+}
@@ -0,0 +1,274 @@
+package controller
+
+import (
+	"errors"
+	"meeting/internal/model/entity"
+	"meeting/internal/utility/auth"
+	"meeting/pkg/api"
+	"meeting/pkg/database"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CreateTokenRequest represents the request structure for creating an API token
+type CreateTokenRequest struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// TokenInfo represents an API token, Token is only returned once when the token is created
+type TokenInfo struct {
+	Id         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	Active     bool       `json:"active"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	Token      string     `json:"token,omitempty"`
+}
+
+// CreateServiceAccountRequest represents the request structure for creating a service account
+type CreateServiceAccountRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// ServiceAccountInfo represents a service account owned by the current user
+type ServiceAccountInfo struct {
+	Uuid      string    `json:"uuid"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func newTokenInfo(token *entity.ApiToken) *TokenInfo {
+	return &TokenInfo{
+		Id:         token.Id,
+		Name:       token.Name,
+		Prefix:     token.Prefix,
+		Scopes:     token.ScopeList(),
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+		RevokedAt:  token.RevokedAt,
+		Active:     token.IsActive(time.Now()),
+		CreatedAt:  token.CreatedAt,
+	}
+}
+
+// GetTokens returns the personal access tokens of the current user
+func GetTokens(c *gin.Context) {
+	listTokens(c, auth.MustGetUserFromCtx(c))
+}
+
+// CreateToken creates a personal access token acting as the current user
+func CreateToken(c *gin.Context) {
+	user := auth.MustGetUserFromCtx(c)
+	createToken(c, user, user)
+}
+
+// RevokeToken revokes a personal access token of the current user
+func RevokeToken(c *gin.Context) {
+	revokeToken(c, auth.MustGetUserFromCtx(c), c.Param("id"))
+}
+
+// GetServiceAccounts returns the service accounts owned by the current user
+func GetServiceAccounts(c *gin.Context) {
+	user := auth.MustGetUserFromCtx(c)
+
+	var bots []*entity.User
+	if err := database.DB(c).Where("bot = ? AND owner_id = ?", true, user.Id).Order("id").Find(&bots).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to get service accounts")))
+		return
+	}
+
+	accounts := make([]*ServiceAccountInfo, 0, len(bots))
+	for _, bot := range bots {
+		accounts = append(accounts, &ServiceAccountInfo{Uuid: bot.Uuid, Name: bot.Name, CreatedAt: bot.CreatedAt})
+	}
+	c.JSON(http.StatusOK, api.Okay(api.WithData(accounts)))
+}
+
+// CreateServiceAccount creates a bot user owned by the current user, it can only sign in with tokens
+func CreateServiceAccount(c *gin.Context) {
+	var req CreateServiceAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, api.Fail(api.WithMessage(err.Error())))
+		return
+	}
+	user := auth.MustGetUserFromCtx(c)
+
+	bot := &entity.User{
+		Uuid:    uuid.New().String(),
+		Name:    req.Name,
+		Bot:     true,
+		OwnerId: &user.Id,
+	}
+	if err := database.DB(c).Create(bot).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to create service account")))
+		return
+	}
+
+	c.JSON(http.StatusOK, api.Okay(api.WithData(&ServiceAccountInfo{Uuid: bot.Uuid, Name: bot.Name, CreatedAt: bot.CreatedAt})))
+}
+
+// DeleteServiceAccount deletes a service account and revokes all of its tokens
+func DeleteServiceAccount(c *gin.Context) {
+	bot, ok := findServiceAccount(c)
+	if !ok {
+		return
+	}
+
+	err := database.DB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&entity.ApiToken{}).Where("user_id = ? AND revoked_at IS NULL", bot.Id).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Delete(bot).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to delete service account")))
+		return
+	}
+
+	c.JSON(http.StatusOK, api.Okay(api.WithMessage("Service account deleted")))
+}
+
+// GetServiceAccountTokens returns the tokens of a service account
+func GetServiceAccountTokens(c *gin.Context) {
+	bot, ok := findServiceAccount(c)
+	if !ok {
+		return
+	}
+
+	listTokens(c, bot)
+}
+
+// CreateServiceAccountToken creates a token acting as a service account
+func CreateServiceAccountToken(c *gin.Context) {
+	bot, ok := findServiceAccount(c)
+	if !ok {
+		return
+	}
+
+	createToken(c, bot, auth.MustGetUserFromCtx(c))
+}
+
+// RevokeServiceAccountToken revokes a token of a service account
+func RevokeServiceAccountToken(c *gin.Context) {
+	bot, ok := findServiceAccount(c)
+	if !ok {
+		return
+	}
+
+	revokeToken(c, bot, c.Param("tokenId"))
+}
+
+// findServiceAccount finds the service account in the path owned by the current user, writing the error response if not found
+func findServiceAccount(c *gin.Context) (*entity.User, bool) {
+	user := auth.MustGetUserFromCtx(c)
+
+	var bot entity.User
+	err := database.DB(c).Where("uuid = ? AND bot = ? AND owner_id = ?", c.Param("id"), true, user.Id).First(&bot).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, api.Fail(api.WithMessage("Service account not found")))
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to get service account")))
+		return nil, false
+	}
+
+	return &bot, true
+}
+
+func listTokens(c *gin.Context, user *entity.User) {
+	var tokens []*entity.ApiToken
+	if err := database.DB(c).Where("user_id = ?", user.Id).Order("id DESC").Find(&tokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to get tokens")))
+		return
+	}
+
+	infos := make([]*TokenInfo, 0, len(tokens))
+	for _, token := range tokens {
+		infos = append(infos, newTokenInfo(token))
+	}
+	c.JSON(http.StatusOK, api.Okay(api.WithData(infos)))
+}
+
+// createToken issues a token acting as user, the plain token is only returned in this response
+func createToken(c *gin.Context, user, creator *entity.User) {
+	var req CreateTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, api.Fail(api.WithMessage(err.Error())))
+		return
+	}
+	scopes, ok := entity.ParseScopes(req.Scopes)
+	if !ok {
+		c.JSON(http.StatusBadRequest, api.Fail(api.WithMessage("Invalid scope")))
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, api.Fail(api.WithMessage("expiresAt must be in the future")))
+		return
+	}
+
+	plain, hash, err := entity.NewApiToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to create token")))
+		return
+	}
+	token := &entity.ApiToken{
+		UserId:    user.Id,
+		CreatedBy: creator.Id,
+		Name:      req.Name,
+		Prefix:    plain[:len(entity.ApiTokenPrefix)+4],
+		TokenHash: hash,
+		ExpiresAt: req.ExpiresAt,
+	}
+	token.SetScopes(scopes)
+	if err := database.DB(c).Create(token).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to create token")))
+		return
+	}
+
+	info := newTokenInfo(token)
+	info.Token = plain
+	c.JSON(http.StatusOK, api.Okay(api.WithData(info)))
+}
+
+func revokeToken(c *gin.Context, user *entity.User, id string) {
+	tokenId, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.Fail(api.WithMessage("Invalid token id")))
+		return
+	}
+
+	var token entity.ApiToken
+	err = database.DB(c).Where("id = ? AND user_id = ?", tokenId, user.Id).First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, api.Fail(api.WithMessage("Token not found")))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to revoke token")))
+		return
+	}
+
+	if token.RevokedAt == nil {
+		now := time.Now()
+		token.RevokedAt = &now
+		if err := database.DB(c).Model(&token).Update("revoked_at", now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to revoke token")))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, api.Okay(api.WithData(newTokenInfo(&token))))
+}
@@ -0,0 +1,299 @@
+package controller
+
+import (
+	"errors"
+	"meeting/internal/model/entity"
+	"meeting/internal/service/webhook"
+	"meeting/internal/utility/auth"
+	"meeting/pkg/api"
+	"meeting/pkg/database"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CreateWebhookRequest represents the request structure for creating a webhook, empty Events subscribes to all events
+type CreateWebhookRequest struct {
+	Url    string   `json:"url" binding:"required,max=500"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active,omitempty"`
+}
+
+// UpdateWebhookRequest represents the request structure for updating a webhook, RotateSecret returns a new secret
+type UpdateWebhookRequest struct {
+	Url          string    `json:"url" binding:"max=500"`
+	Events       *[]string `json:"events,omitempty"`
+	Active       *bool     `json:"active,omitempty"`
+	RotateSecret bool      `json:"rotateSecret"`
+}
+
+// WebhookInfo represents a webhook, Secret is only returned when it is created or rotated
+type WebhookInfo struct {
+	Id        uint      `json:"id"`
+	Url       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Secret    string    `json:"secret,omitempty"`
+}
+
+// ModerationData is the data of the participant.kicked and participant.blocked webhook events
+type ModerationData struct {
+	User *webhook.Participant `json:"user"`
+	By   *webhook.Participant `json:"by"`
+}
+
+func newWebhookInfo(w *entity.Webhook) *WebhookInfo {
+	return &WebhookInfo{
+		Id:        w.Id,
+		Url:       w.Url,
+		Events:    w.EventList(),
+		Active:    w.Active,
+		CreatedAt: w.CreatedAt,
+		UpdatedAt: w.UpdatedAt,
+	}
+}
+
+// dispatchModeration sends the webhook event of a user kicked or blocked by a moderator
+func dispatchModeration(room *entity.Room, event entity.WebhookEvent, target, by *entity.User) {
+	webhook.Dispatch(room.Id, &webhook.Event{
+		Type: event,
+		Room: webhook.Room{Id: room.Uuid, Name: room.Name},
+		Data: &ModerationData{
+			User: &webhook.Participant{Id: target.Uuid, Name: target.Name, Avatar: target.Avatar},
+			By:   &webhook.Participant{Id: by.Uuid, Name: by.Name, Avatar: by.Avatar},
+		},
+	})
+}
+
+// webhookRoom returns the room the webhooks of the request belong to, nil for the global webhooks,
+// room webhooks are managed by the host and global webhooks by the administrators
+func webhookRoom(c *gin.Context) (roomId *uint, ok bool) {
+	if c.Param("id") == "" {
+		return nil, true
+	}
+	room, ok := findManagedRoom(c, entity.RoleHost)
+	if !ok {
+		return nil, false
+	}
+
+	return &room.Id, true
+}
+
+// findWebhook loads the webhook in the path, writing the error response if not found
+func findWebhook(c *gin.Context) (*entity.Webhook, bool) {
+	roomId, ok := webhookRoom(c)
+	if !ok {
+		return nil, false
+	}
+
+	var w entity.Webhook
+	query := database.DB(c).Where("id = ?", c.Param("webhookId"))
+	if roomId == nil {
+		query = query.Where("room_id IS NULL")
+	} else {
+		query = query.Where("room_id = ?", *roomId)
+	}
+	err := query.First(&w).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, api.Fail(api.WithMessage("Webhook not found")))
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to get webhook")))
+		return nil, false
+	}
+
+	return &w, true
+}
+
+func validWebhookURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// GetWebhooks returns the webhooks of a room, or the global webhooks
+func GetWebhooks(c *gin.Context) {
+	roomId, ok := webhookRoom(c)
+	if !ok {
+		return
+	}
+
+	var webhooks []*entity.Webhook
+	query := database.DB(c).Order("id")
+	if roomId == nil {
+		query = query.Where("room_id IS NULL")
+	} else {
+		query = query.Where("room_id = ?", *roomId)
+	}
+	if err := query.Find(&webhooks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to get webhooks")))
+		return
+	}
+
+	infos := make([]*WebhookInfo, 0, len(webhooks))
+	for _, w := range webhooks {
+		infos = append(infos, newWebhookInfo(w))
+	}
+	c.JSON(http.StatusOK, api.Okay(api.WithData(infos)))
+}
+
+// CreateWebhook subscribes a url to the events of a room, or of all rooms, the secret is only returned once
+func CreateWebhook(c *gin.Context) {
+	var req CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, api.Fail(api.WithMessage(err.Error())))
+		return
+	}
+	if !validWebhookURL(req.Url) {
+		c.JSON(http.StatusBadRequest, api.Fail(api.WithMessage("url must be an http or https url")))
+		return
+	}
+	events, ok := entity.ParseWebhookEvents(req.Events)
+	if !ok {
+		c.JSON(http.StatusBadRequest, api.Fail(api.WithMessage("Invalid webhook event")))
+		return
+	}
+	roomId, ok := webhookRoom(c)
+	if !ok {
+		return
+	}
+
+	secret, err := entity.NewWebhookSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to create webhook")))
+		return
+	}
+	w := &entity.Webhook{
+		RoomId:    roomId,
+		Url:       req.Url,
+		Secret:    secret,
+		Active:    req.Active == nil || *req.Active,
+		CreatedBy: auth.MustGetUserFromCtx(c).Id,
+	}
+	w.SetEvents(events)
+	if err := database.DB(c).Create(w).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to create webhook")))
+		return
+	}
+	// 零值不会写入，Active 使用了数据库默认值 true
+	if !w.Active {
+		if err := database.DB(c).Model(w).Update("active", false).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to create webhook")))
+			return
+		}
+	}
+
+	info := newWebhookInfo(w)
+	info.Secret = w.Secret
+	c.JSON(http.StatusOK, api.Okay(api.WithData(info)))
+}
+
+// UpdateWebhook changes the url, events or state of a webhook and optionally rotates its secret
+func UpdateWebhook(c *gin.Context) {
+	var req UpdateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, api.Fail(api.WithMessage(err.Error())))
+		return
+	}
+	w, ok := findWebhook(c)
+	if !ok {
+		return
+	}
+
+	updates := map[string]any{}
+	if req.Url != "" {
+		if !validWebhookURL(req.Url) {
+			c.JSON(http.StatusBadRequest, api.Fail(api.WithMessage("url must be an http or https url")))
+			return
+		}
+		w.Url = req.Url
+		updates["url"] = w.Url
+	}
+	if req.Events != nil {
+		events, ok := entity.ParseWebhookEvents(*req.Events)
+		if !ok {
+			c.JSON(http.StatusBadRequest, api.Fail(api.WithMessage("Invalid webhook event")))
+			return
+		}
+		w.SetEvents(events)
+		updates["events"] = w.Events
+	}
+	if req.Active != nil {
+		w.Active = *req.Active
+		updates["active"] = w.Active
+	}
+	if req.RotateSecret {
+		secret, err := entity.NewWebhookSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to update webhook")))
+			return
+		}
+		w.Secret = secret
+		updates["secret"] = w.Secret
+	}
+	if len(updates) > 0 {
+		if err := database.DB(c).Model(w).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to update webhook")))
+			return
+		}
+	}
+
+	info := newWebhookInfo(w)
+	if req.RotateSecret {
+		info.Secret = w.Secret
+	}
+	c.JSON(http.StatusOK, api.Okay(api.WithData(info)))
+}
+
+// DeleteWebhook removes a webhook and its delivery log
+func DeleteWebhook(c *gin.Context) {
+	w, ok := findWebhook(c)
+	if !ok {
+		return
+	}
+
+	err := database.DB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", w.Id).Delete(&entity.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(w).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to delete webhook")))
+		return
+	}
+
+	c.JSON(http.StatusOK, api.Okay(api.WithMessage("Webhook deleted")))
+}
+
+// GetWebhookDeliveries returns the latest deliveries of a webhook, filtered by status and paged by the before id
+func GetWebhookDeliveries(c *gin.Context) {
+	w, ok := findWebhook(c)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	limit = min(max(limit, 1), 200)
+	query := database.DB(c).Where("webhook_id = ?", w.Id).Order("id DESC").Limit(limit)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if before, err := strconv.ParseUint(c.Query("before"), 10, 64); err == nil {
+		query = query.Where("id < ?", before)
+	}
+
+	var deliveries []*entity.WebhookDelivery
+	if err := query.Find(&deliveries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to get deliveries")))
+		return
+	}
+
+	c.JSON(http.StatusOK, api.Okay(api.WithData(deliveries)))
+}
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"log"
 	"meeting/internal/model/entity"
 	"meeting/internal/service/webrtc"
@@ -9,18 +10,21 @@ import (
 	"meeting/pkg/api"
 	"meeting/pkg/database"
 	"net/http"
-	"sort"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"gorm.io/gorm/clause"
 )
 
 // CreateRoomRequest represents the request structure for creating a room
 type CreateRoomRequest struct {
-	Name     string `json:"name" binding:"required"`
-	Password string `json:"password,omitempty"` // 可选的房间密码
+	Name            string `json:"name" binding:"required"`
+	Password        string `json:"password,omitempty"`                                // 可选的房间密码
+	Mode            string `json:"mode,omitempty" binding:"omitempty,oneof=mesh sfu"` // 媒体转发模式
+	Lobby           bool   `json:"lobby,omitempty"`                                   // 是否开启等候室
+	ScheduleRequest        // 可选的会议时间
 }
 
 // CreateRoomResponse represents the response structure for creating a room
@@ -31,21 +35,34 @@ type CreateRoomResponse struct {
 
 // RoomListItem represents a room in the room list
 type RoomListItem struct {
-	Uuid        string    `json:"uuid"`
-	Name        string    `json:"name"`
-	CreatedAt   time.Time `json:"createdAt"`
-	HasPassword bool      `json:"hasPassword"` // 是否有密码
+	Uuid        string     `json:"uuid"`
+	Name        string     `json:"name"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	HasPassword bool       `json:"hasPassword"` // 是否有密码
+	StartAt     *time.Time `json:"startAt,omitempty"`
+	EndAt       *time.Time `json:"endAt,omitempty"`
+	Recurrence  string     `json:"recurrence,omitempty"`
+	TimeZone    string     `json:"timeZone,omitempty"`
 }
 
 // JoinRoomRequest represents the request structure for joining a room
 type JoinRoomRequest struct {
 	Password string `json:"password,omitempty"` // 房间密码
+	Code     string `json:"code,omitempty"`     // 邀请码，可以代替密码
+}
+
+// RoomInfoResponse represents a room without its secrets
+type RoomInfoResponse struct {
+	*entity.Room
+	HasPassword bool `json:"hasPassword"`
 }
 
 // UpdateRoomRequest represents the request structure for updating room info
 type UpdateRoomRequest struct {
 	Name     string `json:"name,omitempty"`
 	Password string `json:"password,omitempty"`
+	Mode     string `json:"mode,omitempty" binding:"omitempty,oneof=mesh sfu"`
+	Lobby    *bool  `json:"lobby,omitempty"`
 }
 
 // KickUserRequest represents the request structure for kicking a user
@@ -58,6 +75,12 @@ type BlockUserRequest struct {
 	UserId uint `json:"userId" binding:"required"`
 }
 
+// AdmitRequest represents the request structure for admitting a client waiting in the lobby
+type AdmitRequest struct {
+	ClientId string `json:"clientId" binding:"required"`
+	Admitted bool   `json:"admitted"`
+}
+
 // RoomMemberInfo represents room member information
 type RoomMemberInfo struct {
 	UserId   uint   `json:"userId"`
@@ -75,30 +98,42 @@ var upgrader = websocket.Upgrader{
 }
 
 func HandleWebSocket(c *gin.Context) {
-	var req webrtc.SignatureResponse
-	if err := c.ShouldBindQuery(&req); err != nil {
-		c.JSON(http.StatusBadRequest, api.Fail(api.WithMessage(err.Error())))
+	// 服务关闭中，让客户端连接其他节点
+	if webrtc.WsServer.Draining() {
+		c.JSON(http.StatusServiceUnavailable, api.Fail(api.WithMessage("Server is shutting down")))
 		return
 	}
 
-	if err := webrtc.ValidateSignature(req); err != nil {
+	// 加入令牌是成员身份的唯一来源
+	claims, err := webrtc.ValidateSignature(c.Query("token"))
+	if err != nil {
 		c.JSON(http.StatusUnauthorized, api.Fail(api.WithMessage(err.Error())))
 		return
 	}
 
-	r := webrtc.WsServer.StartRoom(req.RoomId)
+	var room entity.Room
+	if database.DB(c).Where("uuid=?", claims.RoomId).Find(&room); room.Id == 0 {
+		c.JSON(http.StatusNotFound, api.Fail(api.WithMessage("Room not found")))
+		return
+	}
+
+	r := webrtc.WsServer.StartRoom(claims.RoomId, webrtc.WithMode(room.Mode), webrtc.WithName(room.Name), webrtc.WithEntityId(room.Id))
+	r.SetLobby(room.Lobby)
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
+		webrtc.UpgradeFailures.Inc()
 		log.Println(err)
 		return
 	}
+	// 携带恢复令牌重连时接管断线前的会话，其他成员不会收到离开和加入
+	if session := webrtc.WsServer.FindSession(c.Query("resume")); session != nil && session.Id == claims.Subject && r.Resume(session, conn) {
+		go session.ReadPump()
+		go session.WritePump()
+		return
+	}
+
 	// Create client with Role and add to room
-	client := webrtc.NewClient(conn, &webrtc.User{
-		Id:     req.UserId,
-		Name:   req.Name,
-		Avatar: req.Avatar,
-		Role:   req.Role,
-	})
+	client := webrtc.NewClient(conn, claims.User())
 	r.RegisterClient(client)
 
 	// Start client message handling
@@ -114,7 +149,7 @@ func GetRoomInfo(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, api.Okay(api.WithData(room)))
+	c.JSON(http.StatusOK, api.Okay(api.WithData(&RoomInfoResponse{Room: &room, HasPassword: room.HasPassword()})))
 }
 
 // GetRoomList returns the list of rooms created by the current user
@@ -145,7 +180,11 @@ func GetRoomList(c *gin.Context) {
 			Uuid:        room.Uuid,
 			Name:        room.Name,
 			CreatedAt:   room.CreatedAt,
-			HasPassword: room.Password != "",
+			HasPassword: room.HasPassword(),
+			StartAt:     room.StartAt,
+			EndAt:       room.EndAt,
+			Recurrence:  room.Recurrence,
+			TimeZone:    room.TimeZone,
 		}
 	}
 
@@ -160,13 +199,28 @@ func CreateRoom(c *gin.Context) {
 		return
 	}
 
+	if err := req.ScheduleRequest.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, api.Fail(api.WithMessage(err.Error())))
+		return
+	}
+
 	user := auth.MustGetUserFromCtx(c)
 
 	var room entity.Room
 	if database.DB(context.Background()).Where("user_id=?", user.Id).Where("name", req.Name).Find(&room); room.Id == 0 {
 		room.Uuid = uuid.New().String()
 		room.Name = req.Name
-		room.Password = req.Password // 设置房间密码
+		// 密码只保存哈希，分享房间使用邀请码
+		if err := room.SetPassword(req.Password); err != nil {
+			c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to create room")))
+			return
+		}
+		room.Mode = entity.RoomModeMesh
+		if req.Mode != "" {
+			room.Mode = req.Mode
+		}
+		room.Lobby = req.Lobby
+		req.ScheduleRequest.apply(&room)
 		if err := database.DB(c).Create(&room).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to create room")))
 			return
@@ -212,31 +266,6 @@ func DeleteRoom(c *gin.Context) {
 	c.JSON(http.StatusOK, api.Okay(api.WithMessage("Room deleted successfully")))
 }
 
-// GetMonitoringData returns the monitoring data of all rooms
-func GetMonitoringData(c *gin.Context) {
-	rooms := webrtc.WsServer.GetRooms()
-	// 使用IN查询一次性获取所有房间信息
-	var roomEntities []entity.Room
-	if len(rooms) > 0 {
-		var roomIds = make([]string, 0)
-		for _, v := range rooms {
-			roomIds = append(roomIds, v.Id)
-		}
-		database.DB(context.Background()).Where("uuid IN ?", roomIds).Find(&roomEntities)
-	}
-	// 创建房间ID到房间名称的映射
-	roomNameMap := make(map[string]string)
-	for _, roomEntity := range roomEntities {
-		roomNameMap[roomEntity.Uuid] = roomEntity.Name
-	}
-
-	sort.Slice(roomEntities, func(i, j int) bool {
-		return rooms[i].StartTime.Before(rooms[j].StartTime)
-	})
-
-	c.JSON(http.StatusOK, api.Okay(api.WithData(rooms)))
-}
-
 func GenerateSignature(c *gin.Context) {
 	var req webrtc.SignatureRequest
 	if err := c.ShouldBindQuery(&req); err != nil {
@@ -254,19 +283,44 @@ func GenerateSignature(c *gin.Context) {
 	// 检查用户在房间中的角色
 	var roomUser entity.RoomUser
 	var role = entity.RoleUser
-	if err := database.DB(c).Where("room_id = ? AND user_id = ?", room.Id, user.Id).First(&roomUser).Error; err == nil {
-		if roomUser.IsHost() {
-			role = entity.RoleHost
+	err := database.DB(c).Where("room_id = ? AND user_id = ?", room.Id, user.Id).First(&roomUser).Error
+	if err == nil {
+		if roomUser.Role != 0 {
+			role = roomUser.Role
 		}
 		// 检查用户是否被拉黑
 		if roomUser.IsBlocked() {
 			c.JSON(http.StatusForbidden, api.Fail(api.WithMessage("You are blocked from this room")))
 			return
 		}
+	} else if room.HasPassword() {
+		// 有密码的房间需要先通过密码或邀请码加入
+		c.JSON(http.StatusForbidden, api.Fail(api.WithMessage("Password required")))
+		return
+	}
+
+	// 预约会议只能在会议时间内加入，允许提前 EarlyJoinMinutes 分钟
+	if _, _, ok := room.OccurrenceAt(time.Now(), earlyJoinGrace()); !ok {
+		c.JSON(http.StatusForbidden, api.Fail(api.WithMessage("Meeting is not open now")))
+		return
+	}
+
+	// 无密码房间的参会者在获取令牌时成为成员，文件等接口需要成员身份
+	if err != nil {
+		roomUser = entity.RoomUser{
+			RoomId: room.Id,
+			UserId: user.Id,
+			Role:   entity.RoleUser,
+		}
+		if err := database.DB(c).Clauses(clause.OnConflict{DoNothing: true}).Create(&roomUser).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to join room")))
+			return
+		}
 	}
 
 	req.Role = role
-	req.Timestamp = time.Now().UnixMilli()
+	req.Name = user.Name
+	req.Avatar = user.Avatar
 	sign, err := webrtc.GenerateSignature(req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage(err.Error())))
@@ -274,11 +328,12 @@ func GenerateSignature(c *gin.Context) {
 	}
 
 	sign.RoomName = room.Name
-	sign.Name = user.Name
-	sign.Avatar = user.Avatar
-	// 只有房主才能获取密码
-	if (role & entity.RoleHost) != 0 {
-		sign.RoomPassword = room.Password
+	sign.RoomMode = room.Mode
+	// 主持人可以获取邀请码用于分享
+	if (role & entity.RoleModerator) != 0 {
+		if invite, err := shareableInvite(database.DB(c), &room, user.Id); err == nil {
+			sign.InviteCode = invite.Code
+		}
 	}
 
 	c.JSON(http.StatusOK, api.Okay(api.WithData(sign)))
@@ -302,8 +357,24 @@ func JoinRoom(c *gin.Context) {
 		return
 	}
 
-	// 验证密码
-	if room.Password != "" && room.Password != req.Password {
+	// 邀请码代替密码，成员角色由邀请决定
+	var invite entity.RoomInvite
+	if req.Code != "" && database.DB(c).Where("room_id = ? AND code = ?", room.Id, req.Code).First(&invite).Error == nil {
+		roomUser, err := redeemInvite(database.DB(c), user.Id, &invite)
+		switch {
+		case errors.Is(err, errInviteUnusable):
+			c.JSON(http.StatusGone, api.Fail(api.WithMessage("Invite is no longer valid")))
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to join room")))
+		case roomUser.IsBlocked():
+			c.JSON(http.StatusForbidden, api.Fail(api.WithMessage("You are blocked from this room")))
+		default:
+			c.JSON(http.StatusOK, api.Okay(api.WithMessage("Successfully joined room")))
+		}
+		return
+	}
+
+	if !room.CheckPassword(req.Password) {
 		c.JSON(http.StatusUnauthorized, api.Fail(api.WithMessage("Invalid password")))
 		return
 	}
@@ -313,14 +384,14 @@ func JoinRoom(c *gin.Context) {
 	database.DB(c).Where("room_id = ? AND user_id = ?", room.Id, user.Id).First(&existingRoomUser)
 
 	if existingRoomUser.Id == 0 {
-		// 用户不在房间中，创建新的关联记录
+		// 用户不在房间中，创建新的关联记录，并发加入时由唯一索引去重
 		roomUser := entity.RoomUser{
 			RoomId:  room.Id,
 			UserId:  user.Id,
 			Role:    entity.RoleUser,
 			Blocked: false,
 		}
-		if err := database.DB(c).Create(&roomUser).Error; err != nil {
+		if err := database.DB(c).Clauses(clause.OnConflict{DoNothing: true}).Create(&roomUser).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to join room")))
 			return
 		}
@@ -369,7 +440,17 @@ func UpdateRoom(c *gin.Context) {
 		updates["name"] = req.Name
 	}
 	if req.Password != "" {
-		updates["password"] = req.Password
+		if err := room.SetPassword(req.Password); err != nil {
+			c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to update room")))
+			return
+		}
+		updates["password"] = room.Password
+	}
+	if req.Mode != "" {
+		updates["mode"] = req.Mode
+	}
+	if req.Lobby != nil {
+		updates["lobby"] = *req.Lobby
 	}
 
 	if len(updates) > 0 {
@@ -378,6 +459,9 @@ func UpdateRoom(c *gin.Context) {
 			return
 		}
 	}
+	if r := webrtc.WsServer.FindRoom(room.Uuid); r != nil && req.Lobby != nil {
+		r.SetLobby(*req.Lobby)
+	}
 
 	c.JSON(http.StatusOK, api.Okay(api.WithMessage("Room updated successfully")))
 }
@@ -407,7 +491,7 @@ func KickUser(c *gin.Context) {
 		return
 	}
 
-	if !adminRoomUser.IsHost() {
+	if !adminRoomUser.IsModerator() {
 		c.JSON(http.StatusForbidden, api.Fail(api.WithMessage("Only room admin can kick users")))
 		return
 	}
@@ -425,8 +509,15 @@ func KickUser(c *gin.Context) {
 		return
 	}
 
-	// 踢出用户（从房间用户表中删除记录）
-	if err := database.DB(c).Where("room_id = ? AND user_id = ?", room.Id, req.UserId).Delete(&entity.RoomUser{}).Error; err != nil {
+	// 联席主持人不能踢出房主
+	var targetRoomUser entity.RoomUser
+	if database.DB(c).Where("room_id = ? AND user_id = ?", room.Id, req.UserId).Find(&targetRoomUser); targetRoomUser.IsHost() {
+		c.JSON(http.StatusForbidden, api.Fail(api.WithMessage("Cannot kick the room owner")))
+		return
+	}
+
+	// 踢出用户（从房间用户表中删除记录，再次加入时重新创建）
+	if err := database.DB(c).Unscoped().Where("room_id = ? AND user_id = ?", room.Id, req.UserId).Delete(&entity.RoomUser{}).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to kick user")))
 		return
 	}
@@ -434,13 +525,10 @@ func KickUser(c *gin.Context) {
 	// 如果用户在线，发送踢出消息
 	if activeRoom := webrtc.WsServer.FindRoom(room.Uuid); activeRoom != nil {
 		if client := activeRoom.FindClient(targetUser.Uuid); client != nil {
-			client.Send(&webrtc.Message{
-				Type: webrtc.MessageTypeKick,
-				From: nil,
-				Data: "You have been kicked from the room",
-			})
+			client.Send(webrtc.NewMessage(webrtc.MessageTypeKick, nil, "You have been kicked from the room"))
 		}
 	}
+	dispatchModeration(&room, entity.WebhookEventParticipantKicked, &targetUser, user)
 
 	c.JSON(http.StatusOK, api.Okay(api.WithMessage("User kicked successfully")))
 }
@@ -470,7 +558,7 @@ func BlockUser(c *gin.Context) {
 		return
 	}
 
-	if !adminRoomUser.IsHost() {
+	if !adminRoomUser.IsModerator() {
 		c.JSON(http.StatusForbidden, api.Fail(api.WithMessage("Only room admin can block users")))
 		return
 	}
@@ -495,13 +583,16 @@ func BlockUser(c *gin.Context) {
 		targetRoomUser = entity.RoomUser{
 			RoomId:  room.Id,
 			UserId:  req.UserId,
-			Role:    entity.RoleHost,
+			Role:    entity.RoleUser,
 			Blocked: true,
 		}
 		if err := database.DB(c).Create(&targetRoomUser).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, api.Fail(api.WithMessage("Failed to block user")))
 			return
 		}
+	} else if targetRoomUser.IsHost() {
+		c.JSON(http.StatusForbidden, api.Fail(api.WithMessage("Cannot block the room owner")))
+		return
 	} else {
 		// 更新用户状态为被拉黑
 		if err := database.DB(c).Model(&targetRoomUser).Update("blocked", true).Error; err != nil {
@@ -513,13 +604,10 @@ func BlockUser(c *gin.Context) {
 	// 如果用户在线，踢出并发送拉黑消息
 	if activeRoom := webrtc.WsServer.FindRoom(room.Uuid); activeRoom != nil {
 		if client := activeRoom.FindClient(targetUser.Uuid); client != nil {
-			client.Send(&webrtc.Message{
-				Type: webrtc.MessageTypeKick,
-				From: nil,
-				Data: "You have been blocked from the room",
-			})
+			client.Send(webrtc.NewMessage(webrtc.MessageTypeKick, nil, "You have been blocked from the room"))
 		}
 	}
+	dispatchModeration(&room, entity.WebhookEventParticipantBlocked, &targetUser, user)
 
 	c.JSON(http.StatusOK, api.Okay(api.WithMessage("User blocked successfully")))
 }
@@ -543,7 +631,7 @@ func GetRoomMembers(c *gin.Context) {
 		return
 	}
 
-	if !adminRoomUser.IsHost() {
+	if !adminRoomUser.IsModerator() {
 		c.JSON(http.StatusForbidden, api.Fail(api.WithMessage("Only room admin can view members")))
 		return
 	}
@@ -561,7 +649,7 @@ func GetRoomMembers(c *gin.Context) {
 		members[i] = RoomMemberInfo{
 			UserId:   ru.UserId,
 			UserName: ru.User.Name,
-			Role:     string(ru.Role),
+			Role:     ru.Role.String(),
 			Blocked:  ru.Blocked,
 		}
 	}
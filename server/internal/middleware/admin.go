@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"meeting/internal/utility/auth"
+	"meeting/pkg/api"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Admin only lets the administrators configured in App.Admins through, it must run after Authentication
+func Admin() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !auth.IsAdmin(auth.UserFromCtx(ctx)) {
+			ctx.JSON(http.StatusForbidden, api.Fail(api.WithMessage("Admin only")))
+			ctx.Abort()
+			return
+		}
+
+		ctx.Next()
+	}
+}
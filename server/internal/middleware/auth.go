@@ -2,11 +2,14 @@ package middleware
 
 import (
 	"errors"
+	"log"
 	"meeting/internal/constants"
 	"meeting/internal/model/entity"
 	"meeting/pkg/api"
 	"meeting/pkg/database"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -21,6 +24,11 @@ func Authentication() gin.HandlerFunc {
 		//ctx.Set(constants.UserKey, user)
 		//ctx.Next()
 		//return
+		if header := ctx.GetHeader("Authorization"); header != "" {
+			tokenAuthentication(ctx, header)
+			return
+		}
+
 		session := sessions.Default(ctx)
 		userId, ok := session.Get(constants.UserIdKey).(uint)
 		if !ok || userId == 0 {
@@ -40,3 +48,42 @@ func Authentication() gin.HandlerFunc {
 		ctx.Next()
 	}
 }
+
+// tokenAuthentication authenticates the request with an API token and checks the scope of the route
+func tokenAuthentication(ctx *gin.Context, header string) {
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	token = strings.TrimSpace(token)
+	if !ok || token == "" {
+		ctx.JSON(http.StatusUnauthorized, api.Fail(api.WithMessage("Unauthorized")))
+		ctx.Abort()
+		return
+	}
+
+	var apiToken entity.ApiToken
+	err := database.DB(ctx).Preload("User").Where("token_hash = ?", entity.HashApiToken(token)).First(&apiToken).Error
+	now := time.Now()
+	// 已删除的用户不会被预加载
+	if err != nil || apiToken.User == nil || !apiToken.IsActive(now) {
+		ctx.JSON(http.StatusUnauthorized, api.Fail(api.WithMessage("Unauthorized")))
+		ctx.Abort()
+		return
+	}
+
+	scope, ok := RouteScope(ctx.Request.Method, ctx.FullPath())
+	if !ok || !apiToken.HasScope(scope) {
+		ctx.JSON(http.StatusForbidden, api.Fail(api.WithMessage("Token scope does not allow this request")))
+		ctx.Abort()
+		return
+	}
+
+	// 最近使用时间每分钟最多更新一次，避免每个请求都写库
+	if apiToken.LastUsedAt == nil || now.Sub(*apiToken.LastUsedAt) > time.Minute {
+		if err := database.DB(ctx).Model(&apiToken).UpdateColumn("last_used_at", now).Error; err != nil {
+			log.Printf("update api token %d last used error: %v", apiToken.Id, err)
+		}
+	}
+
+	ctx.Set(constants.UserKey, apiToken.User)
+	ctx.Set(constants.TokenKey, &apiToken)
+	ctx.Next()
+}
@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"context"
+	"meeting/internal/migration"
+	"meeting/internal/model/entity"
+	"meeting/pkg/database"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库只存在于一个连接中
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	database.UseDB(db)
+	if _, err = migration.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// createToken stores a token of the user with the scopes and returns the secret
+func createToken(t *testing.T, user *entity.User, scopes []entity.Scope, modify func(token *entity.ApiToken)) string {
+	t.Helper()
+	secret, hash, err := entity.NewApiToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := &entity.ApiToken{UserId: user.Id, CreatedBy: user.Id, Name: "test", Prefix: secret[:8], TokenHash: hash}
+	token.SetScopes(scopes)
+	if modify != nil {
+		modify(token)
+	}
+	if err = database.DB(context.Background()).Create(token).Error; err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+func TestTokenAuthentication(t *testing.T) {
+	setupDB(t)
+	gin.SetMode(gin.TestMode)
+	db := database.DB(context.Background())
+	user := &entity.User{Uuid: "user", Name: "user"}
+	deleted := &entity.User{Uuid: "deleted", Name: "deleted"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(deleted).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	roomsRead := []entity.Scope{entity.ScopeRoomsRead}
+	valid := createToken(t, user, roomsRead, func(token *entity.ApiToken) { token.ExpiresAt = &future })
+	revoked := createToken(t, user, roomsRead, func(token *entity.ApiToken) { token.RevokedAt = &past })
+	expired := createToken(t, user, roomsRead, func(token *entity.ApiToken) { token.ExpiresAt = &past })
+	wrongScope := createToken(t, user, []entity.Scope{entity.ScopeRoomsWrite}, nil)
+	ofDeleted := createToken(t, deleted, roomsRead, nil)
+	if err := db.Delete(deleted).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.Use(Authentication())
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/api/rooms", ok)
+	r.GET("/api/tokens", ok)
+
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		want   int
+	}{
+		{"valid token", "/api/rooms", "Bearer " + valid, http.StatusOK},
+		{"revoked token", "/api/rooms", "Bearer " + revoked, http.StatusUnauthorized},
+		{"expired token", "/api/rooms", "Bearer " + expired, http.StatusUnauthorized},
+		{"token without the scope", "/api/rooms", "Bearer " + wrongScope, http.StatusForbidden},
+		{"session only route", "/api/tokens", "Bearer " + valid, http.StatusForbidden},
+		{"token of a deleted user", "/api/rooms", "Bearer " + ofDeleted, http.StatusUnauthorized},
+		{"unknown token", "/api/rooms", "Bearer met_unknown", http.StatusUnauthorized},
+		{"not a bearer token", "/api/rooms", "Basic " + valid, http.StatusUnauthorized},
+		{"empty bearer token", "/api/rooms", "Bearer ", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Authorization", tt.header)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+
+	var used entity.ApiToken
+	db.Where("token_hash = ?", entity.HashApiToken(valid)).First(&used)
+	if used.LastUsedAt == nil {
+		t.Fatal("last used time of the valid token was not recorded")
+	}
+}
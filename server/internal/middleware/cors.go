@@ -8,9 +8,9 @@ import (
 func CORS() gin.HandlerFunc {
 	return cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"PUT", "PATCH", "DELETE", "GET", "POST"},
-		AllowHeaders:     []string{"Origin", "Authorization", "content-type", "x-xsrf-token"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowMethods:     []string{"PUT", "PATCH", "DELETE", "GET", "POST", "HEAD"},
+		AllowHeaders:     []string{"Origin", "Authorization", "content-type", "x-xsrf-token", "Tus-Resumable", "Upload-Length", "Upload-Metadata", "Upload-Offset"},
+		ExposeHeaders:    []string{"Content-Length", "Location", "Tus-Resumable", "Tus-Version", "Upload-Offset", "Upload-Length", "Upload-Expires"}, // 断点续传需要读取的响应头
 		AllowCredentials: true,
 		AllowOriginFunc: func(origin string) bool {
 			return true
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"meeting/internal/model/entity"
+	"sort"
+)
+
+// routeScopes 为 API 令牌可以访问的接口及所需权限，键为 "方法 路由"。
+// 需要登录的接口必须列在这里或 sessionRoutes 中。
+var routeScopes = map[string]entity.Scope{
+	"GET /api/info": entity.ScopeProfileRead,
+
+	"GET /api/signature": entity.ScopeMeetingsJoin,
+
+	"GET /api/room/:id":                   entity.ScopeRoomsRead,
+	"GET /api/rooms":                      entity.ScopeRoomsRead,
+	"GET /api/rooms/:id/invitees":         entity.ScopeRoomsRead,
+	"GET /api/rooms/:id/calendar.ics":     entity.ScopeRoomsRead,
+	"GET /api/rooms/:id/invite-code":      entity.ScopeRoomsRead,
+	"GET /api/rooms/:id/invites":          entity.ScopeRoomsRead,
+	"POST /api/room":                      entity.ScopeRoomsWrite,
+	"DELETE /api/room/:id":                entity.ScopeRoomsWrite,
+	"POST /api/rooms/:id/join":            entity.ScopeRoomsWrite,
+	"PUT /api/rooms/:id/update":           entity.ScopeRoomsWrite,
+	"PUT /api/rooms/:id/schedule":         entity.ScopeRoomsWrite,
+	"PUT /api/rooms/:id/invitees":         entity.ScopeRoomsWrite,
+	"POST /api/rooms/:id/invite-code":     entity.ScopeRoomsWrite,
+	"POST /api/rooms/:id/invites":         entity.ScopeRoomsWrite,
+	"DELETE /api/rooms/:id/invites/:code": entity.ScopeRoomsWrite,
+	"POST /api/invites/:code/redeem":      entity.ScopeRoomsWrite,
+
+	"GET /api/rooms/:id/members":              entity.ScopeMembersRead,
+	"POST /api/rooms/:id/kick":                entity.ScopeMembersWrite,
+	"POST /api/rooms/:id/block":               entity.ScopeMembersWrite,
+	"POST /api/rooms/:id/lobby/admit":         entity.ScopeMembersWrite,
+	"PUT /api/rooms/:id/members/:userId/role": entity.ScopeMembersWrite,
+
+	"GET /api/rooms/:id/messages": entity.ScopeMessagesRead,
+
+	"GET /api/rooms/:id/sessions":                           entity.ScopeMembersRead,
+	"GET /api/rooms/:id/sessions/:sessionId/attendance.csv": entity.ScopeMembersRead,
+
+	"GET /api/monitoring":        entity.ScopeMonitoringRead,
+	"GET /api/monitoring/events": entity.ScopeMonitoringRead,
+
+	"GET /api/rooms/:id/webhooks":                       entity.ScopeWebhooksRead,
+	"GET /api/rooms/:id/webhooks/:webhookId/deliveries": entity.ScopeWebhooksRead,
+	"GET /api/webhooks":                                 entity.ScopeWebhooksRead,
+	"GET /api/webhooks/:webhookId/deliveries":           entity.ScopeWebhooksRead,
+	"POST /api/rooms/:id/webhooks":                      entity.ScopeWebhooksWrite,
+	"PUT /api/rooms/:id/webhooks/:webhookId":            entity.ScopeWebhooksWrite,
+	"DELETE /api/rooms/:id/webhooks/:webhookId":         entity.ScopeWebhooksWrite,
+	"POST /api/webhooks":                                entity.ScopeWebhooksWrite,
+	"PUT /api/webhooks/:webhookId":                      entity.ScopeWebhooksWrite,
+	"DELETE /api/webhooks/:webhookId":                   entity.ScopeWebhooksWrite,
+
+	"GET /api/rooms/:id/recordings":                            entity.ScopeRecordingsRead,
+	"GET /api/rooms/:id/recordings/:recordingId/download":      entity.ScopeRecordingsRead,
+	"GET /api/rooms/:id/recordings/:recordingId/files/:fileId": entity.ScopeRecordingsRead,
+	"DELETE /api/rooms/:id/recordings/:recordingId":            entity.ScopeRecordingsWrite,
+
+	"GET /api/rooms/:id/files":            entity.ScopeFilesRead,
+	"GET /api/rooms/:id/files/:fileId":    entity.ScopeFilesRead,
+	"HEAD /api/rooms/:id/files/:fileId":   entity.ScopeFilesWrite,
+	"POST /api/rooms/:id/files":           entity.ScopeFilesWrite,
+	"PATCH /api/rooms/:id/files/:fileId":  entity.ScopeFilesWrite,
+	"DELETE /api/rooms/:id/files/:fileId": entity.ScopeFilesWrite,
+}
+
+// sessionRoutes 为只能通过登录会话访问的接口，令牌不能管理令牌和服务账号
+var sessionRoutes = map[string]bool{
+	"GET /api/user/center":                             true,
+	"POST /api/auth/email/verify":                      true,
+	"GET /api/tokens":                                  true,
+	"POST /api/tokens":                                 true,
+	"DELETE /api/tokens/:id":                           true,
+	"GET /api/service-accounts":                        true,
+	"POST /api/service-accounts":                       true,
+	"DELETE /api/service-accounts/:id":                 true,
+	"GET /api/service-accounts/:id/tokens":             true,
+	"POST /api/service-accounts/:id/tokens":            true,
+	"DELETE /api/service-accounts/:id/tokens/:tokenId": true,
+}
+
+// RouteScope returns the scope a token needs for the route, false when tokens may not call it
+func RouteScope(method, route string) (entity.Scope, bool) {
+	scope, ok := routeScopes[method+" "+route]
+	return scope, ok
+}
+
+// SessionOnly reports whether the route may only be called with a login session
+func SessionOnly(method, route string) bool {
+	return sessionRoutes[method+" "+route]
+}
+
+// Routes returns the routes given a scope or marked session only, as "METHOD route"
+func Routes() []string {
+	routes := make([]string, 0, len(routeScopes)+len(sessionRoutes))
+	for route := range routeScopes {
+		routes = append(routes, route)
+	}
+	for route := range sessionRoutes {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+
+	return routes
+}
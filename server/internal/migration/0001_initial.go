@@ -0,0 +1,130 @@
+package migration
+
+import (
+	"meeting/pkg/database"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 初始表结构，与之前启动时 AutoMigrate 创建的表一致，已有数据库执行时只补齐缺少的列和索引
+func init() {
+	register(&Migration{
+		Version: 1,
+		Name:    "initial",
+		Up: func(tx *gorm.DB) error {
+			if err := convertBlocked0001(tx); err != nil {
+				return err
+			}
+			return database.TableOptions(tx).AutoMigrate(&user0001{}, &room0001{}, &roomUser0001{}, &chatMessage0001{}, &roomInvitee0001{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&roomInvitee0001{}, &chatMessage0001{}, &roomUser0001{}, &room0001{}, &user0001{})
+		},
+	})
+}
+
+// convertBlocked0001 prepares room_users.blocked of existing databases, the column was a varchar(20)
+// holding '0', '1' or the default 'false', strict MySQL refuses to convert the text values to a boolean
+func convertBlocked0001(tx *gorm.DB) error {
+	m := tx.Migrator()
+	if !m.HasTable(&roomUser0001{}) {
+		return nil
+	}
+	columnTypes, err := m.ColumnTypes(&roomUser0001{})
+	if err != nil {
+		return err
+	}
+	for _, column := range columnTypes {
+		if column.Name() != "blocked" || !strings.Contains(strings.ToLower(column.DatabaseTypeName()), "char") {
+			continue
+		}
+		if err = tx.Exec("UPDATE room_users SET blocked = '0' WHERE blocked = 'false'").Error; err != nil {
+			return err
+		}
+		if err = tx.Exec("UPDATE room_users SET blocked = '1' WHERE blocked = 'true'").Error; err != nil {
+			return err
+		}
+		// PostgreSQL 无法把文本默认值转换为布尔类型，先删除默认值，AutoMigrate 会重新设置
+		if tx.Dialector.Name() != "sqlite" {
+			return tx.Exec("ALTER TABLE room_users ALTER COLUMN blocked DROP DEFAULT").Error
+		}
+	}
+
+	return nil
+}
+
+type user0001 struct {
+	Id        uint   `gorm:"primarykey"`
+	Uuid      string `gorm:"type:char(36);uniqueIndex;not null"`
+	Name      string `gorm:"not null;size:100"`
+	Email     string `gorm:"size:255"`
+	Avatar    string `gorm:"size:500"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (*user0001) TableName() string { return "users" }
+
+type room0001 struct {
+	Id              uint   `gorm:"primarykey"`
+	Uuid            string `gorm:"type:char(36);uniqueIndex;not null"`
+	Name            string `gorm:"not null;default:'';size:100"`
+	Password        string `gorm:"size:255"`
+	Mode            string `gorm:"size:20;not null;default:'mesh'"`
+	Lobby           bool   `gorm:"not null;default:false"`
+	StartAt         *time.Time
+	EndAt           *time.Time
+	Recurrence      string `gorm:"size:20;not null;default:''"`
+	RecurrenceUntil *time.Time
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	DeletedAt       gorm.DeletedAt `gorm:"index"`
+}
+
+func (*room0001) TableName() string { return "rooms" }
+
+type roomUser0001 struct {
+	Id        uint  `gorm:"primarykey"`
+	RoomId    uint  `gorm:"not null;index"`
+	UserId    uint  `gorm:"not null;index"`
+	Role      uint8 `gorm:"not null;default:2"`
+	Blocked   bool  `gorm:"not null;default:false"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	Room *room0001 `gorm:"foreignKey:RoomId"`
+	User *user0001 `gorm:"foreignKey:UserId"`
+}
+
+func (*roomUser0001) TableName() string { return "room_users" }
+
+type chatMessage0001 struct {
+	Id         uint      `gorm:"primarykey"`
+	RoomId     uint      `gorm:"not null;index:idx_chat_messages_room_created,priority:1"`
+	MessageId  string    `gorm:"size:64;not null;default:''"`
+	UserUuid   string    `gorm:"type:char(36);not null"`
+	UserName   string    `gorm:"not null;default:'';size:100"`
+	UserAvatar string    `gorm:"size:500"`
+	Content    string    `gorm:"type:text;not null"`
+	CreatedAt  time.Time `gorm:"index:idx_chat_messages_room_created,priority:2"`
+
+	Room *room0001 `gorm:"foreignKey:RoomId"`
+}
+
+func (*chatMessage0001) TableName() string { return "chat_messages" }
+
+type roomInvitee0001 struct {
+	Id        uint `gorm:"primarykey"`
+	RoomId    uint `gorm:"not null;uniqueIndex:idx_room_invitees_room_user,priority:1"`
+	UserId    uint `gorm:"not null;uniqueIndex:idx_room_invitees_room_user,priority:2;index"`
+	CreatedAt time.Time
+
+	Room *room0001 `gorm:"foreignKey:RoomId"`
+	User *user0001 `gorm:"foreignKey:UserId"`
+}
+
+func (*roomInvitee0001) TableName() string { return "room_invitees" }
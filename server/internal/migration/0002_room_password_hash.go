@@ -0,0 +1,80 @@
+package migration
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// 房间密码改为 bcrypt 哈希存储，并为每个房间生成邀请码
+func init() {
+	register(&Migration{
+		Version: 2,
+		Name:    "room_password_hash",
+		Up: func(tx *gorm.DB) error {
+			if !tx.Migrator().HasColumn(&room0002{}, "InviteCode") {
+				if err := tx.Migrator().AddColumn(&room0002{}, "InviteCode"); err != nil {
+					return err
+				}
+			}
+			if !tx.Migrator().HasIndex(&room0002{}, "InviteCode") {
+				if err := tx.Migrator().CreateIndex(&room0002{}, "InviteCode"); err != nil {
+					return err
+				}
+			}
+
+			var rooms []room0002
+			if err := tx.Unscoped().Find(&rooms).Error; err != nil {
+				return err
+			}
+			for _, room := range rooms {
+				updates := map[string]any{}
+				// 已经是 bcrypt 哈希的密码不再处理
+				if room.Password != "" && !strings.HasPrefix(room.Password, "$2") {
+					hash, err := bcrypt.GenerateFromPassword([]byte(room.Password), bcrypt.DefaultCost)
+					if err != nil {
+						return err
+					}
+					updates["password"] = string(hash)
+				}
+				if room.InviteCode == "" {
+					code, err := inviteCode0002()
+					if err != nil {
+						return err
+					}
+					updates["invite_code"] = code
+				}
+				if len(updates) > 0 {
+					if err := tx.Model(&room0002{}).Where("id = ?", room.Id).Updates(updates).Error; err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+		// 哈希无法还原为明文，回滚只删除邀请码
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&room0002{}, "InviteCode")
+		},
+	})
+}
+
+type room0002 struct {
+	Id         uint   `gorm:"primarykey"`
+	Password   string `gorm:"size:255"`
+	InviteCode string `gorm:"size:32;index"`
+}
+
+func (*room0002) TableName() string { return "rooms" }
+
+func inviteCode0002() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)), nil
+}
@@ -0,0 +1,38 @@
+package migration
+
+import (
+	"meeting/pkg/database"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 房间邀请链接
+func init() {
+	register(&Migration{
+		Version: 3,
+		Name:    "room_invites",
+		Up: func(tx *gorm.DB) error {
+			return database.TableOptions(tx).AutoMigrate(&roomInvite0003{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&roomInvite0003{})
+		},
+	})
+}
+
+type roomInvite0003 struct {
+	Id        uint   `gorm:"primarykey"`
+	RoomId    uint   `gorm:"not null;index"`
+	Code      string `gorm:"size:32;not null;uniqueIndex"`
+	Role      uint8  `gorm:"not null;default:2"`
+	MaxUses   int    `gorm:"not null;default:0"`
+	Uses      int    `gorm:"not null;default:0"`
+	ExpiresAt *time.Time
+	RevokedAt *time.Time
+	CreatedBy uint `gorm:"not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (*roomInvite0003) TableName() string { return "room_invites" }
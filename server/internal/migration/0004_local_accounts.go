@@ -0,0 +1,68 @@
+package migration
+
+import (
+	"meeting/pkg/database"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 本地账号密码和邮箱验证码登录
+func init() {
+	register(&Migration{
+		Version: 4,
+		Name:    "local_accounts",
+		Up: func(tx *gorm.DB) error {
+			for _, field := range []string{"Username", "PasswordHash"} {
+				if !tx.Migrator().HasColumn(&user0004{}, field) {
+					if err := tx.Migrator().AddColumn(&user0004{}, field); err != nil {
+						return err
+					}
+				}
+			}
+			if !tx.Migrator().HasIndex(&user0004{}, "Username") {
+				if err := tx.Migrator().CreateIndex(&user0004{}, "Username"); err != nil {
+					return err
+				}
+			}
+
+			return database.TableOptions(tx).AutoMigrate(&loginCode0004{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&loginCode0004{}); err != nil {
+				return err
+			}
+			if tx.Migrator().HasIndex(&user0004{}, "Username") {
+				if err := tx.Migrator().DropIndex(&user0004{}, "Username"); err != nil {
+					return err
+				}
+			}
+			for _, field := range []string{"PasswordHash", "Username"} {
+				if err := tx.Migrator().DropColumn(&user0004{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
+
+type user0004 struct {
+	Id           uint    `gorm:"primarykey"`
+	Username     *string `gorm:"size:64;uniqueIndex"`
+	PasswordHash string  `gorm:"size:255"`
+}
+
+func (*user0004) TableName() string { return "users" }
+
+type loginCode0004 struct {
+	Id         uint      `gorm:"primarykey"`
+	Email      string    `gorm:"size:255;not null;index"`
+	CodeHash   string    `gorm:"size:64;not null"`
+	Attempts   int       `gorm:"not null;default:0"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	ConsumedAt *time.Time
+	CreatedAt  time.Time
+}
+
+func (*loginCode0004) TableName() string { return "login_codes" }
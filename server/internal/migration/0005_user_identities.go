@@ -0,0 +1,33 @@
+package migration
+
+import (
+	"meeting/pkg/database"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 第三方登录身份，支持同时配置多个 OpenID Connect 服务
+func init() {
+	register(&Migration{
+		Version: 5,
+		Name:    "user_identities",
+		Up: func(tx *gorm.DB) error {
+			return database.TableOptions(tx).AutoMigrate(&userIdentity0005{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&userIdentity0005{})
+		},
+	})
+}
+
+type userIdentity0005 struct {
+	Id        uint   `gorm:"primarykey"`
+	UserId    uint   `gorm:"not null;index"`
+	Provider  string `gorm:"size:64;not null;uniqueIndex:idx_user_identities_provider_subject,priority:1"`
+	Subject   string `gorm:"size:255;not null;uniqueIndex:idx_user_identities_provider_subject,priority:2"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (*userIdentity0005) TableName() string { return "user_identities" }
@@ -0,0 +1,73 @@
+package migration
+
+import (
+	"meeting/pkg/database"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// API 令牌和服务账号
+func init() {
+	register(&Migration{
+		Version: 6,
+		Name:    "api_tokens",
+		Up: func(tx *gorm.DB) error {
+			for _, field := range []string{"Bot", "OwnerId"} {
+				if !tx.Migrator().HasColumn(&user0006{}, field) {
+					if err := tx.Migrator().AddColumn(&user0006{}, field); err != nil {
+						return err
+					}
+				}
+			}
+			if !tx.Migrator().HasIndex(&user0006{}, "OwnerId") {
+				if err := tx.Migrator().CreateIndex(&user0006{}, "OwnerId"); err != nil {
+					return err
+				}
+			}
+
+			return database.TableOptions(tx).AutoMigrate(&apiToken0006{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&apiToken0006{}); err != nil {
+				return err
+			}
+			if tx.Migrator().HasIndex(&user0006{}, "OwnerId") {
+				if err := tx.Migrator().DropIndex(&user0006{}, "OwnerId"); err != nil {
+					return err
+				}
+			}
+			for _, field := range []string{"OwnerId", "Bot"} {
+				if err := tx.Migrator().DropColumn(&user0006{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
+
+type user0006 struct {
+	Id      uint  `gorm:"primarykey"`
+	Bot     bool  `gorm:"not null;default:false"`
+	OwnerId *uint `gorm:"index"`
+}
+
+func (*user0006) TableName() string { return "users" }
+
+type apiToken0006 struct {
+	Id         uint   `gorm:"primarykey"`
+	UserId     uint   `gorm:"not null;index"`
+	CreatedBy  uint   `gorm:"not null;index"`
+	Name       string `gorm:"size:100;not null"`
+	Prefix     string `gorm:"size:16;not null"`
+	TokenHash  string `gorm:"size:64;not null;uniqueIndex"`
+	Scopes     string `gorm:"size:500;not null;default:''"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (*apiToken0006) TableName() string { return "api_tokens" }
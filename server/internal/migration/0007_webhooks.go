@@ -0,0 +1,54 @@
+package migration
+
+import (
+	"meeting/pkg/database"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Webhook 订阅和投递记录
+func init() {
+	register(&Migration{
+		Version: 7,
+		Name:    "webhooks",
+		Up: func(tx *gorm.DB) error {
+			return database.TableOptions(tx).AutoMigrate(&webhook0007{}, &webhookDelivery0007{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&webhookDelivery0007{}, &webhook0007{})
+		},
+	})
+}
+
+type webhook0007 struct {
+	Id        uint   `gorm:"primarykey"`
+	RoomId    *uint  `gorm:"index"`
+	Url       string `gorm:"size:500;not null"`
+	Secret    string `gorm:"size:100;not null"`
+	Events    string `gorm:"size:500;not null;default:''"`
+	Active    bool   `gorm:"not null;default:true"`
+	CreatedBy uint   `gorm:"not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (*webhook0007) TableName() string { return "webhooks" }
+
+type webhookDelivery0007 struct {
+	Id             uint       `gorm:"primarykey"`
+	WebhookId      uint       `gorm:"not null;index"`
+	EventId        string     `gorm:"size:36;not null;index"`
+	Event          string     `gorm:"size:50;not null"`
+	Payload        string     `gorm:"type:text;not null"`
+	Status         string     `gorm:"size:20;not null;index"`
+	Attempts       int        `gorm:"not null;default:0"`
+	NextAttemptAt  *time.Time `gorm:"index"`
+	ResponseStatus int
+	Error          string `gorm:"size:500"`
+	DeliveredAt    *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (*webhookDelivery0007) TableName() string { return "webhook_deliveries" }
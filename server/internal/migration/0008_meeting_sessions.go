@@ -0,0 +1,51 @@
+package migration
+
+import (
+	"meeting/pkg/database"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 会议场次和参会记录
+func init() {
+	register(&Migration{
+		Version: 8,
+		Name:    "meeting_sessions",
+		Up: func(tx *gorm.DB) error {
+			return database.TableOptions(tx).AutoMigrate(&meetingSession0008{}, &meetingAttendance0008{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&meetingAttendance0008{}, &meetingSession0008{})
+		},
+	})
+}
+
+type meetingSession0008 struct {
+	Id        uint       `gorm:"primarykey"`
+	RoomId    uint       `gorm:"not null;index"`
+	StartedAt time.Time  `gorm:"not null"`
+	EndedAt   *time.Time `gorm:"index"`
+	MaxOnline int        `gorm:"not null;default:0"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (*meetingSession0008) TableName() string { return "meeting_sessions" }
+
+type meetingAttendance0008 struct {
+	Id              uint      `gorm:"primarykey"`
+	SessionId       uint      `gorm:"not null;uniqueIndex:idx_meeting_attendances_session_user,priority:1"`
+	RoomId          uint      `gorm:"not null;index"`
+	UserUuid        string    `gorm:"size:36;not null;uniqueIndex:idx_meeting_attendances_session_user,priority:2"`
+	UserName        string    `gorm:"size:100;not null"`
+	JoinedAt        time.Time `gorm:"not null"`
+	LeftAt          *time.Time
+	OnlineSince     *time.Time
+	DurationSeconds int64 `gorm:"not null;default:0"`
+	Reconnects      int   `gorm:"not null;default:0"`
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+func (*meetingAttendance0008) TableName() string { return "meeting_attendances" }
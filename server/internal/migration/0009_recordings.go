@@ -0,0 +1,54 @@
+package migration
+
+import (
+	"meeting/pkg/database"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 服务端录制和录制文件
+func init() {
+	register(&Migration{
+		Version: 9,
+		Name:    "recordings",
+		Up: func(tx *gorm.DB) error {
+			return database.TableOptions(tx).AutoMigrate(&recording0009{}, &recordingFile0009{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&recordingFile0009{}, &recording0009{})
+		},
+	})
+}
+
+type recording0009 struct {
+	Id        uint      `gorm:"primarykey"`
+	Uuid      string    `gorm:"size:36;not null;uniqueIndex"`
+	RoomId    uint      `gorm:"not null;index"`
+	StartedBy uint      `gorm:"not null"`
+	Status    string    `gorm:"size:20;not null;default:recording"`
+	StartedAt time.Time `gorm:"not null"`
+	StoppedAt *time.Time
+	Size      int64 `gorm:"not null;default:0"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (*recording0009) TableName() string { return "recordings" }
+
+type recordingFile0009 struct {
+	Id              uint      `gorm:"primarykey"`
+	RecordingId     uint      `gorm:"not null;index"`
+	ParticipantUuid string    `gorm:"size:36;not null"`
+	ParticipantName string    `gorm:"size:100;not null"`
+	Kind            string    `gorm:"size:10;not null"`
+	Codec           string    `gorm:"size:50;not null"`
+	Name            string    `gorm:"size:200;not null"`
+	Size            int64     `gorm:"not null;default:0"`
+	StartedAt       time.Time `gorm:"not null"`
+	EndedAt         *time.Time
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+func (*recordingFile0009) TableName() string { return "recording_files" }
@@ -0,0 +1,55 @@
+package migration
+
+import (
+	"meeting/pkg/database"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 经服务端中转的聊天文件
+func init() {
+	register(&Migration{
+		Version: 10,
+		Name:    "room_files",
+		Up: func(tx *gorm.DB) error {
+			if !tx.Migrator().HasColumn(&chatMessage0010{}, "FileUuid") {
+				if err := tx.Migrator().AddColumn(&chatMessage0010{}, "FileUuid"); err != nil {
+					return err
+				}
+			}
+
+			return database.TableOptions(tx).AutoMigrate(&roomFile0010{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&roomFile0010{}); err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&chatMessage0010{}, "FileUuid")
+		},
+	})
+}
+
+type chatMessage0010 struct {
+	Id       uint   `gorm:"primarykey"`
+	FileUuid string `gorm:"size:36;not null;default:''"`
+}
+
+func (*chatMessage0010) TableName() string { return "chat_messages" }
+
+type roomFile0010 struct {
+	Id         uint      `gorm:"primarykey"`
+	Uuid       string    `gorm:"size:36;not null;uniqueIndex"`
+	RoomId     uint      `gorm:"not null;index"`
+	UploadedBy uint      `gorm:"not null"`
+	Name       string    `gorm:"size:255;not null"`
+	MimeType   string    `gorm:"size:100;not null;default:''"`
+	Size       int64     `gorm:"not null"`
+	Received   int64     `gorm:"not null;default:0"`
+	Status     string    `gorm:"size:20;not null;default:uploading"`
+	ExpiresAt  time.Time `gorm:"not null;index"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (*roomFile0010) TableName() string { return "room_files" }
@@ -0,0 +1,27 @@
+package migration
+
+import "gorm.io/gorm"
+
+// 预约会议的时区
+func init() {
+	register(&Migration{
+		Version: 11,
+		Name:    "room_time_zone",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&room0011{}, "TimeZone") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&room0011{}, "TimeZone")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&room0011{}, "TimeZone")
+		},
+	})
+}
+
+type room0011 struct {
+	Id       uint   `gorm:"primarykey"`
+	TimeZone string `gorm:"size:64;not null;default:''"`
+}
+
+func (*room0011) TableName() string { return "rooms" }
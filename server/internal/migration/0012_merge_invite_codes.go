@@ -0,0 +1,86 @@
+package migration
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 房间邀请码并入邀请链接，只保留 room_invites 一种邀请方式
+func init() {
+	register(&Migration{
+		Version: 12,
+		Name:    "merge_invite_codes",
+		Up: func(tx *gorm.DB) error {
+			if !tx.Migrator().HasColumn(&room0012{}, "InviteCode") {
+				return nil
+			}
+
+			var rooms []room0012
+			if err := tx.Unscoped().Where("invite_code <> ''").Find(&rooms).Error; err != nil {
+				return err
+			}
+			now := time.Now()
+			for _, room := range rooms {
+				// 邀请码由房主创建，不限次数且不过期
+				var owner roomUser0012
+				tx.Where("room_id = ? AND role = ?", room.Id, 1).Order("id").Limit(1).Find(&owner)
+				invite := roomInvite0012{
+					RoomId:    room.Id,
+					Code:      room.InviteCode,
+					Role:      2,
+					CreatedBy: owner.UserId,
+					CreatedAt: now,
+					UpdatedAt: now,
+				}
+				if err := tx.Create(&invite).Error; err != nil {
+					return err
+				}
+			}
+
+			if tx.Migrator().HasIndex(&room0012{}, "InviteCode") {
+				if err := tx.Migrator().DropIndex(&room0012{}, "InviteCode"); err != nil {
+					return err
+				}
+			}
+			return tx.Migrator().DropColumn(&room0012{}, "InviteCode")
+		},
+		// 回滚恢复空的邀请码列，迁移过去的邀请保留在 room_invites 中
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().AddColumn(&room0012{}, "InviteCode"); err != nil {
+				return err
+			}
+			return tx.Migrator().CreateIndex(&room0012{}, "InviteCode")
+		},
+	})
+}
+
+type room0012 struct {
+	Id         uint   `gorm:"primarykey"`
+	InviteCode string `gorm:"size:32;index"`
+}
+
+func (*room0012) TableName() string { return "rooms" }
+
+type roomUser0012 struct {
+	Id     uint `gorm:"primarykey"`
+	RoomId uint
+	UserId uint
+	Role   uint8
+}
+
+func (*roomUser0012) TableName() string { return "room_users" }
+
+type roomInvite0012 struct {
+	Id        uint `gorm:"primarykey"`
+	RoomId    uint
+	Code      string
+	Role      uint8
+	MaxUses   int
+	Uses      int
+	CreatedBy uint
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (*roomInvite0012) TableName() string { return "room_invites" }
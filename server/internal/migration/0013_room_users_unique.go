@@ -0,0 +1,36 @@
+package migration
+
+import "gorm.io/gorm"
+
+// 每个用户在一个房间中只有一条成员记录，避免并发加入时重复创建
+func init() {
+	register(&Migration{
+		Version: 13,
+		Name:    "room_users_unique",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasIndex(&roomUser0013{}, "idx_room_users_room_user") {
+				return nil
+			}
+			// 踢出成员改为直接删除，清理之前软删除的记录
+			if err := tx.Exec("DELETE FROM room_users WHERE deleted_at IS NOT NULL").Error; err != nil {
+				return err
+			}
+			// 重复的记录只保留最早创建的一条，MySQL 需要通过派生表引用同一张表
+			if err := tx.Exec("DELETE FROM room_users WHERE id NOT IN (SELECT id FROM (SELECT MIN(id) AS id FROM room_users GROUP BY room_id, user_id) AS keep)").Error; err != nil {
+				return err
+			}
+			return tx.Migrator().CreateIndex(&roomUser0013{}, "idx_room_users_room_user")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropIndex(&roomUser0013{}, "idx_room_users_room_user")
+		},
+	})
+}
+
+type roomUser0013 struct {
+	Id     uint `gorm:"primarykey"`
+	RoomId uint `gorm:"not null;uniqueIndex:idx_room_users_room_user,priority:1"`
+	UserId uint `gorm:"not null;uniqueIndex:idx_room_users_room_user,priority:2"`
+}
+
+func (*roomUser0013) TableName() string { return "room_users" }
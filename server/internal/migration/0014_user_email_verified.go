@@ -0,0 +1,33 @@
+package migration
+
+import "gorm.io/gorm"
+
+// 邮箱验证状态，注册时填写的邮箱需要验证码确认后才能用于登录和管理员判断
+func init() {
+	register(&Migration{
+		Version: 14,
+		Name:    "user_email_verified",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&user0014{}, "EmailVerified") {
+				return nil
+			}
+			if err := tx.Migrator().AddColumn(&user0014{}, "EmailVerified"); err != nil {
+				return err
+			}
+			// 没有密码的账号来自第三方登录或邮箱验证码登录，邮箱已经验证过
+			return tx.Model(&user0014{}).
+				Where("email <> '' AND (password_hash IS NULL OR password_hash = '')").
+				Update("email_verified", true).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&user0014{}, "EmailVerified")
+		},
+	})
+}
+
+type user0014 struct {
+	Id            uint `gorm:"primarykey"`
+	EmailVerified bool `gorm:"not null;default:false"`
+}
+
+func (*user0014) TableName() string { return "users" }
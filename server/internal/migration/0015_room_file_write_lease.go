@@ -0,0 +1,27 @@
+package migration
+
+import "gorm.io/gorm"
+
+// 文件上传的写入租约，多节点时同一时间只有一个请求写入共享存储上的文件
+func init() {
+	register(&Migration{
+		Version: 15,
+		Name:    "room_file_write_lease",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&roomFile0015{}, "WriteToken") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&roomFile0015{}, "WriteToken")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&roomFile0015{}, "WriteToken")
+		},
+	})
+}
+
+type roomFile0015 struct {
+	Id         uint   `gorm:"primarykey"`
+	WriteToken string `gorm:"size:36;not null;default:''"`
+}
+
+func (*roomFile0015) TableName() string { return "room_files" }
@@ -0,0 +1,197 @@
+// Package migration holds the versioned schema migrations of the database.
+//
+// Each migration lives in its own file named after its version and registers
+// itself from init. Migrations describe the tables with their own struct
+// snapshots instead of the entity types, so later entity changes do not alter
+// what an old migration does.
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"meeting/pkg/database"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// lockName identifies the advisory lock held while migrating
+const lockName = "met_schema_migrations"
+
+// Migration is a versioned schema change
+type Migration struct {
+	Version uint
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// Status describes a migration and when it was applied, AppliedAt is nil for pending migrations
+type Status struct {
+	*Migration
+	AppliedAt *time.Time
+}
+
+// schemaMigration records an applied migration
+type schemaMigration struct {
+	Version   uint      `gorm:"primarykey;autoIncrement:false"`
+	Name      string    `gorm:"size:255;not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+var migrations []*Migration
+
+func register(m *Migration) {
+	migrations = append(migrations, m)
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+}
+
+// Up applies every pending migration in version order and returns the applied ones
+func Up(ctx context.Context) ([]*Migration, error) {
+	var done []*Migration
+	err := withLock(ctx, func(db *gorm.DB) error {
+		applied, err := appliedVersions(db)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := m.Up(tx); err != nil {
+					return err
+				}
+				return tx.Create(&schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+
+	return done, err
+}
+
+// Down reverts the latest steps applied migrations and returns the reverted ones
+func Down(ctx context.Context, steps int) ([]*Migration, error) {
+	var done []*Migration
+	err := withLock(ctx, func(db *gorm.DB) error {
+		applied, err := appliedVersions(db)
+		if err != nil {
+			return err
+		}
+		for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := m.Down(tx); err != nil {
+					return err
+				}
+				return tx.Delete(&schemaMigration{Version: m.Version}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+
+	return done, err
+}
+
+// Statuses lists every known migration with the time it was applied
+func Statuses(ctx context.Context) ([]Status, error) {
+	applied, err := appliedVersions(database.DB(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(migrations))
+	for i, m := range migrations {
+		statuses[i] = Status{Migration: m}
+		if r, ok := applied[m.Version]; ok {
+			statuses[i].AppliedAt = &r.AppliedAt
+		}
+	}
+
+	return statuses, nil
+}
+
+// Pending returns the migrations that have not been applied yet
+func Pending(ctx context.Context) ([]*Migration, error) {
+	statuses, err := Statuses(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []*Migration
+	for _, s := range statuses {
+		if s.AppliedAt == nil {
+			pending = append(pending, s.Migration)
+		}
+	}
+
+	return pending, nil
+}
+
+// appliedVersions loads the schema table, it is created on first use
+func appliedVersions(db *gorm.DB) (map[uint]schemaMigration, error) {
+	if err := database.TableOptions(db).AutoMigrate(&schemaMigration{}); err != nil {
+		return nil, err
+	}
+
+	var records []schemaMigration
+	if err := db.Find(&records).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[uint]schemaMigration, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+
+	return applied, nil
+}
+
+// withLock runs fn on a single connection holding a database wide lock, so
+// instances migrating at the same time apply each migration once
+func withLock(ctx context.Context, fn func(db *gorm.DB) error) error {
+	return database.DB(ctx).Connection(func(tx *gorm.DB) error {
+		// 每次调用都从新的语句开始，避免条件在同一连接上累积
+		db := tx.Session(&gorm.Session{NewDB: true})
+		switch db.Dialector.Name() {
+		case database.DriverMySQL:
+			var got int
+			if err := db.Raw("SELECT GET_LOCK(?, 60)", lockName).Scan(&got).Error; err != nil {
+				return err
+			}
+			if got != 1 {
+				return errors.New("timeout waiting for the migration lock")
+			}
+			defer db.Exec("SELECT RELEASE_LOCK(?)", lockName)
+		case database.DriverPostgres:
+			key := int64(crc32.ChecksumIEEE([]byte(lockName)))
+			if err := db.Exec("SELECT pg_advisory_lock(?)", key).Error; err != nil {
+				return err
+			}
+			defer db.Exec("SELECT pg_advisory_unlock(?)", key)
+		}
+		// SQLite 写入时锁定整个数据库文件，无需额外加锁
+
+		return fn(db)
+	})
+}
@@ -0,0 +1,137 @@
+package entity
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ApiTokenPrefix marks the tokens issued by met so leaked tokens are easy to recognize
+const ApiTokenPrefix = "met_"
+
+// Scope limits the api routes a token may call
+type Scope string
+
+const (
+	ScopeProfileRead    Scope = "profile:read"    // 读取当前用户
+	ScopeRoomsRead      Scope = "rooms:read"      // 读取房间、日程和邀请
+	ScopeRoomsWrite     Scope = "rooms:write"     // 创建、修改、删除和加入房间
+	ScopeMembersRead    Scope = "members:read"    // 读取房间成员
+	ScopeMembersWrite   Scope = "members:write"   // 踢出、拉黑、准入成员和设置角色
+	ScopeMessagesRead   Scope = "messages:read"   // 读取聊天记录
+	ScopeMeetingsJoin   Scope = "meetings:join"   // 获取加入会议的签名
+	ScopeMonitoringRead Scope = "monitoring:read" // 读取系统监控，需要管理员
+	ScopeWebhooksRead   Scope = "webhooks:read"   // 读取 Webhook 和投递记录
+	ScopeWebhooksWrite  Scope = "webhooks:write"  // 创建、修改和删除 Webhook
+
+	ScopeRecordingsRead  Scope = "recordings:read"  // 读取和下载录制文件
+	ScopeRecordingsWrite Scope = "recordings:write" // 删除录制
+	ScopeFilesRead       Scope = "files:read"       // 读取和下载聊天文件
+	ScopeFilesWrite      Scope = "files:write"      // 上传和删除聊天文件
+)
+
+// Scopes 全部可以授予的权限
+var Scopes = []Scope{
+	ScopeProfileRead,
+	ScopeRoomsRead,
+	ScopeRoomsWrite,
+	ScopeMembersRead,
+	ScopeMembersWrite,
+	ScopeMessagesRead,
+	ScopeMeetingsJoin,
+	ScopeMonitoringRead,
+	ScopeWebhooksRead,
+	ScopeWebhooksWrite,
+	ScopeRecordingsRead,
+	ScopeRecordingsWrite,
+	ScopeFilesRead,
+	ScopeFilesWrite,
+}
+
+// ApiToken 个人访问令牌和服务账号凭据，只保存令牌的哈希
+type ApiToken struct {
+	Id uint `gorm:"primarykey" json:"id"`
+	// UserId 为令牌代表的用户，服务账号的令牌为服务账号用户
+	UserId    uint   `gorm:"not null;index" json:"-"`
+	CreatedBy uint   `gorm:"not null;index" json:"-"`
+	Name      string `gorm:"size:100;not null" json:"name"`
+	// Prefix 为令牌开头的几个字符，用于在列表中辨认令牌
+	Prefix     string     `gorm:"size:16;not null" json:"prefix"`
+	TokenHash  string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	Scopes     string     `gorm:"size:500;not null;default:''" json:"-"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+
+	// 关联关系
+	User *User `gorm:"foreignKey:UserId" json:"user,omitempty"`
+}
+
+// TableName 指定表名
+func (t *ApiToken) TableName() string {
+	return "api_tokens"
+}
+
+// NewApiToken returns a random token and its hash
+func NewApiToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = ApiTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	return token, HashApiToken(token), nil
+}
+
+// HashApiToken returns the stored form of a token
+func HashApiToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseScopes validates scope names and removes duplicates
+func ParseScopes(names []string) ([]Scope, bool) {
+	scopes := make([]Scope, 0, len(names))
+	for _, name := range names {
+		scope := Scope(name)
+		if !slices.Contains(Scopes, scope) {
+			return nil, false
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	slices.Sort(scopes)
+
+	return scopes, true
+}
+
+// SetScopes stores the scopes separated by spaces
+func (t *ApiToken) SetScopes(scopes []Scope) {
+	names := make([]string, len(scopes))
+	for i, s := range scopes {
+		names[i] = string(s)
+	}
+	t.Scopes = strings.Join(names, " ")
+}
+
+// ScopeList returns the scopes granted to the token
+func (t *ApiToken) ScopeList() []string {
+	return strings.Fields(t.Scopes)
+}
+
+// HasScope reports whether the token grants the scope
+func (t *ApiToken) HasScope(scope Scope) bool {
+	return slices.Contains(t.ScopeList(), string(scope))
+}
+
+// IsActive reports whether the token can still be used
+func (t *ApiToken) IsActive(now time.Time) bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || now.Before(*t.ExpiresAt))
+}
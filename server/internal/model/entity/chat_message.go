@@ -0,0 +1,26 @@
+package entity
+
+import (
+	"time"
+)
+
+// ChatMessage 房间聊天记录
+type ChatMessage struct {
+	Id         uint      `gorm:"primarykey" json:"id"`
+	RoomId     uint      `gorm:"not null;index:idx_chat_messages_room_created,priority:1" json:"-"`
+	MessageId  string    `gorm:"size:64;not null;default:''" json:"messageId"` // 客户端生成的消息 id
+	UserUuid   string    `gorm:"type:char(36);not null" json:"userUuid"`
+	UserName   string    `gorm:"not null;default:'';size:100" json:"userName"`
+	UserAvatar string    `gorm:"size:500" json:"userAvatar"`
+	Content    string    `gorm:"type:text;not null" json:"content"`
+	FileUuid   string    `gorm:"size:36;not null;default:''" json:"fileUuid,omitempty"` // 分享文件的消息关联的文件
+	CreatedAt  time.Time `gorm:"index:idx_chat_messages_room_created,priority:2" json:"created_at"`
+
+	Room *Room     `gorm:"foreignKey:RoomId" json:"room,omitempty"`
+	File *RoomFile `gorm:"foreignKey:FileUuid;references:Uuid" json:"file,omitempty"`
+}
+
+// TableName 指定表名
+func (m *ChatMessage) TableName() string {
+	return "chat_messages"
+}
@@ -0,0 +1,40 @@
+package entity
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"time"
+)
+
+// LoginCode 邮箱登录验证码，只保存验证码的哈希
+type LoginCode struct {
+	Id         uint      `gorm:"primarykey"`
+	Email      string    `gorm:"size:255;not null;index"`
+	CodeHash   string    `gorm:"size:64;not null"`
+	Attempts   int       `gorm:"not null;default:0"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	ConsumedAt *time.Time
+	CreatedAt  time.Time
+}
+
+// TableName 指定表名
+func (lc *LoginCode) TableName() string {
+	return "login_codes"
+}
+
+// HashLoginCode returns the stored form of a login code
+func HashLoginCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// Check reports whether code matches
+func (lc *LoginCode) Check(code string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashLoginCode(code)), []byte(lc.CodeHash)) == 1
+}
+
+// IsUsable reports whether the code can still be used to log in
+func (lc *LoginCode) IsUsable(now time.Time, maxAttempts int) bool {
+	return lc.ConsumedAt == nil && now.Before(lc.ExpiresAt) && lc.Attempts < maxAttempts
+}
@@ -0,0 +1,71 @@
+package entity
+
+import (
+	"time"
+)
+
+// MeetingSession 一次会议，从第一人加入到最后一人离开
+type MeetingSession struct {
+	Id        uint       `gorm:"primarykey" json:"id"`
+	RoomId    uint       `gorm:"not null;index" json:"-"`
+	StartedAt time.Time  `gorm:"not null" json:"startedAt"`
+	EndedAt   *time.Time `gorm:"index" json:"endedAt,omitempty"`
+	MaxOnline int        `gorm:"not null;default:0" json:"maxOnline"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+
+	// 关联关系
+	Attendances []*MeetingAttendance `gorm:"foreignKey:SessionId" json:"-"`
+}
+
+// TableName 指定表名
+func (s *MeetingSession) TableName() string {
+	return "meeting_sessions"
+}
+
+// Duration returns the length of the session, ongoing sessions are measured until now
+func (s *MeetingSession) Duration(now time.Time) time.Duration {
+	if s.EndedAt != nil {
+		return s.EndedAt.Sub(s.StartedAt)
+	}
+	return now.Sub(s.StartedAt)
+}
+
+// MeetingAttendance 参会记录，同一会议中每个用户一条
+type MeetingAttendance struct {
+	Id        uint   `gorm:"primarykey" json:"-"`
+	SessionId uint   `gorm:"not null;uniqueIndex:idx_meeting_attendances_session_user,priority:1" json:"-"`
+	RoomId    uint   `gorm:"not null;index" json:"-"`
+	UserUuid  string `gorm:"size:36;not null;uniqueIndex:idx_meeting_attendances_session_user,priority:2" json:"userId"`
+	UserName  string `gorm:"size:100;not null" json:"name"`
+	// JoinedAt 为首次加入时间，LeftAt 为最后一次离开时间
+	JoinedAt time.Time  `gorm:"not null" json:"joinedAt"`
+	LeftAt   *time.Time `json:"leftAt,omitempty"`
+	// OnlineSince 为本次加入的时间，离开后为空
+	OnlineSince *time.Time `json:"-"`
+	// DurationSeconds 为已离开的各段在线时长之和
+	DurationSeconds int64 `gorm:"not null;default:0" json:"-"`
+	// Reconnects 为离开后重新加入和断线恢复的次数
+	Reconnects int       `gorm:"not null;default:0" json:"reconnects"`
+	CreatedAt  time.Time `json:"-"`
+	UpdatedAt  time.Time `json:"-"`
+}
+
+// TableName 指定表名
+func (a *MeetingAttendance) TableName() string {
+	return "meeting_attendances"
+}
+
+// IsOnline reports whether the user is still in the meeting
+func (a *MeetingAttendance) IsOnline() bool {
+	return a.OnlineSince != nil
+}
+
+// Duration returns the total time in the meeting, including the current stay
+func (a *MeetingAttendance) Duration(now time.Time) time.Duration {
+	d := time.Duration(a.DurationSeconds) * time.Second
+	if a.OnlineSince != nil {
+		d += now.Sub(*a.OnlineSince)
+	}
+	return d
+}
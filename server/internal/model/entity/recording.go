@@ -0,0 +1,75 @@
+package entity
+
+import (
+	"path/filepath"
+	"time"
+)
+
+// 录制状态
+const (
+	RecordingStatusRecording = "recording"
+	RecordingStatusCompleted = "completed"
+	RecordingStatusFailed    = "failed"
+)
+
+// 录制文件的媒体类型
+const (
+	RecordingKindAudio = "audio"
+	RecordingKindVideo = "video"
+)
+
+// Recording 一次服务端录制，从主持人开始录制到停止录制
+type Recording struct {
+	Id        uint       `gorm:"primarykey" json:"-"`
+	Uuid      string     `gorm:"size:36;not null;uniqueIndex" json:"id"`
+	RoomId    uint       `gorm:"not null;index" json:"-"`
+	StartedBy uint       `gorm:"not null" json:"-"`
+	Status    string     `gorm:"size:20;not null;default:recording" json:"status"`
+	StartedAt time.Time  `gorm:"not null" json:"startedAt"`
+	StoppedAt *time.Time `json:"stoppedAt,omitempty"`
+	// Size 为全部文件的字节数，停止录制后计算
+	Size      int64     `gorm:"not null;default:0" json:"size"`
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"-"`
+
+	// 关联关系
+	Files   []*RecordingFile `gorm:"foreignKey:RecordingId" json:"files,omitempty"`
+	Starter *User            `gorm:"foreignKey:StartedBy" json:"-"`
+}
+
+// TableName 指定表名
+func (r *Recording) TableName() string {
+	return "recordings"
+}
+
+// Dir returns the directory holding the files of the recording under the storage root
+func (r *Recording) Dir(root, roomUuid string) string {
+	return filepath.Join(root, roomUuid, r.Uuid)
+}
+
+// IsFinished reports whether the files of the recording are complete
+func (r *Recording) IsFinished() bool {
+	return r.Status != RecordingStatusRecording
+}
+
+// RecordingFile 录制中一个成员的一条音频或视频轨道
+type RecordingFile struct {
+	Id              uint   `gorm:"primarykey" json:"id"`
+	RecordingId     uint   `gorm:"not null;index" json:"-"`
+	ParticipantUuid string `gorm:"size:36;not null" json:"participantId"`
+	ParticipantName string `gorm:"size:100;not null" json:"participantName"`
+	Kind            string `gorm:"size:10;not null" json:"kind"`
+	Codec           string `gorm:"size:50;not null" json:"codec"`
+	// Name 为录制目录下的文件名
+	Name      string     `gorm:"size:200;not null" json:"name"`
+	Size      int64      `gorm:"not null;default:0" json:"size"`
+	StartedAt time.Time  `gorm:"not null" json:"startedAt"`
+	EndedAt   *time.Time `json:"endedAt,omitempty"`
+	CreatedAt time.Time  `json:"-"`
+	UpdatedAt time.Time  `json:"-"`
+}
+
+// TableName 指定表名
+func (f *RecordingFile) TableName() string {
+	return "recording_files"
+}
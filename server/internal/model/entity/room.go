@@ -3,15 +3,138 @@ package entity
 import (
 	"time"
 
+	"golang.org/x/crypto/bcrypt"
+
 	"gorm.io/gorm"
 )
 
+const (
+	RoomModeMesh = "mesh" // 客户端之间直接建立连接
+	RoomModeSFU  = "sfu"  // 媒体经由服务端转发
+)
+
+const (
+	RecurrenceNone   = ""
+	RecurrenceDaily  = "daily"
+	RecurrenceWeekly = "weekly"
+)
+
 type Room struct {
-	Id        uint           `gorm:"primarykey" json:"-"`
-	Uuid      string         `gorm:"type:char(36);uniqueIndex;not null" json:"uuid"`
-	Name      string         `gorm:"not null;default:'';size:100;charset:utf8mb4;collate:utf8mb4_unicode_ci" json:"name"`
-	Password  string         `gorm:"size:255" json:"password"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+	Id   uint   `gorm:"primarykey" json:"-"`
+	Uuid string `gorm:"type:char(36);uniqueIndex;not null" json:"uuid"`
+	Name string `gorm:"not null;default:'';size:100" json:"name"`
+	// Password 为 bcrypt 哈希，不会返回给客户端
+	Password string `gorm:"size:255" json:"-"`
+	Mode     string `gorm:"size:20;not null;default:'mesh'" json:"mode"`
+	// 开启后非主持人需要在等候室等待主持人准入
+	Lobby bool `gorm:"not null;default:false" json:"lobby"`
+	// 会议时间，为空表示随时可以加入
+	StartAt         *time.Time     `json:"start_at"`
+	EndAt           *time.Time     `json:"end_at"`
+	Recurrence      string         `gorm:"size:20;not null;default:''" json:"recurrence"`
+	RecurrenceUntil *time.Time     `json:"recurrence_until"`
+	TimeZone        string         `gorm:"size:64;not null;default:''" json:"time_zone"` // IANA 时区，重复会议按当地时间重复
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+}
+
+// IsScheduled 判断是否为预约会议
+func (r *Room) IsScheduled() bool {
+	return r.StartAt != nil
+}
+
+// Location returns the time zone of the schedule, UTC when it is not set or unknown
+func (r *Room) Location() *time.Location {
+	if r.TimeZone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(r.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// OccurrenceAt returns the occurrence of the meeting that is open at t, grace allows joining
+// before the start. Unscheduled rooms are always open and return zero times.
+func (r *Room) OccurrenceAt(t time.Time, grace time.Duration) (start, end time.Time, ok bool) {
+	if !r.IsScheduled() {
+		return time.Time{}, time.Time{}, true
+	}
+
+	start = *r.StartAt
+	if r.TimeZone != "" {
+		// 在会议时区中按日期重复
+		start = start.In(r.Location())
+	}
+	var duration time.Duration
+	if r.EndAt != nil {
+		duration = r.EndAt.Sub(start)
+	}
+
+	// 找到不晚于 t+grace 的最近一次会议
+	joinAt := t.Add(grace)
+	switch r.Recurrence {
+	case RecurrenceDaily, RecurrenceWeekly:
+		days := 1
+		if r.Recurrence == RecurrenceWeekly {
+			days = 7
+		}
+		if n := int(joinAt.Sub(start).Hours()/24) / days; n > 0 {
+			start = start.AddDate(0, 0, n*days)
+		}
+		// 夏令时等原因可能导致估算偏差，逐次修正
+		for start.After(joinAt) && start.After(*r.StartAt) {
+			start = start.AddDate(0, 0, -days)
+		}
+		for next := start.AddDate(0, 0, days); !next.After(joinAt); next = start.AddDate(0, 0, days) {
+			start = next
+		}
+		if r.RecurrenceUntil != nil && start.After(*r.RecurrenceUntil) {
+			return time.Time{}, time.Time{}, false
+		}
+	}
+
+	if joinAt.Before(start) {
+		return time.Time{}, time.Time{}, false
+	}
+	if r.EndAt != nil {
+		end = start.Add(duration)
+		if !t.Before(end) {
+			return time.Time{}, time.Time{}, false
+		}
+	}
+
+	return start, end, true
+}
+
+// HasPassword 判断房间是否设置了密码
+func (r *Room) HasPassword() bool {
+	return r.Password != ""
+}
+
+// SetPassword stores the bcrypt hash of password, an empty password removes it
+func (r *Room) SetPassword(password string) error {
+	if password == "" {
+		r.Password = ""
+		return nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	r.Password = string(hash)
+
+	return nil
+}
+
+// CheckPassword reports whether password matches, rooms without a password accept any input
+func (r *Room) CheckPassword(password string) bool {
+	if !r.HasPassword() {
+		return true
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(r.Password), []byte(password)) == nil
 }
@@ -0,0 +1,55 @@
+package entity
+
+import (
+	"path/filepath"
+	"time"
+)
+
+// 文件上传状态
+const (
+	RoomFileStatusUploading = "uploading"
+	RoomFileStatusCompleted = "completed"
+)
+
+// RoomFile 经服务端中转、在聊天中分享的文件，支持断点续传
+type RoomFile struct {
+	Id         uint   `gorm:"primarykey" json:"-"`
+	Uuid       string `gorm:"size:36;not null;uniqueIndex" json:"id"`
+	RoomId     uint   `gorm:"not null;index" json:"-"`
+	UploadedBy uint   `gorm:"not null" json:"-"`
+	Name       string `gorm:"size:255;not null" json:"name"`
+	MimeType   string `gorm:"size:100;not null;default:''" json:"mimeType"`
+	// Size 为创建上传时声明的大小，Received 为已经收到的字节数
+	Size      int64     `gorm:"not null" json:"size"`
+	Received  int64     `gorm:"not null;default:0" json:"offset"`
+	Status    string    `gorm:"size:20;not null;default:uploading" json:"status"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expiresAt"`
+	// WriteToken 为正在写入内容的请求持有的租约，写入期间定时刷新 UpdatedAt
+	WriteToken string    `gorm:"size:36;not null;default:''" json:"-"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"-"`
+
+	// 关联关系
+	Room     *Room `gorm:"foreignKey:RoomId" json:"-"`
+	Uploader *User `gorm:"foreignKey:UploadedBy" json:"-"`
+}
+
+// TableName 指定表名
+func (f *RoomFile) TableName() string {
+	return "room_files"
+}
+
+// Path returns the location of the file content under the storage root
+func (f *RoomFile) Path(root, roomUuid string) string {
+	return filepath.Join(root, roomUuid, f.Uuid)
+}
+
+// IsCompleted reports whether every byte of the file has been received
+func (f *RoomFile) IsCompleted() bool {
+	return f.Status == RoomFileStatusCompleted
+}
+
+// IsExpired reports whether the file is due for removal
+func (f *RoomFile) IsExpired() bool {
+	return !f.ExpiresAt.After(time.Now())
+}
@@ -0,0 +1,59 @@
+package entity
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+	"time"
+)
+
+// RoomInvite 房间邀请链接，兑换后成为房间成员
+type RoomInvite struct {
+	Id     uint   `gorm:"primarykey" json:"-"`
+	RoomId uint   `gorm:"not null;index" json:"-"`
+	Code   string `gorm:"size:32;not null;uniqueIndex" json:"code"`
+	// 兑换后分配的角色
+	Role Role `gorm:"not null;default:2" json:"role"`
+	// 最多兑换次数，0 表示不限
+	MaxUses   int        `gorm:"not null;default:0" json:"max_uses"`
+	Uses      int        `gorm:"not null;default:0" json:"uses"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedBy uint       `gorm:"not null" json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+
+	// 关联关系
+	Room    *Room `gorm:"foreignKey:RoomId" json:"room,omitempty"`
+	Creator *User `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
+}
+
+// TableName 指定表名
+func (ri *RoomInvite) TableName() string {
+	return "room_invites"
+}
+
+// NewInviteCode returns a random code for a room invite
+func NewInviteCode() (string, error) {
+	b := make([]byte, 15)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)), nil
+}
+
+// IsExpired 判断邀请是否过期
+func (ri *RoomInvite) IsExpired(now time.Time) bool {
+	return ri.ExpiresAt != nil && !now.Before(*ri.ExpiresAt)
+}
+
+// IsExhausted 判断邀请是否已达到兑换次数上限
+func (ri *RoomInvite) IsExhausted() bool {
+	return ri.MaxUses > 0 && ri.Uses >= ri.MaxUses
+}
+
+// IsUsable reports whether the invite can still be redeemed
+func (ri *RoomInvite) IsUsable(now time.Time) bool {
+	return ri.RevokedAt == nil && !ri.IsExpired(now) && !ri.IsExhausted()
+}
@@ -0,0 +1,22 @@
+package entity
+
+import (
+	"time"
+)
+
+// RoomInvitee 预约会议的受邀用户
+type RoomInvitee struct {
+	Id        uint      `gorm:"primarykey" json:"-"`
+	RoomId    uint      `gorm:"not null;uniqueIndex:idx_room_invitees_room_user,priority:1" json:"room_id"`
+	UserId    uint      `gorm:"not null;uniqueIndex:idx_room_invitees_room_user,priority:2;index" json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// 关联关系
+	Room *Room `gorm:"foreignKey:RoomId" json:"room,omitempty"`
+	User *User `gorm:"foreignKey:UserId" json:"user,omitempty"`
+}
+
+// TableName 指定表名
+func (ri *RoomInvitee) TableName() string {
+	return "room_invitees"
+}
@@ -0,0 +1,141 @@
+package entity
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRoomOccurrenceAt(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	ptr := func(s string) *time.Time {
+		v := at(s)
+		return &v
+	}
+	const grace = 10 * time.Minute
+
+	tests := []struct {
+		name  string
+		room  Room
+		t     string
+		ok    bool
+		start string
+		end   string
+	}{
+		{
+			name: "unscheduled",
+			room: Room{},
+			t:    "2026-05-01T10:00:00Z",
+			ok:   true,
+		},
+		{
+			name: "before the grace window",
+			room: Room{StartAt: ptr("2026-05-01T10:00:00Z"), EndAt: ptr("2026-05-01T11:00:00Z")},
+			t:    "2026-05-01T09:49:59Z",
+		},
+		{
+			name:  "within the grace window",
+			room:  Room{StartAt: ptr("2026-05-01T10:00:00Z"), EndAt: ptr("2026-05-01T11:00:00Z")},
+			t:     "2026-05-01T09:50:00Z",
+			ok:    true,
+			start: "2026-05-01T10:00:00Z",
+			end:   "2026-05-01T11:00:00Z",
+		},
+		{
+			name: "after the end",
+			room: Room{StartAt: ptr("2026-05-01T10:00:00Z"), EndAt: ptr("2026-05-01T11:00:00Z")},
+			t:    "2026-05-01T11:00:00Z",
+		},
+		{
+			name:  "no end",
+			room:  Room{StartAt: ptr("2026-05-01T10:00:00Z")},
+			t:     "2026-06-01T00:00:00Z",
+			ok:    true,
+			start: "2026-05-01T10:00:00Z",
+		},
+		{
+			name:  "daily without end opens at the latest occurrence",
+			room:  Room{StartAt: ptr("2026-05-01T10:00:00Z"), Recurrence: RecurrenceDaily},
+			t:     "2026-05-20T09:55:00Z",
+			ok:    true,
+			start: "2026-05-20T10:00:00Z",
+		},
+		{
+			name: "daily before the first occurrence",
+			room: Room{StartAt: ptr("2026-05-01T10:00:00Z"), EndAt: ptr("2026-05-01T11:00:00Z"), Recurrence: RecurrenceDaily},
+			t:    "2026-04-30T10:30:00Z",
+		},
+		{
+			name: "daily between occurrences",
+			room: Room{StartAt: ptr("2026-05-01T10:00:00Z"), EndAt: ptr("2026-05-01T11:00:00Z"), Recurrence: RecurrenceDaily},
+			t:    "2026-05-03T12:00:00Z",
+		},
+		{
+			// 09:00 EST 为 14:00 UTC，夏令时开始后 09:00 EDT 为 13:00 UTC
+			name:  "weekly across the start of daylight saving time",
+			room:  Room{StartAt: ptr("2026-03-02T14:00:00Z"), EndAt: ptr("2026-03-02T15:00:00Z"), Recurrence: RecurrenceWeekly, TimeZone: "America/New_York"},
+			t:     "2026-03-09T12:55:00Z",
+			ok:    true,
+			start: "2026-03-09T13:00:00Z",
+			end:   "2026-03-09T14:00:00Z",
+		},
+		{
+			name: "weekly ends at the local time after daylight saving time starts",
+			room: Room{StartAt: ptr("2026-03-02T14:00:00Z"), EndAt: ptr("2026-03-02T15:00:00Z"), Recurrence: RecurrenceWeekly, TimeZone: "America/New_York"},
+			t:    "2026-03-09T14:30:00Z",
+		},
+		{
+			// 09:00 EDT 为 13:00 UTC，夏令时结束后 09:00 EST 为 14:00 UTC
+			name: "daily before the local time after daylight saving time ends",
+			room: Room{StartAt: ptr("2026-10-26T13:00:00Z"), EndAt: ptr("2026-10-26T14:00:00Z"), Recurrence: RecurrenceDaily, TimeZone: "America/New_York"},
+			t:    "2026-11-02T13:30:00Z",
+		},
+		{
+			name:  "daily at the local time after daylight saving time ends",
+			room:  Room{StartAt: ptr("2026-10-26T13:00:00Z"), EndAt: ptr("2026-10-26T14:00:00Z"), Recurrence: RecurrenceDaily, TimeZone: "America/New_York"},
+			t:     "2026-11-02T13:55:00Z",
+			ok:    true,
+			start: "2026-11-02T14:00:00Z",
+			end:   "2026-11-02T15:00:00Z",
+		},
+		{
+			name:  "last occurrence before recurrence until",
+			room:  Room{StartAt: ptr("2026-05-01T10:00:00Z"), EndAt: ptr("2026-05-01T11:00:00Z"), Recurrence: RecurrenceDaily, RecurrenceUntil: ptr("2026-05-05T23:59:59Z")},
+			t:     "2026-05-05T10:30:00Z",
+			ok:    true,
+			start: "2026-05-05T10:00:00Z",
+			end:   "2026-05-05T11:00:00Z",
+		},
+		{
+			name: "after recurrence until",
+			room: Room{StartAt: ptr("2026-05-01T10:00:00Z"), EndAt: ptr("2026-05-01T11:00:00Z"), Recurrence: RecurrenceDaily, RecurrenceUntil: ptr("2026-05-05T23:59:59Z")},
+			t:    "2026-05-06T10:30:00Z",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, ok := tt.room.OccurrenceAt(at(tt.t), grace)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			var wantStart, wantEnd time.Time
+			if tt.start != "" {
+				wantStart = at(tt.start)
+			}
+			if tt.end != "" {
+				wantEnd = at(tt.end)
+			}
+			if !start.Equal(wantStart) || !end.Equal(wantEnd) {
+				t.Fatalf("occurrence = %s - %s, want %s - %s", start, end, wantStart, wantEnd)
+			}
+		})
+	}
+}
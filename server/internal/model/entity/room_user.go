@@ -1,9 +1,12 @@
 package entity
 
 import (
-	"gorm.io/gorm"
+	"fmt"
 	"math"
+	"slices"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type Role uint8
@@ -11,10 +14,10 @@ type Role uint8
 // RoomUser 房间用户关联表
 type RoomUser struct {
 	Id        uint           `gorm:"primarykey" json:"-"`
-	RoomId    uint           `gorm:"not null;index" json:"room_id"`
-	UserId    uint           `gorm:"not null;index" json:"user_id"`
-	Role      Role           `gorm:"type:varchar(20);not null;default:2" json:"role"`
-	Blocked   bool           `gorm:"type:varchar(20);not null;default:false" json:"blocked"`
+	RoomId    uint           `gorm:"not null;index;uniqueIndex:idx_room_users_room_user,priority:1" json:"room_id"`
+	UserId    uint           `gorm:"not null;index;uniqueIndex:idx_room_users_room_user,priority:2" json:"user_id"`
+	Role      Role           `gorm:"not null;default:2" json:"role"`
+	Blocked   bool           `gorm:"not null;default:false" json:"blocked"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"`
@@ -24,12 +27,84 @@ type RoomUser struct {
 	User *User `gorm:"foreignKey:UserId" json:"user,omitempty"`
 }
 
+// Role 为位图，可以用 | 组合多个角色进行判断，已有数据中 1 为房主、2 为普通成员
 const (
-	RoleHost Role = iota + 1
-	RoleUser
-	RoleAll = math.MaxUint8
+	RoleHost      Role = 1 << iota // 房主
+	RoleUser                       // 普通成员
+	RoleCoHost                     // 联席主持人
+	RolePresenter                  // 演讲者
+	RoleViewer                     // 仅观看
+	RoleGuest                      // 访客，不是房间成员
+	RoleAll       = math.MaxUint8
+
+	// RoleModerator 可以管理其他成员的角色
+	RoleModerator = RoleHost | RoleCoHost
 )
 
+var roleNames = map[Role]string{
+	RoleHost:      "host",
+	RoleCoHost:    "co-host",
+	RolePresenter: "presenter",
+	RoleUser:      "attendee",
+	RoleViewer:    "viewer",
+	RoleGuest:     "guest",
+}
+
+// String returns the name of a single role
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("role(%d)", uint8(r))
+}
+
+// ParseRole returns the role of the name
+func ParseRole(name string) (Role, bool) {
+	for role, n := range roleNames {
+		if n == name {
+			return role, true
+		}
+	}
+	return 0, false
+}
+
+// Capability is an action a role is allowed to perform in a meeting
+type Capability string
+
+const (
+	CapabilityPublish     Capability = "publish"      // 发布音视频
+	CapabilityScreenShare Capability = "screen-share" // 共享屏幕
+	CapabilityChat        Capability = "chat"         // 发送聊天消息
+	CapabilityModerate    Capability = "moderate"     // 管理其他成员
+)
+
+var roleCapabilities = map[Role][]Capability{
+	RoleHost:      {CapabilityPublish, CapabilityScreenShare, CapabilityChat, CapabilityModerate},
+	RoleCoHost:    {CapabilityPublish, CapabilityScreenShare, CapabilityChat, CapabilityModerate},
+	RolePresenter: {CapabilityPublish, CapabilityScreenShare, CapabilityChat},
+	RoleUser:      {CapabilityPublish, CapabilityChat},
+	RoleViewer:    {},
+	RoleGuest:     {CapabilityChat},
+}
+
+// Capabilities returns the capabilities granted to the roles
+func (r Role) Capabilities() []Capability {
+	capabilities := make([]Capability, 0, 4)
+	for role, granted := range roleCapabilities {
+		if r&role == 0 {
+			continue
+		}
+		for _, c := range granted {
+			if !slices.Contains(capabilities, c) {
+				capabilities = append(capabilities, c)
+			}
+		}
+	}
+	slices.Sort(capabilities)
+
+	return capabilities
+}
+
 // TableName 指定表名
 func (ru *RoomUser) TableName() string {
 	return "room_users"
@@ -40,6 +115,11 @@ func (ru *RoomUser) IsHost() bool {
 	return ru.HasRole(RoleHost)
 }
 
+// IsModerator 判断是否可以管理其他成员
+func (ru *RoomUser) IsModerator() bool {
+	return ru.HasRole(RoleModerator)
+}
+
 func (ru *RoomUser) HasRole(role Role) bool {
 	return (ru.Role & role) != 0
 }
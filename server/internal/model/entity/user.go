@@ -3,16 +3,46 @@ package entity
 import (
 	"time"
 
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 type User struct {
-	Id        uint           `gorm:"primarykey" json:"-"`
-	Uuid      string         `gorm:"type:char(36);uniqueIndex;not null" json:"uuid"`
-	Name      string         `gorm:"not null;size:100;charset:utf8mb4;collate:utf8mb4_unicode_ci" json:"name"`
-	Email     string         `gorm:"size:255;charset:utf8mb4;collate:utf8mb4_unicode_ci" json:"email"`
+	Id   uint   `gorm:"primarykey" json:"-"`
+	Uuid string `gorm:"type:char(36);uniqueIndex;not null" json:"uuid"`
+	// Username 为本地账号的登录名，第三方授权登录的用户为空
+	Username *string `gorm:"size:64;uniqueIndex" json:"username,omitempty"`
+	// PasswordHash 为 bcrypt 哈希，为空时不能使用密码登录
+	PasswordHash string `gorm:"size:255" json:"-"`
+	// EmailVerified 表示邮箱已通过验证码确认，只有已验证的邮箱可以用于登录和管理员判断
+	EmailVerified bool `gorm:"not null;default:false" json:"email_verified"`
+	// Bot 为服务账号，只能通过 API 令牌访问，OwnerId 为创建它的用户
+	Bot       bool           `gorm:"not null;default:false" json:"bot"`
+	OwnerId   *uint          `gorm:"index" json:"-"`
+	Name      string         `gorm:"not null;size:100" json:"name"`
+	Email     string         `gorm:"size:255" json:"email"`
 	Avatar    string         `gorm:"size:500" json:"avatar"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"`
 }
+
+// SetPassword stores the bcrypt hash of password
+func (u *User) SetPassword(password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.PasswordHash = string(hash)
+
+	return nil
+}
+
+// CheckPassword reports whether password matches, users without a password never match
+func (u *User) CheckPassword(password string) bool {
+	if u.PasswordHash == "" {
+		return false
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+}
@@ -0,0 +1,23 @@
+package entity
+
+import (
+	"time"
+)
+
+// UserIdentity 用户在第三方登录服务中的身份
+type UserIdentity struct {
+	Id        uint      `gorm:"primarykey" json:"-"`
+	UserId    uint      `gorm:"not null;index" json:"-"`
+	Provider  string    `gorm:"size:64;not null;uniqueIndex:idx_user_identities_provider_subject,priority:1" json:"provider"`
+	Subject   string    `gorm:"size:255;not null;uniqueIndex:idx_user_identities_provider_subject,priority:2" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// 关联关系
+	User *User `gorm:"foreignKey:UserId" json:"user,omitempty"`
+}
+
+// TableName 指定表名
+func (ui *UserIdentity) TableName() string {
+	return "user_identities"
+}
@@ -0,0 +1,130 @@
+package entity
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"slices"
+	"strings"
+	"time"
+)
+
+// WebhookEvent is the type of an event delivered to webhooks
+type WebhookEvent string
+
+const (
+	WebhookEventRoomStarted        WebhookEvent = "room.started"
+	WebhookEventRoomEnded          WebhookEvent = "room.ended"
+	WebhookEventParticipantJoined  WebhookEvent = "participant.joined"
+	WebhookEventParticipantLeft    WebhookEvent = "participant.left"
+	WebhookEventParticipantKicked  WebhookEvent = "participant.kicked"
+	WebhookEventParticipantBlocked WebhookEvent = "participant.blocked"
+	WebhookEventChatMessage        WebhookEvent = "chat.message"
+)
+
+// WebhookEvents 全部可以订阅的事件
+var WebhookEvents = []WebhookEvent{
+	WebhookEventRoomStarted,
+	WebhookEventRoomEnded,
+	WebhookEventParticipantJoined,
+	WebhookEventParticipantLeft,
+	WebhookEventParticipantKicked,
+	WebhookEventParticipantBlocked,
+	WebhookEventChatMessage,
+}
+
+// 投递状态
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// Webhook 事件订阅，RoomId 为空时订阅全部房间（仅管理员可以创建）
+type Webhook struct {
+	Id     uint   `gorm:"primarykey" json:"id"`
+	RoomId *uint  `gorm:"index" json:"-"`
+	Url    string `gorm:"size:500;not null" json:"url"`
+	// Secret 用于对请求体签名，只在创建时返回
+	Secret string `gorm:"size:100;not null" json:"-"`
+	// Events 为空格分隔的事件，为空时订阅全部事件
+	Events    string    `gorm:"size:500;not null;default:''" json:"-"`
+	Active    bool      `gorm:"not null;default:true" json:"active"`
+	CreatedBy uint      `gorm:"not null" json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// TableName 指定表名
+func (w *Webhook) TableName() string {
+	return "webhooks"
+}
+
+// NewWebhookSecret returns a random signing secret
+func NewWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// ParseWebhookEvents validates event names and removes duplicates
+func ParseWebhookEvents(names []string) ([]WebhookEvent, bool) {
+	events := make([]WebhookEvent, 0, len(names))
+	for _, name := range names {
+		event := WebhookEvent(name)
+		if !slices.Contains(WebhookEvents, event) {
+			return nil, false
+		}
+		if !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+	slices.Sort(events)
+
+	return events, true
+}
+
+// SetEvents stores the subscribed events separated by spaces
+func (w *Webhook) SetEvents(events []WebhookEvent) {
+	names := make([]string, len(events))
+	for i, e := range events {
+		names[i] = string(e)
+	}
+	w.Events = strings.Join(names, " ")
+}
+
+// EventList returns the subscribed events, empty means all events
+func (w *Webhook) EventList() []string {
+	return strings.Fields(w.Events)
+}
+
+// Subscribes reports whether the webhook receives the event
+func (w *Webhook) Subscribes(event WebhookEvent) bool {
+	events := w.EventList()
+	return len(events) == 0 || slices.Contains(events, string(event))
+}
+
+// WebhookDelivery 一次事件投递及其重试结果
+type WebhookDelivery struct {
+	Id        uint   `gorm:"primarykey" json:"id"`
+	WebhookId uint   `gorm:"not null;index" json:"-"`
+	EventId   string `gorm:"size:36;not null;index" json:"eventId"`
+	Event     string `gorm:"size:50;not null" json:"event"`
+	Payload   string `gorm:"type:text;not null" json:"payload"`
+	Status    string `gorm:"size:20;not null;index" json:"status"`
+	Attempts  int    `gorm:"not null;default:0" json:"attempts"`
+	// NextAttemptAt 为下次投递时间，投递中时为租约到期时间
+	NextAttemptAt *time.Time `gorm:"index" json:"nextAttemptAt,omitempty"`
+	// ResponseStatus 和 Error 为最后一次投递的结果
+	ResponseStatus int        `json:"responseStatus"`
+	Error          string     `gorm:"size:500" json:"error"`
+	DeliveredAt    *time.Time `json:"deliveredAt,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+}
+
+// TableName 指定表名
+func (d *WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
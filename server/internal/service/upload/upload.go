@@ -0,0 +1,215 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"meeting/internal/model/entity"
+	"meeting/pkg/config"
+	"meeting/pkg/database"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// sweepInterval is how often expired files are removed
+	sweepInterval = 10 * time.Minute
+	// leaseHeartbeat is how often a request writing an upload refreshes its lease
+	leaseHeartbeat = 10 * time.Second
+)
+
+var (
+	once   sync.Once
+	cancel context.CancelFunc
+	done   = make(chan struct{})
+)
+
+// InitializeUpload starts removing expired files in the background
+func InitializeUpload() {
+	once.Do(func() {
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		go run(ctx)
+	})
+}
+
+// Close stops the background removal
+func Close() {
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+// Path returns the location of the file content
+func Path(f *entity.RoomFile, roomUuid string) string {
+	return f.Path(config.GetConfig().Upload.Dir, roomUuid)
+}
+
+var (
+	// ErrBusy is returned by Acquire when another request writes the upload or the offset is not the received size
+	ErrBusy = errors.New("upload is busy or the offset does not match")
+	// ErrLeaseLost is returned when the lease expired and another request may write the upload
+	ErrLeaseLost = errors.New("upload write lease lost")
+)
+
+// Lease is the right to write an upload from its received size, it is taken in the database so
+// that one request of any node at a time writes the file on the shared storage
+type Lease struct {
+	file  *entity.RoomFile
+	token string
+	lost  atomic.Bool
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// Acquire takes the write lease of an upload if offset is its received size, a lease not refreshed
+// for 3 heartbeats is left by a request that died and is taken over
+func Acquire(ctx context.Context, f *entity.RoomFile, offset int64) (*Lease, error) {
+	l := &Lease{file: f, token: uuid.New().String(), stop: make(chan struct{}), done: make(chan struct{})}
+	res := database.DB(ctx).Model(&entity.RoomFile{}).
+		Where("id = ? AND status = ? AND received = ? AND (write_token = '' OR updated_at < ?)",
+			f.Id, entity.RoomFileStatusUploading, offset, time.Now().Add(-3*leaseHeartbeat)).
+		Update("write_token", l.token)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrBusy
+	}
+
+	go l.heartbeat()
+	return l, nil
+}
+
+// heartbeat refreshes the lease until Release, writes fail once it is lost
+func (l *Lease) heartbeat() {
+	defer close(l.done)
+	ticker := time.NewTicker(leaseHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+		res := database.DB(context.Background()).Model(&entity.RoomFile{}).
+			Where("id = ? AND write_token = ?", l.file.Id, l.token).Update("updated_at", time.Now())
+		if res.Error == nil && res.RowsAffected == 0 {
+			l.lost.Store(true)
+			return
+		}
+	}
+}
+
+// Writer wraps the file being written, it stops writing once the lease is lost
+func (l *Lease) Writer(w io.Writer) io.Writer {
+	return leaseWriter{lease: l, w: w}
+}
+
+type leaseWriter struct {
+	lease *Lease
+	w     io.Writer
+}
+
+func (w leaseWriter) Write(p []byte) (int, error) {
+	if w.lease.lost.Load() {
+		return 0, ErrLeaseLost
+	}
+	return w.w.Write(p)
+}
+
+// Release saves the received size of the upload and gives the lease up
+func (l *Lease) Release(ctx context.Context, received int64) error {
+	close(l.stop)
+	<-l.done
+	res := database.DB(ctx).Model(&entity.RoomFile{}).Where("id = ? AND write_token = ?", l.file.Id, l.token).
+		Updates(map[string]any{"received": received, "write_token": ""})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrLeaseLost
+	}
+	l.file.Received = received
+	return nil
+}
+
+// ErrQuotaExceeded is returned by Reserve when the file does not fit in the quota of the room
+var ErrQuotaExceeded = errors.New("room file quota exceeded")
+
+// Reserve creates the record of an upload if the declared size fits in quota bytes together with the
+// unexpired files of the room, uploads in progress included. The room row is locked so that
+// concurrent uploads to the same room are counted one after another
+func Reserve(ctx context.Context, f *entity.RoomFile, quota int64) error {
+	return database.DB(ctx).Transaction(func(tx *gorm.DB) error {
+		var room entity.Room
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&room, f.RoomId).Error; err != nil {
+			return err
+		}
+
+		var used int64
+		if err := tx.Model(&entity.RoomFile{}).Where("room_id = ? AND expires_at > ?", f.RoomId, time.Now()).
+			Select("COALESCE(SUM(size), 0)").Scan(&used).Error; err != nil {
+			return err
+		}
+		if used+f.Size > quota {
+			return ErrQuotaExceeded
+		}
+		return tx.Create(f).Error
+	})
+}
+
+// Remove deletes the content and the record of a file
+func Remove(ctx context.Context, f *entity.RoomFile, roomUuid string) error {
+	if err := os.Remove(Path(f, roomUuid)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return database.DB(ctx).Delete(f).Error
+}
+
+func run(ctx context.Context) {
+	defer close(done)
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		removeExpired(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// removeExpired deletes the files past Upload.ExpireHours, every node may run it at the same time
+func removeExpired(ctx context.Context) {
+	var files []*entity.RoomFile
+	if err := database.DB(ctx).Preload("Room", func(db *gorm.DB) *gorm.DB {
+		// 房间删除后文件同样需要清理
+		return db.Unscoped()
+	}).Where("expires_at <= ?", time.Now()).Limit(100).Find(&files).Error; err != nil {
+		log.Printf("load expired files error: %v", err)
+		return
+	}
+
+	for _, f := range files {
+		var err error
+		if f.Room == nil {
+			err = database.DB(ctx).Delete(f).Error
+		} else {
+			err = Remove(ctx, f, f.Room.Uuid)
+		}
+		if err != nil {
+			log.Printf("remove expired file %s error: %v", f.Uuid, err)
+		}
+	}
+}
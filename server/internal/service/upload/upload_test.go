@@ -0,0 +1,100 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"meeting/internal/migration"
+	"meeting/internal/model/entity"
+	"meeting/pkg/database"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库只存在于一个连接中
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	database.UseDB(db)
+	if _, err = migration.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLease(t *testing.T) {
+	setupDB(t)
+	ctx := context.Background()
+	f := &entity.RoomFile{Uuid: "f", RoomId: 1, UploadedBy: 1, Name: "a.txt", Size: 10, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := database.DB(ctx).Create(f).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Acquire(ctx, f, 3); !errors.Is(err, ErrBusy) {
+		t.Fatalf("acquire at the wrong offset: %v, want ErrBusy", err)
+	}
+	lease, err := Acquire(ctx, f, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Acquire(ctx, f, 0); !errors.Is(err, ErrBusy) {
+		t.Fatalf("acquire of a leased upload: %v, want ErrBusy", err)
+	}
+	if err = lease.Release(ctx, 4); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Acquire(ctx, f, 0); !errors.Is(err, ErrBusy) {
+		t.Fatalf("acquire at the old offset: %v, want ErrBusy", err)
+	}
+
+	// 请求异常退出后租约不再刷新，其他请求可以接管
+	lease, err = Acquire(ctx, f, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database.DB(ctx).Model(f).UpdateColumn("updated_at", time.Now().Add(-3*leaseHeartbeat-time.Second))
+	next, err := Acquire(ctx, f, 4)
+	if err != nil {
+		t.Fatalf("acquire of a stale lease: %v", err)
+	}
+	if err = lease.Release(ctx, 8); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("release of a lease taken over: %v, want ErrLeaseLost", err)
+	}
+	if err = next.Release(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	var saved entity.RoomFile
+	database.DB(ctx).First(&saved, f.Id)
+	if saved.Received != 10 || saved.WriteToken != "" {
+		t.Fatalf("received %d with token %q, want 10 and no token", saved.Received, saved.WriteToken)
+	}
+}
+
+func TestLeaseWriterStopsWhenLost(t *testing.T) {
+	var out bytes.Buffer
+	lease := &Lease{}
+	lw := lease.Writer(&out)
+	if _, err := lw.Write([]byte("ab")); err != nil {
+		t.Fatal(err)
+	}
+	lease.lost.Store(true)
+	if _, err := lw.Write([]byte("cd")); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("write after the lease was lost: %v, want ErrLeaseLost", err)
+	}
+	if out.String() != "ab" {
+		t.Fatalf("wrote %q, want %q", out.String(), "ab")
+	}
+}
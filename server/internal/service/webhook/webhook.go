@@ -0,0 +1,91 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"meeting/internal/model/entity"
+	"meeting/pkg/database"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Room identifies the room of an event
+type Room struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Participant describes the user an event is about
+type Participant struct {
+	Id     string `json:"id"`
+	Name   string `json:"name"`
+	Avatar string `json:"avatar,omitempty"`
+	Role   string `json:"role,omitempty"`
+}
+
+// Event is the payload posted to the webhooks, Data depends on Type
+type Event struct {
+	Id        string              `json:"id"`
+	Type      entity.WebhookEvent `json:"type"`
+	CreatedAt time.Time           `json:"createdAt"`
+	Room      Room                `json:"room"`
+	Data      any                 `json:"data,omitempty"`
+}
+
+// Dispatch queues the event for the webhooks of the room and the global webhooks without blocking the caller,
+// roomId is the primary key of entity.Room, 0 only reaches the global webhooks
+func Dispatch(roomId uint, event *Event) {
+	event.Id = uuid.New().String()
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	go func() {
+		if err := dispatch(context.Background(), roomId, event); err != nil {
+			log.Printf("dispatch webhook event %s of room %s error: %v", event.Type, event.Room.Id, err)
+		}
+	}()
+}
+
+func dispatch(ctx context.Context, roomId uint, event *Event) error {
+	var webhooks []*entity.Webhook
+	query := database.DB(ctx).Where("active = ?", true)
+	if roomId == 0 {
+		query = query.Where("room_id IS NULL")
+	} else {
+		query = query.Where("room_id IS NULL OR room_id = ?", roomId)
+	}
+	if err := query.Find(&webhooks).Error; err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	deliveries := make([]*entity.WebhookDelivery, 0, len(webhooks))
+	for _, w := range webhooks {
+		if !w.Subscribes(event.Type) {
+			continue
+		}
+		deliveries = append(deliveries, &entity.WebhookDelivery{
+			WebhookId:     w.Id,
+			EventId:       event.Id,
+			Event:         string(event.Type),
+			Payload:       string(payload),
+			Status:        entity.WebhookDeliveryPending,
+			NextAttemptAt: &now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	if err := database.DB(ctx).Create(&deliveries).Error; err != nil {
+		return err
+	}
+
+	wakeUp()
+	return nil
+}
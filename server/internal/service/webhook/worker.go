@@ -0,0 +1,292 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"meeting/internal/model/entity"
+	"meeting/pkg/config"
+	"meeting/pkg/database"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// batchSize is the number of due deliveries claimed at once
+	batchSize = 20
+	// concurrency is the number of deliveries sent at the same time
+	concurrency = 8
+	// pollInterval picks up retries and deliveries queued by other nodes
+	pollInterval = 5 * time.Second
+)
+
+var (
+	client *http.Client
+	wake   = make(chan struct{}, 1)
+	once   sync.Once
+	cancel context.CancelFunc
+	done   = make(chan struct{})
+)
+
+// InitializeWebhook starts the delivery worker, deliveries are stored in the database
+// and claimed by attempt so several nodes can run the worker at the same time
+func InitializeWebhook() {
+	once.Do(func() {
+		client = newClient(time.Duration(config.GetConfig().Webhook.Timeout)*time.Second, config.GetConfig().Webhook.AllowPrivate)
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		go run(ctx)
+	})
+}
+
+// newClient returns the http client posting the deliveries, unless allowPrivate is set it refuses to
+// connect to internal addresses, checked after DNS resolution so hostnames cannot point the worker inside
+func newClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = denyPrivate
+	}
+	return &http.Client{
+		Timeout: timeout,
+		// 不使用环境变量中的代理，否则检查的是代理的地址
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConnsPerHost: concurrency,
+		},
+		// 重定向视为投递失败，避免请求被转发到其他地址
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// denyPrivate is a net.Dialer Control rejecting loopback, private, link-local, unspecified and multicast addresses
+func denyPrivate(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() || ip.IsInterfaceLocalMulticast() {
+		return fmt.Errorf("webhook address %s is not allowed", ip)
+	}
+	return nil
+}
+
+// Close stops the worker and waits for the deliveries in flight, unsent deliveries are sent after restart
+func Close() {
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+func wakeUp() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+func run(ctx context.Context) {
+	defer close(done)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	sem := make(chan struct{}, concurrency)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	cleanup := time.NewTicker(time.Hour)
+	defer cleanup.Stop()
+	for {
+		for _, d := range claimDue(ctx) {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				deliver(ctx, d)
+			}()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-ticker.C:
+		case <-cleanup.C:
+			removeExpired(ctx)
+		}
+	}
+}
+
+// claimDue takes the due deliveries, the attempt counter makes sure only one node sends each attempt
+func claimDue(ctx context.Context) []*entity.WebhookDelivery {
+	now := time.Now()
+	var due []*entity.WebhookDelivery
+	if err := database.DB(ctx).Where("status = ? AND next_attempt_at <= ?", entity.WebhookDeliveryPending, now).
+		Order("next_attempt_at").Limit(batchSize).Find(&due).Error; err != nil {
+		log.Printf("load webhook deliveries error: %v", err)
+		return nil
+	}
+
+	// 投递中的记录在租约到期前不会再被领取，节点退出后到期重试
+	lease := now.Add(time.Duration(config.GetConfig().Webhook.Timeout)*time.Second + time.Minute)
+	claimed := make([]*entity.WebhookDelivery, 0, len(due))
+	for _, d := range due {
+		tx := database.DB(ctx).Model(&entity.WebhookDelivery{}).
+			Where("id = ? AND status = ? AND attempts = ?", d.Id, entity.WebhookDeliveryPending, d.Attempts).
+			Updates(map[string]any{"attempts": gorm.Expr("attempts + 1"), "next_attempt_at": lease})
+		if tx.Error != nil {
+			log.Printf("claim webhook delivery %d error: %v", d.Id, tx.Error)
+			continue
+		}
+		if tx.RowsAffected == 1 {
+			d.Attempts++
+			claimed = append(claimed, d)
+		}
+	}
+	if len(due) == batchSize {
+		wakeUp()
+	}
+
+	return claimed
+}
+
+// deliver posts the payload once and records the result, scheduling a retry with backoff on failure
+func deliver(ctx context.Context, d *entity.WebhookDelivery) {
+	var w entity.Webhook
+	err := database.DB(ctx).Where("id = ?", d.WebhookId).First(&w).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		finish(ctx, d, 0, errors.New("webhook deleted"), false)
+		return
+	case err != nil:
+		finish(ctx, d, 0, err, true)
+		return
+	case !w.Active:
+		finish(ctx, d, 0, errors.New("webhook disabled"), false)
+		return
+	}
+
+	status, err := post(ctx, &w, d)
+	finish(ctx, d, status, err, true)
+}
+
+func post(ctx context.Context, w *entity.Webhook, d *entity.WebhookDelivery) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.Url, bytes.NewBufferString(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "met-webhook/1.0")
+	req.Header.Set("X-Met-Event", d.Event)
+	req.Header.Set("X-Met-Delivery", d.EventId)
+	req.Header.Set("X-Met-Timestamp", timestamp)
+	req.Header.Set("X-Met-Signature", "sha256="+Sign(w.Secret, timestamp, []byte(d.Payload)))
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	return res.StatusCode, nil
+}
+
+// Sign returns the hex HMAC-SHA256 of "timestamp.body", receivers compare it with the X-Met-Signature header
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func finish(ctx context.Context, d *entity.WebhookDelivery, status int, err error, retry bool) {
+	// 服务关闭导致的失败不计入重试次数
+	if ctx.Err() != nil {
+		database.DB(context.Background()).Model(d).Updates(map[string]any{
+			"attempts":        d.Attempts - 1,
+			"next_attempt_at": time.Now(),
+		})
+		return
+	}
+
+	now := time.Now()
+	updates := map[string]any{
+		"response_status": status,
+		"error":           "",
+		"next_attempt_at": nil,
+	}
+	switch {
+	case err == nil:
+		updates["status"] = entity.WebhookDeliverySucceeded
+		updates["delivered_at"] = now
+	case retry && d.Attempts < config.GetConfig().Webhook.MaxAttempts:
+		updates["error"] = truncate(err.Error(), 500)
+		updates["next_attempt_at"] = now.Add(backoff(d.Attempts))
+	default:
+		updates["status"] = entity.WebhookDeliveryFailed
+		updates["error"] = truncate(err.Error(), 500)
+	}
+	if err := database.DB(context.Background()).Model(d).Updates(updates).Error; err != nil {
+		log.Printf("update webhook delivery %d error: %v", d.Id, err)
+	}
+}
+
+// backoff returns the delay before the next attempt: 10s, 30s, 90s ... at most one hour
+func backoff(attempts int) time.Duration {
+	delay := 10 * time.Second
+	for i := 1; i < attempts && delay < time.Hour; i++ {
+		delay *= 3
+	}
+	return min(delay, time.Hour)
+}
+
+// removeExpired deletes finished deliveries older than Webhook.RetentionDays
+func removeExpired(ctx context.Context) {
+	before := time.Now().AddDate(0, 0, -config.GetConfig().Webhook.RetentionDays)
+	if err := database.DB(ctx).Where("status <> ? AND created_at < ?", entity.WebhookDeliveryPending, before).
+		Delete(&entity.WebhookDelivery{}).Error; err != nil {
+		log.Printf("remove webhook deliveries error: %v", err)
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,57 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientRefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	// 域名解析到回环地址同样被拒绝
+	url := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+	for _, u := range []string{srv.URL, url} {
+		res, err := newClient(time.Second, false).Post(u, "application/json", nil)
+		if err == nil {
+			res.Body.Close()
+			t.Fatalf("post to %s succeeded", u)
+		}
+		if !strings.Contains(err.Error(), "is not allowed") {
+			t.Fatalf("post to %s: unexpected error %v", u, err)
+		}
+	}
+
+	res, err := newClient(time.Second, true).Post(srv.URL, "application/json", nil)
+	if err != nil {
+		t.Fatalf("post with AllowPrivate: %v", err)
+	}
+	res.Body.Close()
+}
+
+func TestDenyPrivate(t *testing.T) {
+	for address, allowed := range map[string]bool{
+		"127.0.0.1:80":          false,
+		"10.1.2.3:443":          false,
+		"172.16.0.1:443":        false,
+		"192.168.1.1:80":        false,
+		"169.254.169.254:80":    false,
+		"0.0.0.0:80":            false,
+		"224.0.0.1:80":          false,
+		"[::1]:80":              false,
+		"[fe80::1]:80":          false,
+		"[fd00::1]:80":          false,
+		"[::ffff:127.0.0.1]:80": false,
+		"93.184.216.34:443":     true,
+		"[2606:4700::1]:443":    true,
+	} {
+		if err := denyPrivate("tcp", address, nil); (err == nil) != allowed {
+			t.Errorf("denyPrivate(%s) = %v, want allowed %v", address, err, allowed)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package webrtc
+
+import (
+	"context"
+	"errors"
+	"log"
+	"meeting/internal/model/entity"
+	"meeting/pkg/database"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// persist queues a database update of the meeting, updates run in order on their own goroutine
+// so the room loop never waits for the database
+func (r *Room) persist(task func()) {
+	r.persisted.Add(1)
+	r.persistMu.Lock()
+	r.pending = append(r.pending, task)
+	start := !r.persisting
+	r.persisting = true
+	r.persistMu.Unlock()
+	if start {
+		go r.runPersist()
+	}
+}
+
+// runPersist runs the queued updates until the queue is empty
+func (r *Room) runPersist() {
+	for {
+		r.persistMu.Lock()
+		if len(r.pending) == 0 {
+			r.persisting = false
+			r.persistMu.Unlock()
+			return
+		}
+		task := r.pending[0]
+		r.pending = r.pending[1:]
+		r.persistMu.Unlock()
+
+		task()
+		r.persisted.Done()
+	}
+}
+
+// meetingSession returns the id of the persisted session of the room, opening one on first use, the caller must hold r.meetingMu
+func (r *Room) meetingSession() uint {
+	if r.meetingId != 0 {
+		return r.meetingId
+	}
+	roomId := r.entityId()
+	if roomId == 0 {
+		return 0
+	}
+
+	db := database.DB(context.Background())
+	var session entity.MeetingSession
+	err := db.Where("room_id = ? AND ended_at IS NULL", roomId).Order("id DESC").First(&session).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("find meeting session of room %s error: %v", r.Id, err)
+		return 0
+	}
+	if session.Id != 0 {
+		// 其他节点上仍有人在会议中，继续使用该场次，否则为节点异常退出后遗留的场次
+		var online int64
+		db.Model(&entity.MeetingAttendance{}).Where("session_id = ? AND online_since IS NOT NULL", session.Id).Count(&online)
+		if online > 0 {
+			r.meetingId = session.Id
+			return r.meetingId
+		}
+		r.closeMeetingSession(db, &session)
+	}
+
+	session = entity.MeetingSession{RoomId: roomId, StartedAt: r.StartTime}
+	if err := db.Create(&session).Error; err != nil {
+		log.Printf("create meeting session of room %s error: %v", r.Id, err)
+		return 0
+	}
+	r.meetingId = session.Id
+	// 会议开始和结束事件由打开和关闭场次的节点发送，多节点时只发送一次
+	r.dispatchWebhook(entity.WebhookEventRoomStarted, &RoomStartedData{Mode: r.Mode, StartTime: session.StartedAt})
+
+	return r.meetingId
+}
+
+// closeMeetingSession ends a session left open, at the last time somebody left
+func (r *Room) closeMeetingSession(db *gorm.DB, session *entity.MeetingSession) {
+	endedAt := session.UpdatedAt
+	var last entity.MeetingAttendance
+	if db.Where("session_id = ? AND left_at IS NOT NULL", session.Id).Order("left_at DESC").Limit(1).Find(&last); last.LeftAt != nil {
+		endedAt = *last.LeftAt
+	}
+	// 断线的客户端视为在会议结束时离开
+	db.Model(&entity.MeetingAttendance{}).Where("session_id = ? AND online_since IS NOT NULL", session.Id).
+		Updates(map[string]any{"online_since": nil, "left_at": endedAt})
+	r.finishMeetingSession(db, session, endedAt)
+}
+
+// finishMeetingSession sets the end of an open session, only the node that closes it sends room.ended
+func (r *Room) finishMeetingSession(db *gorm.DB, session *entity.MeetingSession, endedAt time.Time) bool {
+	res := db.Model(&entity.MeetingSession{}).Where("id = ? AND ended_at IS NULL", session.Id).Update("ended_at", endedAt)
+	if res.Error != nil {
+		log.Printf("end meeting session %d error: %v", session.Id, res.Error)
+		return false
+	}
+	if res.RowsAffected == 1 {
+		r.dispatchWebhook(entity.WebhookEventRoomEnded, &RoomEndedData{StartTime: session.StartedAt, EndTime: endedAt, MaxOnline: session.MaxOnline})
+	}
+	return true
+}
+
+// recordJoin starts the attendance of a local client, a user joining again counts as a reconnect
+func (r *Room) recordJoin(c *Client) {
+	r.meetingMu.Lock()
+	defer r.meetingMu.Unlock()
+	sessionId := r.meetingSession()
+	if sessionId == 0 {
+		return
+	}
+
+	db := database.DB(context.Background())
+	now := time.Now()
+	var a entity.MeetingAttendance
+	err := db.Where("session_id = ? AND user_uuid = ?", sessionId, c.Id).First(&a).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		a = entity.MeetingAttendance{
+			SessionId:   sessionId,
+			RoomId:      r.entityId(),
+			UserUuid:    c.Id,
+			UserName:    c.Name,
+			JoinedAt:    now,
+			OnlineSince: &now,
+		}
+		err = db.Create(&a).Error
+	case err == nil:
+		updates := map[string]any{"user_name": c.Name, "reconnects": gorm.Expr("reconnects + 1")}
+		if a.OnlineSince == nil {
+			updates["online_since"] = now
+		}
+		err = db.Model(&a).Updates(updates).Error
+	}
+	if err != nil {
+		log.Printf("record join of %s in room %s error: %v", c.Id, r.Id, err)
+	}
+
+	r.mu.RLock()
+	maxOnline := r.MaxOnline
+	r.mu.RUnlock()
+	db.Model(&entity.MeetingSession{}).Where("id = ? AND max_online < ?", sessionId, maxOnline).Update("max_online", maxOnline)
+}
+
+// recordReconnect counts a session resumed after the connection dropped
+func (r *Room) recordReconnect(c *Client) {
+	r.meetingMu.Lock()
+	defer r.meetingMu.Unlock()
+	if r.meetingId == 0 {
+		return
+	}
+
+	if err := database.DB(context.Background()).Model(&entity.MeetingAttendance{}).
+		Where("session_id = ? AND user_uuid = ?", r.meetingId, c.Id).
+		Update("reconnects", gorm.Expr("reconnects + 1")).Error; err != nil {
+		log.Printf("record reconnect of %s in room %s error: %v", c.Id, r.Id, err)
+	}
+}
+
+// recordLeave adds the time since the client joined to its attendance
+func (r *Room) recordLeave(c *Client) {
+	r.meetingMu.Lock()
+	defer r.meetingMu.Unlock()
+	if r.meetingId == 0 {
+		return
+	}
+
+	db := database.DB(context.Background())
+	var a entity.MeetingAttendance
+	if err := db.Where("session_id = ? AND user_uuid = ?", r.meetingId, c.Id).First(&a).Error; err != nil || a.OnlineSince == nil {
+		return
+	}
+	now := time.Now()
+	if err := db.Model(&a).Updates(map[string]any{
+		"duration_seconds": a.DurationSeconds + int64(now.Sub(*a.OnlineSince).Round(time.Second).Seconds()),
+		"online_since":     nil,
+		"left_at":          now,
+	}).Error; err != nil {
+		log.Printf("record leave of %s in room %s error: %v", c.Id, r.Id, err)
+	}
+
+	// 最后离开的人结束会议，其他节点上仍有人时不结束
+	r.endMeetingSessionLocked()
+}
+
+// endMeetingSession ends the session unless users are still in the meeting on other nodes
+func (r *Room) endMeetingSession() {
+	r.meetingMu.Lock()
+	defer r.meetingMu.Unlock()
+	r.endMeetingSessionLocked()
+}
+
+func (r *Room) endMeetingSessionLocked() {
+	if r.meetingId == 0 {
+		return
+	}
+
+	db := database.DB(context.Background())
+	var online int64
+	if err := db.Model(&entity.MeetingAttendance{}).Where("session_id = ? AND online_since IS NOT NULL", r.meetingId).Count(&online).Error; err != nil || online > 0 {
+		return
+	}
+	var session entity.MeetingSession
+	if err := db.First(&session, r.meetingId).Error; err != nil {
+		log.Printf("find meeting session %d error: %v", r.meetingId, err)
+		return
+	}
+	if !r.finishMeetingSession(db, &session, time.Now()) {
+		return
+	}
+	r.meetingId = 0
+}
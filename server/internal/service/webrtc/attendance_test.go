@@ -0,0 +1,175 @@
+package webrtc
+
+import (
+	"context"
+	"meeting/internal/migration"
+	"meeting/internal/model/entity"
+	"meeting/pkg/database"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestPersistRunsInOrder(t *testing.T) {
+	r := newTestRoom(t)
+	var got []int
+	for i := range 100 {
+		r.persist(func() {
+			// 模拟较慢的数据库写入
+			if i%10 == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			got = append(got, i)
+		})
+	}
+	r.persisted.Wait()
+
+	if len(got) != 100 {
+		t.Fatalf("ran %d tasks, want 100", len(got))
+	}
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("task %d ran at position %d", v, i)
+		}
+	}
+}
+
+// setupDB uses a migrated in-memory SQLite database and returns a room persisted in it
+func setupDB(t *testing.T) *Room {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库只存在于一个连接中
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	database.UseDB(db)
+	if _, err = migration.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	room := entity.Room{Uuid: "room", Name: "room"}
+	if err := db.Create(&room).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := newTestRoom(t)
+	r.roomId = room.Id
+	r.StartTime = time.Now()
+	return r
+}
+
+func newTestClient(id string) *Client {
+	return &Client{User: &User{Id: id, Name: id}}
+}
+
+// findAttendance loads the attendance of user in the session
+func findAttendance(t *testing.T, sessionId uint, user string) *entity.MeetingAttendance {
+	t.Helper()
+	var a entity.MeetingAttendance
+	if err := database.DB(context.Background()).Where("session_id = ? AND user_uuid = ?", sessionId, user).First(&a).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &a
+}
+
+// backdate moves the current stay of user back by d, so leaving adds d to its duration
+func backdate(t *testing.T, sessionId uint, user string, d time.Duration) {
+	t.Helper()
+	a := findAttendance(t, sessionId, user)
+	if err := database.DB(context.Background()).Model(a).Update("online_since", a.OnlineSince.Add(-d)).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func findSession(t *testing.T, id uint) *entity.MeetingSession {
+	t.Helper()
+	var s entity.MeetingSession
+	if err := database.DB(context.Background()).First(&s, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &s
+}
+
+func TestRecordAttendance(t *testing.T) {
+	r := setupDB(t)
+	alice, bob := newTestClient("alice"), newTestClient("bob")
+
+	r.recordJoin(alice)
+	sessionId := r.meetingId
+	if sessionId == 0 {
+		t.Fatal("no session was opened")
+	}
+	r.recordJoin(bob)
+	backdate(t, sessionId, "alice", 90*time.Second)
+	r.recordLeave(alice)
+
+	a := findAttendance(t, sessionId, "alice")
+	if a.IsOnline() || a.LeftAt == nil || a.DurationSeconds != 90 {
+		t.Fatalf("after leaving: online %v, left at %v, duration %ds, want offline after 90s", a.IsOnline(), a.LeftAt, a.DurationSeconds)
+	}
+	if findSession(t, sessionId).EndedAt != nil {
+		t.Fatal("session ended while bob is still in the meeting")
+	}
+
+	// 再次加入计为重连，在线时长累加
+	r.recordJoin(alice)
+	backdate(t, sessionId, "alice", 30*time.Second)
+	r.recordLeave(alice)
+	a = findAttendance(t, sessionId, "alice")
+	if a.Reconnects != 1 || a.DurationSeconds != 120 {
+		t.Fatalf("after rejoining: %d reconnects, duration %ds, want 1 and 120s", a.Reconnects, a.DurationSeconds)
+	}
+
+	// 最后一人离开时结束会议
+	r.recordLeave(bob)
+	if s := findSession(t, sessionId); s.EndedAt == nil {
+		t.Fatal("session was not ended by the last leave")
+	}
+	if r.meetingId != 0 {
+		t.Fatal("room kept the ended session")
+	}
+
+	r.recordJoin(alice)
+	if r.meetingId == 0 || r.meetingId == sessionId {
+		t.Fatal("joining after the end did not open a new session")
+	}
+}
+
+func TestMeetingSessionLeftOpen(t *testing.T) {
+	r := setupDB(t)
+	db := database.DB(context.Background())
+	leftAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	// 节点异常退出，所有人已离开但场次没有结束
+	stale := entity.MeetingSession{RoomId: r.roomId, StartedAt: leftAt.Add(-time.Hour)}
+	if err := db.Create(&stale).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&entity.MeetingAttendance{SessionId: stale.Id, RoomId: r.roomId, UserUuid: "ghost", UserName: "ghost", JoinedAt: stale.StartedAt, LeftAt: &leftAt, DurationSeconds: 3600}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	r.recordJoin(newTestClient("alice"))
+	if r.meetingId == stale.Id {
+		t.Fatal("joined the session left open")
+	}
+	if s := findSession(t, stale.Id); s.EndedAt == nil || !s.EndedAt.Equal(leftAt) {
+		t.Fatalf("session left open ended at %v, want the last leave %v", s.EndedAt, leftAt)
+	}
+
+	// 其他节点上仍有人在会议中时继续使用该场次
+	other := newTestRoom(t)
+	other.roomId = r.roomId
+	other.recordJoin(newTestClient("bob"))
+	if other.meetingId != r.meetingId {
+		t.Fatalf("node joined session %d, want the ongoing session %d", other.meetingId, r.meetingId)
+	}
+}
@@ -0,0 +1,127 @@
+package webrtc
+
+import (
+	"context"
+	"log"
+	"meeting/internal/model/entity"
+	"meeting/internal/service/webhook"
+	"meeting/pkg/database"
+	"slices"
+	"time"
+)
+
+// chatHistorySize is the number of messages replayed to a client after joining
+const chatHistorySize = 50
+
+// entityId returns the primary key of the persisted room, 0 when the room was started without WithEntityId
+func (r *Room) entityId() uint {
+	return r.roomId
+}
+
+// saveChat stores a chat message sent by a client of this node
+func (r *Room) saveChat(from *User, chat *ChatPayload) {
+	roomId := r.entityId()
+	if roomId == 0 {
+		return
+	}
+
+	m := &entity.ChatMessage{
+		RoomId:     roomId,
+		MessageId:  chat.Id,
+		UserUuid:   from.Id,
+		UserName:   from.Name,
+		UserAvatar: from.Avatar,
+		Content:    chat.Content,
+		CreatedAt:  time.UnixMilli(chat.Timestamp),
+	}
+	if err := database.DB(context.Background()).Create(m).Error; err != nil {
+		log.Printf("save chat message of room %s error: %v", r.Id, err)
+	}
+}
+
+// replayChat sends the latest chat messages of the room to a newly joined client
+func (c *Client) replayChat() {
+	roomId := c.room.entityId()
+	if roomId == 0 {
+		return
+	}
+
+	var messages []*entity.ChatMessage
+	if err := database.DB(context.Background()).Preload("File").Where("room_id=?", roomId).
+		Order("created_at desc").Order("id desc").Limit(chatHistorySize).Find(&messages).Error; err != nil {
+		log.Printf("load chat history of room %s error: %v", c.room.Id, err)
+		return
+	}
+
+	slices.Reverse(messages)
+	for _, m := range messages {
+		from := &Client{User: &User{Id: m.UserUuid, Name: m.UserName, Avatar: m.UserAvatar}}
+		c.Send(NewMessage(MessageTypeChat, from, &ChatPayload{
+			Id:        m.MessageId,
+			Content:   m.Content,
+			Timestamp: m.CreatedAt.UnixMilli(),
+			File:      newFilePayload(m.File),
+		}))
+	}
+}
+
+// newFilePayload describes a shared file, it returns nil once the file is removed or expired
+func newFilePayload(f *entity.RoomFile) *FilePayload {
+	if f == nil || !f.IsCompleted() || f.IsExpired() {
+		return nil
+	}
+
+	return &FilePayload{
+		Id:        f.Uuid,
+		Name:      f.Name,
+		Size:      f.Size,
+		MimeType:  f.MimeType,
+		ExpiresAt: f.ExpiresAt,
+	}
+}
+
+// ShareFile announces a completed upload as a chat message of the uploader,
+// the room may run on any node so the message goes to the local clients and through the broker
+func (s *Server) ShareFile(room *entity.Room, from *User, file *entity.RoomFile) {
+	chat := &ChatPayload{
+		Id:        file.Uuid,
+		Content:   file.Name,
+		Timestamp: time.Now().UnixMilli(),
+		File:      newFilePayload(file),
+	}
+	m := &entity.ChatMessage{
+		RoomId:     room.Id,
+		MessageId:  chat.Id,
+		UserUuid:   from.Id,
+		UserName:   from.Name,
+		UserAvatar: from.Avatar,
+		Content:    chat.Content,
+		FileUuid:   file.Uuid,
+		CreatedAt:  time.UnixMilli(chat.Timestamp),
+	}
+	if err := database.DB(context.Background()).Create(m).Error; err != nil {
+		log.Printf("save file message of room %s error: %v", room.Uuid, err)
+	}
+
+	msg, err := NewMessage(MessageTypeChat, &Client{User: from}, chat).Bytes()
+	if err != nil {
+		return
+	}
+	// 上传者也会收到这条消息，客户端按消息 id 去重
+	if r := s.FindRoom(room.Uuid); r != nil {
+		r.deliver(msg, "")
+	}
+	s.publish(room.Uuid, &Envelope{Kind: EnvelopeBroadcast, Data: msg})
+
+	webhook.Dispatch(room.Id, &webhook.Event{
+		Type: entity.WebhookEventChatMessage,
+		Room: webhook.Room{Id: room.Uuid, Name: room.Name},
+		Data: &ChatMessageData{
+			Id:        chat.Id,
+			Content:   chat.Content,
+			Timestamp: chat.Timestamp,
+			File:      chat.File,
+			From:      &webhook.Participant{Id: from.Id, Name: from.Name, Avatar: from.Avatar},
+		},
+	})
+}
@@ -6,6 +6,9 @@ import (
 	"log"
 	"meeting/internal/model/entity"
 	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -23,6 +26,9 @@ const (
 
 	// Maximum message size allowed from peer.
 	maxMessageSize = 102400
+
+	// Time a removed client keeps its connection to receive the last messages.
+	closeDelay = time.Second
 )
 
 var (
@@ -44,6 +50,8 @@ type User struct {
 	Avatar string `json:"avatar"`
 	// Client Role (bitmap)
 	Role entity.Role `json:"role"`
+	// Capabilities granted by the join token
+	Capabilities []entity.Capability `json:"-"`
 }
 
 // Client is a middleman between the websocket connection and the room.
@@ -61,6 +69,31 @@ type Client struct {
 	send chan []byte
 
 	lastMessageTime time.Time
+
+	// node is the id of the server instance holding the connection, empty for local clients
+	node string
+
+	// negotiated signaling protocol version
+	protocol int
+
+	// waiting is set while the client is parked in the lobby
+	waiting atomic.Bool
+
+	// media is the last media state announced by the client, the SFU uses it to tell camera from screen
+	media atomic.Pointer[MediaStatePayload]
+
+	// roleMu guards Role and Capabilities, they change when a moderator promotes or demotes the client
+	roleMu sync.RWMutex
+
+	// sessionMu guards conn, send, pending, detachedAt and lastMessageTime, the connection changes when the session is resumed
+	sessionMu sync.Mutex
+	// detachedAt is set while the connection is lost and messages are buffered in pending
+	detachedAt  time.Time
+	pending     [][]byte
+	resumeToken string
+
+	// recorder is set on the client of the server side recorder
+	recorder *Recorder
 }
 
 // NewClient creates a new client with a specific entity.Role
@@ -70,25 +103,55 @@ func NewClient(conn *websocket.Conn, user *User) *Client {
 		conn:            conn,
 		send:            make(chan []byte, 256),
 		lastMessageTime: time.Now(),
+		protocol:        MinProtocolVersion,
 	}
 }
 
+// newRemoteClient creates a placeholder for a client connected to another node
+func newRemoteClient(user *User, node string, joinTime time.Time, room *Room) *Client {
+	return &Client{
+		User:     user,
+		room:     room,
+		node:     node,
+		joinTime: joinTime,
+	}
+}
+
+// isLocal reports whether the client is connected to this node
+func (c *Client) isLocal() bool {
+	return c.node == ""
+}
+
 func (c *Client) handleJoin() {
 	// broadcast join message to all other clients
 	joinMsg := c.newMessage(MessageTypeJoin, nil, nil)
 	c.room.broadcast <- joinMsg
+	c.room.dispatchWebhook(entity.WebhookEventParticipantJoined, c.participant())
 }
 
 func (c *Client) handleLeave() {
 	// broadcast leave message to all other clients
 	leaveMsg := c.newMessage(MessageTypeLeave, nil, nil)
 	c.room.broadcast <- leaveMsg
+	c.room.dispatchWebhook(entity.WebhookEventParticipantLeft, c.participant())
 }
 
 func (c *Client) handleKick() {
 	c.Send(c.newMessage(MessageTypeKick, nil, nil))
 }
 
+// close drops the websocket connection, ReadPump then unregisters the client
+func (c *Client) close() {
+	if conn, _ := c.connection(); conn != nil {
+		conn.Close()
+	}
+}
+
+// closeLater drops the websocket connection once the messages already queued had time to be sent
+func (c *Client) closeLater() {
+	time.AfterFunc(closeDelay, c.close)
+}
+
 // Send sends a message to the client
 func (c *Client) Send(message *Message) {
 	message.To = nil
@@ -98,43 +161,100 @@ func (c *Client) Send(message *Message) {
 		return
 	}
 
-	c.send <- msg
+	if !c.isLocal() {
+		if c.room != nil {
+			c.room.publish(&Envelope{Kind: EnvelopeDirect, To: c.Id, Data: msg})
+		}
+		return
+	}
+
+	c.write(msg)
 }
 
 func (c *Client) HasRole(role entity.Role) bool {
+	c.roleMu.RLock()
+	defer c.roleMu.RUnlock()
 	return (c.Role & role) != 0
 }
 
+// Can reports whether the current role of the client grants the capability
+func (c *Client) Can(capability entity.Capability) bool {
+	c.roleMu.RLock()
+	defer c.roleMu.RUnlock()
+	return slices.Contains(c.Capabilities, capability)
+}
+
+// currentRole returns the role of the client, it may be changed by a moderator at any time
+func (c *Client) currentRole() entity.Role {
+	c.roleMu.RLock()
+	defer c.roleMu.RUnlock()
+	return c.Role
+}
+
+// touch records that a message was written to the connection
+func (c *Client) touch() {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+	c.lastMessageTime = time.Now()
+}
+
+func (c *Client) lastMessageAt() time.Time {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+	return c.lastMessageTime
+}
+
+// setRole replaces the role of the client and the capabilities it grants
+func (c *Client) setRole(role entity.Role) {
+	c.roleMu.Lock()
+	defer c.roleMu.Unlock()
+	c.Role = role
+	c.Capabilities = role.Capabilities()
+}
+
 func (c *Client) newMessage(t MessageType, data any, receiver Receiver) *Message {
 	if receiver == nil {
 		receiver = &RoleReceiver{Role: entity.RoleAll}
 	}
-	return &Message{
-		Type:     t,
-		Data:     data,
-		From:     c,
-		receiver: receiver,
+	m := NewMessage(t, c, data)
+	m.receiver = receiver
+
+	return m
+}
+
+// sendError reports an invalid message to clients speaking protocol version 2 or later
+func (c *Client) sendError(t MessageType, err *ProtocolError) {
+	log.Printf("Invalid %s message from client %s: %v", t, c.Id, err)
+	if c.protocol < 2 {
+		return
 	}
+	c.Send(NewMessage(MessageTypeError, nil, &ErrorPayload{
+		Code:    err.Code,
+		Message: err.Message,
+		Type:    t,
+	}))
 }
 
 // ReadPump pumps messages from the websocket connection to the room.
 func (c *Client) ReadPump() {
+	conn, _ := c.connection()
 	defer func() {
-		if c.room != nil && c.conn != nil {
-			c.room.UnregisterClient(c)
-			c.conn.Close()
+		if c.room != nil && conn != nil {
+			// 保留客户端一段时间，等待其恢复会话
+			c.room.DetachClient(c, conn)
+			conn.Close()
 		}
 	}()
 
-	if c.conn == nil {
+	if conn == nil {
 		return
 	}
 
-	c.conn.SetReadLimit(maxMessageSize)
-	c.conn.SetReadDeadline(time.Now().Add(pongWait))
-	c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error { conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 	for {
-		_, message, err := c.conn.ReadMessage()
+		_, message, err := conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseNoStatusReceived) {
 				log.Printf("websocket conn closed err: %v", err)
@@ -144,8 +264,10 @@ func (c *Client) ReadPump() {
 
 		message = bytes.TrimSpace(bytes.Replace(message, newline, space, -1))
 		var msg *Message
-		if err = json.Unmarshal(message, &msg); err != nil {
-			break
+		if err = json.Unmarshal(message, &msg); err != nil || msg == nil {
+			messagesReceived.WithLabelValues("invalid").Inc()
+			c.sendError("", newProtocolError(ErrorCodeInvalidJSON, "malformed message"))
+			continue
 		}
 
 		msg.From = c
@@ -155,45 +277,47 @@ func (c *Client) ReadPump() {
 
 // WritePump pumps messages from the room to the websocket connection.
 func (c *Client) WritePump() {
-	if c.conn == nil {
+	// 会话恢复后使用新的连接和发送队列，旧的 WritePump 随旧连接退出
+	conn, send := c.connection()
+	if conn == nil {
 		return
 	}
 
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
 		ticker.Stop()
-		c.conn.Close()
+		conn.Close()
 	}()
 	for {
 		select {
-		case msg, ok := <-c.send:
+		case msg, ok := <-send:
 			if !ok {
 				// The room closed the channel.
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
 
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			w, err := c.conn.NextWriter(websocket.TextMessage)
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			w, err := conn.NextWriter(websocket.TextMessage)
 			if err != nil {
 				return
 			}
 			w.Write(msg)
 
 			// Add queued chat messages to the current websocket message.
-			n := len(c.send)
+			n := len(send)
 			for i := 0; i < n; i++ {
-				msg = <-c.send
+				msg = <-send
 				w.Write(newline)
 				w.Write(msg)
 			}
-			c.lastMessageTime = time.Now()
+			c.touch()
 			if err = w.Close(); err != nil {
 				return
 			}
 		case <-ticker.C:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
 		}
@@ -0,0 +1,252 @@
+package webrtc
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// nodeId identifies this server instance on the broker
+var nodeId = uuid.New().String()
+
+type EnvelopeKind string
+
+const (
+	EnvelopeJoin      EnvelopeKind = "join"      // a client joined on the publishing node
+	EnvelopeLeave     EnvelopeKind = "leave"     // a client left the publishing node
+	EnvelopeBroadcast EnvelopeKind = "broadcast" // deliver to every client except the sender
+	EnvelopeDirect    EnvelopeKind = "direct"    // deliver to a single client
+	EnvelopeSync      EnvelopeKind = "sync"      // ask other nodes to announce their clients
+	EnvelopePresence  EnvelopeKind = "presence"  // announce a client already in the room
+	EnvelopeAdmit     EnvelopeKind = "admit"     // a host decided on a client waiting in the lobby
+	EnvelopeRole      EnvelopeKind = "role"      // a moderator changed the role of a client
+	EnvelopeHeartbeat EnvelopeKind = "heartbeat" // the publishing node still serves the room
+	EnvelopeEnd       EnvelopeKind = "end"       // a host ended the meeting
+)
+
+const (
+	// heartbeatInterval is how often a node with clients in a room announces itself
+	heartbeatInterval = 10 * time.Second
+	// nodeTimeout is how long the clients of a silent node are kept
+	nodeTimeout = 3 * heartbeatInterval
+	// outboundSize is the number of envelopes a room queues while the broker is slow
+	outboundSize = 256
+)
+
+// Envelope wraps a room event exchanged between server instances through the broker.
+type Envelope struct {
+	Kind     EnvelopeKind    `json:"kind"`
+	Node     string          `json:"node"`
+	Room     string          `json:"room"`
+	From     string          `json:"from,omitempty"`
+	To       string          `json:"to,omitempty"`
+	User     *User           `json:"user,omitempty"`
+	JoinTime time.Time       `json:"joinTime,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+}
+
+// newEnvelope wraps an encoded message broadcast by a local client
+func newEnvelope(message *Message, msg []byte) *Envelope {
+	env := &Envelope{Kind: EnvelopeBroadcast, From: message.From.Id, Data: msg}
+	switch message.Type {
+	case MessageTypeJoin:
+		env.Kind = EnvelopeJoin
+		env.User = message.From.User
+		env.JoinTime = message.From.joinTime
+	case MessageTypeLeave:
+		env.Kind = EnvelopeLeave
+		env.User = message.From.User
+	}
+
+	return env
+}
+
+func roomTopic(roomId string) string {
+	return "room:" + roomId
+}
+
+// publish queues an envelope for the other nodes serving this room, envelopes are published in order
+// on their own goroutine so the room loop never waits for the broker
+func (r *Room) publish(env *Envelope) {
+	select {
+	case r.outbound <- env:
+	default:
+		log.Printf("outbound queue of room %s is full, %s envelope dropped", r.Id, env.Kind)
+	}
+}
+
+// runPublish publishes the queued envelopes, those left when the room loop exits are still published
+func (r *Room) runPublish() {
+	defer close(r.published)
+	for {
+		select {
+		case env := <-r.outbound:
+			r.server.publish(r.Id, env)
+		case <-r.done:
+			for {
+				select {
+				case env := <-r.outbound:
+					r.server.publish(r.Id, env)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// publish sends an envelope to the nodes serving a room, including rooms not running on this node
+func (s *Server) publish(roomId string, env *Envelope) {
+	env.Node = nodeId
+	env.Room = roomId
+	b, err := json.Marshal(env)
+	if err != nil {
+		log.Println("marshal envelope error:", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), writeWait)
+	defer cancel()
+	if err = s.broker().Publish(ctx, roomTopic(roomId), b); err != nil {
+		log.Printf("publish envelope to room %s error: %v", roomId, err)
+	}
+}
+
+// receive is the broker handler, it hands remote envelopes over to the room loop
+func (r *Room) receive(payload []byte) {
+	var env Envelope
+	if err := json.Unmarshal(payload, &env); err != nil {
+		log.Println("unmarshal envelope error:", err)
+		return
+	}
+	if env.Node == nodeId {
+		return
+	}
+
+	select {
+	case r.inbound <- &env:
+	case <-r.done:
+	}
+}
+
+// handleEnvelope applies a remote envelope, it must be called from the room loop
+func (r *Room) handleEnvelope(env *Envelope) {
+	r.nodes[env.Node] = time.Now()
+	switch env.Kind {
+	case EnvelopeJoin, EnvelopePresence:
+		if env.User == nil {
+			return
+		}
+		r.mu.Lock()
+		// 同一用户在其他节点重新连接，踢掉本节点上的旧连接
+		if c, ok := r.clients[env.User.Id]; ok && c.isLocal() {
+			if c.recorder != nil {
+				go c.recorder.Stop()
+			}
+			c.handleKick()
+			c.room = nil
+			r.server.removeSession(c)
+		}
+		r.clients[env.User.Id] = newRemoteClient(env.User, env.Node, env.JoinTime, r)
+		r.updateMaxOnline()
+		joined := r.clients[env.User.Id]
+		r.mu.Unlock()
+		if env.Kind == EnvelopeJoin {
+			r.deliver(env.Data, env.User.Id)
+		}
+		r.announceWaiting(joined)
+		r.notifyClient(RoomEventClientJoined, joined)
+	case EnvelopeLeave:
+		if env.User == nil {
+			return
+		}
+		r.mu.Lock()
+		c, ok := r.clients[env.User.Id]
+		left := ok && c.node == env.Node
+		if left {
+			delete(r.clients, env.User.Id)
+		}
+		r.mu.Unlock()
+		if left {
+			r.notifyClient(RoomEventClientLeft, c)
+			r.stopRecordingIfAlone()
+		}
+		r.deliver(env.Data, env.User.Id)
+	case EnvelopeBroadcast:
+		r.deliver(env.Data, env.From)
+	case EnvelopeDirect:
+		if c := r.FindClient(env.To); c != nil && c.isLocal() {
+			c.write(env.Data)
+		}
+	case EnvelopeAdmit:
+		var d LobbyDecisionPayload
+		if err := json.Unmarshal(env.Data, &d); err != nil {
+			log.Println("unmarshal lobby decision error:", err)
+			return
+		}
+		r.decide(&d)
+	case EnvelopeRole:
+		var p RolePayload
+		if err := json.Unmarshal(env.Data, &p); err != nil {
+			log.Println("unmarshal role change error:", err)
+			return
+		}
+		r.applyRole(&p)
+	case EnvelopeEnd:
+		// end 需要等待房间循环处理注销
+		go r.end(env.Data)
+	case EnvelopeSync:
+		for _, c := range r.AllClients() {
+			if c.isLocal() {
+				r.publish(&Envelope{Kind: EnvelopePresence, User: c.User, JoinTime: c.joinTime})
+			}
+		}
+	}
+}
+
+// deliver writes an encoded message to every local client except the sender
+func (r *Room) deliver(msg []byte, exclude string) {
+	if len(msg) == 0 {
+		return
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, c := range r.clients {
+		if c.isLocal() && c.Id != exclude {
+			c.write(msg)
+		}
+	}
+}
+
+// expireNodes removes the clients of nodes that stopped sending heartbeats, it must be called from the room loop
+func (r *Room) expireNodes(now time.Time) {
+	for node, seen := range r.nodes {
+		if now.Sub(seen) < nodeTimeout {
+			continue
+		}
+		delete(r.nodes, node)
+
+		var gone []*Client
+		r.mu.Lock()
+		for id, c := range r.clients {
+			if c.node == node {
+				delete(r.clients, id)
+				gone = append(gone, c)
+			}
+		}
+		r.mu.Unlock()
+		for _, c := range gone {
+			log.Printf("client %s of silent node %s left room %s", c.Id, node, r.Id)
+			if msg, err := c.newMessage(MessageTypeLeave, nil, nil).Bytes(); err == nil {
+				r.deliver(msg, c.Id)
+			}
+			r.notifyClient(RoomEventClientLeft, c)
+		}
+		if len(gone) > 0 {
+			r.stopRecordingIfAlone()
+		}
+	}
+}
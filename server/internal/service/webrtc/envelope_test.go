@@ -0,0 +1,123 @@
+package webrtc
+
+import (
+	"context"
+	"encoding/json"
+	"meeting/pkg/broker"
+	"testing"
+	"time"
+)
+
+func newTestRoom(t *testing.T) *Room {
+	t.Helper()
+	b := broker.NewMemoryBroker()
+	t.Cleanup(func() { _ = b.Close() })
+	s := &Server{rooms: make(map[string]*Room), sessions: make(map[string]*Client), Broker: b}
+
+	return &Room{
+		Id:       "room",
+		server:   s,
+		clients:  make(map[string]*Client),
+		nodes:    make(map[string]time.Time),
+		waiting:  make(map[string]*Client),
+		admitted: make(map[string]bool),
+		done:     make(chan struct{}),
+	}
+}
+
+func TestExpireNodesRemovesClientsOfSilentNode(t *testing.T) {
+	r := newTestRoom(t)
+	local := &Client{User: &User{Id: "local"}, send: make(chan []byte, 8), room: r}
+	r.clients[local.Id] = local
+
+	r.handleEnvelope(&Envelope{Kind: EnvelopePresence, Node: "n2", User: &User{Id: "ghost"}, JoinTime: time.Now()})
+	r.handleEnvelope(&Envelope{Kind: EnvelopePresence, Node: "n3", User: &User{Id: "alive"}, JoinTime: time.Now()})
+	if r.FindClient("ghost") == nil || r.FindClient("alive") == nil {
+		t.Fatal("remote clients were not added")
+	}
+
+	// n3 继续发送心跳，n2 已停止
+	r.nodes["n2"] = time.Now().Add(-nodeTimeout)
+	r.handleEnvelope(&Envelope{Kind: EnvelopeHeartbeat, Node: "n3"})
+	r.expireNodes(time.Now())
+
+	if r.FindClient("ghost") != nil {
+		t.Fatal("client of the silent node was kept")
+	}
+	if r.FindClient("alive") == nil {
+		t.Fatal("client of a live node was removed")
+	}
+	if _, ok := r.nodes["n2"]; ok {
+		t.Fatal("silent node was kept")
+	}
+
+	select {
+	case msg := <-local.send:
+		var m struct {
+			Type MessageType `json:"type"`
+			From struct {
+				Id string `json:"id"`
+			} `json:"from"`
+		}
+		if err := json.Unmarshal(msg, &m); err != nil {
+			t.Fatal(err)
+		}
+		if m.Type != MessageTypeLeave || m.From.Id != "ghost" {
+			t.Fatalf("got %s from %s, want leave from ghost", m.Type, m.From.Id)
+		}
+	default:
+		t.Fatal("local client was not told that the ghost left")
+	}
+}
+
+// slowBroker blocks every publish until release is closed
+type slowBroker struct {
+	broker.Broker
+	release   chan struct{}
+	published chan []byte
+}
+
+func (b *slowBroker) Publish(ctx context.Context, topic string, payload []byte) error {
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	b.published <- payload
+	return nil
+}
+
+func TestPublishDoesNotWaitForBroker(t *testing.T) {
+	r := newTestRoom(t)
+	b := &slowBroker{release: make(chan struct{}), published: make(chan []byte, 10)}
+	r.server.Broker = b
+	r.outbound = make(chan *Envelope, outboundSize)
+	r.published = make(chan struct{})
+	go r.runPublish()
+
+	start := time.Now()
+	for _, to := range []string{"a", "b", "c"} {
+		r.publish(&Envelope{Kind: EnvelopeDirect, To: to})
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("publish waited %s for the broker", elapsed)
+	}
+
+	// 房间循环退出后，队列中的消息仍按顺序发布
+	close(r.done)
+	close(b.release)
+	select {
+	case <-r.published:
+	case <-time.After(time.Second):
+		t.Fatal("queued envelopes were not published")
+	}
+	for _, want := range []string{"a", "b", "c"} {
+		var env Envelope
+		if err := json.Unmarshal(<-b.published, &env); err != nil {
+			t.Fatal(err)
+		}
+		if env.To != want || env.Room != r.Id || env.Node != nodeId {
+			t.Fatalf("published %s to %s of room %s, want %s", env.Kind, env.To, env.Room, want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package webrtc
+
+import (
+	"encoding/json"
+	"log"
+	"meeting/internal/model/entity"
+)
+
+// SetLobby enables or disables the waiting room, clients already waiting are
+// admitted by the room loop once the lobby is disabled
+func (r *Room) SetLobby(enabled bool) {
+	r.lobby.Store(enabled)
+}
+
+// Admit lets a waiting client into the room or turns it away
+func (r *Room) Admit(clientId string, admitted bool) {
+	select {
+	case r.admission <- &LobbyDecisionPayload{ClientId: clientId, Admitted: admitted}:
+	case <-r.done:
+	}
+}
+
+// Admit delivers a lobby decision to the node holding the waiting client,
+// the room does not need to be running on this node
+func (s *Server) Admit(roomId, clientId string, admitted bool) {
+	if r := s.FindRoom(roomId); r != nil {
+		r.Admit(clientId, admitted)
+		return
+	}
+
+	b, _ := json.Marshal(&LobbyDecisionPayload{ClientId: clientId, Admitted: admitted})
+	s.publish(roomId, &Envelope{Kind: EnvelopeAdmit, To: clientId, Data: b})
+}
+
+// mustWait reports whether the client has to be admitted by a host, it must be called from the room loop
+func (r *Room) mustWait(client *Client) bool {
+	return r.lobby.Load() && !client.HasRole(entity.RoleModerator) && !r.admitted[client.Id]
+}
+
+// wait parks a client in the lobby and asks the hosts to admit it
+func (r *Room) wait(client *Client) {
+	// 同一用户重复连接，踢掉并断开旧连接，旧连接注销时不影响新连接的等待
+	if c, ok := r.waiting[client.Id]; ok {
+		c.handleKick()
+		c.closeLater()
+	}
+	client.waiting.Store(true)
+	r.waiting[client.Id] = client
+	client.Send(NewMessage(MessageTypeLobbyWait, nil, nil))
+
+	request := NewMessage(MessageTypeLobbyRequest, client, nil)
+	for _, c := range r.AllClients() {
+		if c.HasRole(entity.RoleModerator) {
+			c.Send(request)
+		}
+	}
+}
+
+// leaveLobby removes a client that disconnected while waiting
+func (r *Room) leaveLobby(client *Client) {
+	if c, ok := r.waiting[client.Id]; !ok || c != client {
+		return
+	}
+	delete(r.waiting, client.Id)
+
+	cancel := NewMessage(MessageTypeLobbyCancel, client, nil)
+	for _, c := range r.AllClients() {
+		if c.HasRole(entity.RoleModerator) {
+			c.Send(cancel)
+		}
+	}
+}
+
+// announceWaiting sends the pending requests of this node to a host that just joined
+func (r *Room) announceWaiting(host *Client) {
+	if !host.HasRole(entity.RoleModerator) {
+		return
+	}
+	for _, c := range r.waiting {
+		host.Send(NewMessage(MessageTypeLobbyRequest, c, nil))
+	}
+}
+
+// admit applies a decision made by a host of this node and forwards it to the other nodes
+func (r *Room) admit(d *LobbyDecisionPayload) {
+	r.decide(d)
+
+	b, err := json.Marshal(d)
+	if err != nil {
+		log.Println("marshal lobby decision error:", err)
+		return
+	}
+	r.publish(&Envelope{Kind: EnvelopeAdmit, To: d.ClientId, Data: b})
+}
+
+// decide records a lobby decision, notifies the local hosts and the waiting client, it must be called from the room loop
+func (r *Room) decide(d *LobbyDecisionPayload) {
+	if d.Admitted {
+		r.admitted[d.ClientId] = true
+	} else {
+		delete(r.admitted, d.ClientId)
+	}
+
+	decision := NewMessage(MessageTypeLobbyDecision, nil, d)
+	for _, c := range r.AllClients() {
+		if c.isLocal() && c.HasRole(entity.RoleModerator) {
+			c.Send(decision)
+		}
+	}
+
+	client, ok := r.waiting[d.ClientId]
+	if !ok {
+		return
+	}
+	delete(r.waiting, d.ClientId)
+	client.Send(decision)
+	if !d.Admitted {
+		client.closeLater()
+		return
+	}
+	client.waiting.Store(false)
+	r.join(client)
+}
+
+// admitAll lets every waiting client in after the lobby has been disabled
+func (r *Room) admitAll() {
+	for id := range r.waiting {
+		r.decide(&LobbyDecisionPayload{ClientId: id, Admitted: true})
+	}
+}
+
+func (c *Client) handleLobbyAdmit(message *Message) {
+	if !c.authorizeHost(message) {
+		return
+	}
+
+	var d LobbyDecisionPayload
+	_ = json.Unmarshal(message.Data, &d)
+	c.room.Admit(d.ClientId, d.Admitted)
+}
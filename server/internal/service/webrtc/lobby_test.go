@@ -0,0 +1,75 @@
+package webrtc
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialTestConn returns the server side of a websocket connection and the client side dialed to it
+func dialTestConn(t *testing.T) (*websocket.Conn, *websocket.Conn) {
+	t.Helper()
+	conns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, req, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = peer.Close() })
+	conn := <-conns
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn, peer
+}
+
+func TestWaitReplacesDuplicateConnection(t *testing.T) {
+	r := newTestRoom(t)
+	conn, peer := dialTestConn(t)
+	old := &Client{User: &User{Id: "guest"}, conn: conn, send: make(chan []byte, 8)}
+	dup := &Client{User: &User{Id: "guest"}, send: make(chan []byte, 8)}
+
+	r.wait(old)
+	r.wait(dup)
+	if r.waiting["guest"] != dup {
+		t.Fatal("the new connection is not waiting")
+	}
+
+	var kicked bool
+	for len(old.send) > 0 {
+		var m struct {
+			Type MessageType `json:"type"`
+		}
+		if err := json.Unmarshal(<-old.send, &m); err != nil {
+			t.Fatal(err)
+		}
+		kicked = kicked || m.Type == MessageTypeKick
+	}
+	if !kicked {
+		t.Fatal("the old connection was not kicked")
+	}
+
+	// 旧连接被断开，注销时不影响新连接的等待
+	_ = peer.SetReadDeadline(time.Now().Add(closeDelay + 2*time.Second))
+	_, _, err := peer.ReadMessage()
+	if ne, ok := err.(net.Error); err == nil || ok && ne.Timeout() {
+		t.Fatalf("the old connection was not closed: %v", err)
+	}
+	r.leaveLobby(old)
+	if r.waiting["guest"] != dup {
+		t.Fatal("unregistering the old connection removed the new one from the lobby")
+	}
+}
@@ -17,17 +17,59 @@ const (
 	MessageTypeAllClients  MessageType = "all-clients" // 客户端id列表
 	MessageTypeWebRTCEvent MessageType = "webrtc-event"
 	MessageTypeKick        MessageType = "kick" // 被踢了
+	MessageTypeMediaState  MessageType = "media-state"
+	MessageTypeHello       MessageType = "hello"   // 协议版本握手
+	MessageTypeWelcome     MessageType = "welcome" // 握手应答
+	MessageTypeError       MessageType = "error"   // 消息校验失败
+
+	MessageTypeLobbyWait     MessageType = "lobby-wait"     // 等待主持人准入
+	MessageTypeLobbyRequest  MessageType = "lobby-request"  // 通知主持人有成员等待
+	MessageTypeLobbyCancel   MessageType = "lobby-cancel"   // 等待的成员已离开
+	MessageTypeLobbyAdmit    MessageType = "lobby-admit"    // 主持人准入或拒绝
+	MessageTypeLobbyDecision MessageType = "lobby-decision" // 准入结果
+
+	MessageTypeMute        MessageType = "mute"         // 主持人关闭成员麦克风
+	MessageTypeStopVideo   MessageType = "stop-video"   // 主持人关闭成员摄像头
+	MessageTypeStopScreen  MessageType = "stop-screen"  // 主持人停止成员屏幕共享
+	MessageTypeRaiseHand   MessageType = "raise-hand"   // 举手或放下
+	MessageTypeLowerHands  MessageType = "lower-hands"  // 主持人放下所有人的手
+	MessageTypeEndMeeting  MessageType = "end-meeting"  // 主持人结束会议
+	MessageTypeRoleChanged MessageType = "role-changed" // 成员角色变更
+
+	MessageTypeRecordingStart MessageType = "recording-start" // 主持人开始录制
+	MessageTypeRecordingStop  MessageType = "recording-stop"  // 主持人停止录制
+	MessageTypeRecordingState MessageType = "recording-state" // 录制状态变化
+
+	MessageTypeServerRestarting MessageType = "server-restarting" // 服务端即将关闭，客户端应重新连接
+	MessageTypeSession          MessageType = "session"           // 会话恢复令牌
 )
 
+// Target addresses a single client of the room
+type Target struct {
+	Id string `json:"id"`
+}
+
 // Message represents a message to be sent to clients
 type Message struct {
-	Type     MessageType `json:"type"`
-	From     *Client     `json:"from"`
-	To       *Client     `json:"to,omitempty"` // todo 这里需要修改，不一定只是发送给一个人
-	Data     any         `json:"data,omitempty"`
+	Type     MessageType     `json:"type"`
+	From     *Client         `json:"from"`
+	To       *Target         `json:"to,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
 	receiver Receiver
 }
 
+// NewMessage creates a message whose data is the json encoding of data
+func NewMessage(t MessageType, from *Client, data any) *Message {
+	m := &Message{Type: t, From: from}
+	if data != nil {
+		if err := m.setData(data); err != nil {
+			log.Printf("encode %s message data error: %v", t, err)
+		}
+	}
+
+	return m
+}
+
 func (m *Message) Bytes() ([]byte, error) {
 	b, err := json.Marshal(m)
 	if err != nil {
@@ -1,7 +1,9 @@
 package webrtc
 
 import (
+	"encoding/json"
 	"log"
+	"meeting/internal/model/entity"
 	"time"
 )
 
@@ -12,7 +14,20 @@ func (c *Client) handleMessage(message *Message) {
 			log.Printf("Error processing message from client %s: %v", c.Id, err)
 		}
 	}()
+	if err := message.validate(); err != nil {
+		messagesReceived.WithLabelValues("invalid").Inc()
+		c.sendError(message.Type, err)
+		return
+	}
+	messagesReceived.WithLabelValues(string(message.Type)).Inc()
+	// 等待准入的客户端只能握手和保活
+	if c.waiting.Load() && message.Type != MessageTypeHello && message.Type != MessageTypePing {
+		c.sendError(message.Type, newProtocolError(ErrorCodeForbidden, "waiting for admission"))
+		return
+	}
 	switch message.Type {
+	case MessageTypeHello:
+		c.handleHello(message)
 	case MessageTypePing:
 		c.handlePing()
 	case MessageTypeAllClients:
@@ -21,19 +36,83 @@ func (c *Client) handleMessage(message *Message) {
 		c.handleChat(message)
 	case MessageTypeWebRTCEvent:
 		c.handleWebRTCEvent(message)
+	case MessageTypeMediaState:
+		c.handleMediaState(message)
+	case MessageTypeLobbyAdmit:
+		c.handleLobbyAdmit(message)
+	case MessageTypeMute, MessageTypeStopVideo, MessageTypeStopScreen:
+		c.handleModerate(message)
+	case MessageTypeRaiseHand:
+		c.handleRaiseHand(message)
+	case MessageTypeLowerHands:
+		c.handleLowerHands(message)
+	case MessageTypeEndMeeting:
+		c.handleEndMeeting(message)
+	case MessageTypeRecordingStart:
+		c.handleRecordingStart(message)
+	case MessageTypeRecordingStop:
+		c.handleRecordingStop(message)
 	default:
 		log.Printf("Unknown message type received from client %s: %s", c.Id, message.Type)
 	}
 }
 
+func (c *Client) handleHello(message *Message) {
+	var hello HelloPayload
+	_ = json.Unmarshal(message.Data, &hello)
+	// 版本已在 validate 中检查
+	c.protocol = min(hello.Version, ProtocolVersion)
+	c.Send(c.newMessage(MessageTypeWelcome, &WelcomePayload{
+		Version:       c.protocol,
+		ServerVersion: ProtocolVersion,
+		MinVersion:    MinProtocolVersion,
+		ClientId:      c.Id,
+	}, nil))
+}
+
 func (c *Client) handlePing() {
-	if time.Since(c.lastMessageTime) < time.Second*9 {
+	if time.Since(c.lastMessageAt()) < time.Second*9 {
 		return
 	}
 	c.Send(c.newMessage(MessageTypePong, nil, nil))
 }
 
 func (c *Client) handleChat(message *Message) {
+	if !c.Can(entity.CapabilityChat) {
+		c.sendError(message.Type, newProtocolError(ErrorCodeForbidden, "chat is not allowed for your role"))
+		return
+	}
+	var chat ChatPayload
+	_ = json.Unmarshal(message.Data, &chat)
+	// 以服务端时间为准
+	chat.Timestamp = time.Now().UnixMilli()
+	if err := message.setData(&chat); err != nil {
+		c.sendError(message.Type, err)
+		return
+	}
+
+	c.room.saveChat(c.User, &chat)
+	c.room.Broadcast(message)
+	c.room.dispatchWebhook(entity.WebhookEventChatMessage, &ChatMessageData{
+		Id:        chat.Id,
+		Content:   chat.Content,
+		Timestamp: chat.Timestamp,
+		From:      c.participant(),
+	})
+}
+
+func (c *Client) handleMediaState(message *Message) {
+	var state MediaStatePayload
+	_ = json.Unmarshal(message.Data, &state)
+	if (state.Video || state.Audio) && !c.Can(entity.CapabilityPublish) {
+		c.sendError(message.Type, newProtocolError(ErrorCodeForbidden, "publishing is not allowed for your role"))
+		return
+	}
+	if (state.Screen || state.DesktopAudio) && !c.Can(entity.CapabilityScreenShare) {
+		c.sendError(message.Type, newProtocolError(ErrorCodeForbidden, "screen sharing is not allowed for your role"))
+		return
+	}
+	c.media.Store(&state)
 	c.room.Broadcast(message)
 }
 
@@ -42,9 +121,19 @@ func (c *Client) handleAllClients(message *Message) {
 }
 
 func (c *Client) handleWebRTCEvent(message *Message) {
+	if c.room.sfu != nil && (message.To == nil || message.To.Id == SFUClientId) {
+		var event WebRTCEvent
+		_ = json.Unmarshal(message.Data, &event)
+		c.room.sfu.HandleEvent(c, &event)
+		return
+	}
+	if message.To == nil || message.To.Id == "" {
+		c.sendError(message.Type, newProtocolError(ErrorCodeInvalidPayload, "to is required"))
+		return
+	}
 	targetClient := c.room.FindClient(message.To.Id)
 	if targetClient == nil {
-		log.Printf("Target client %s not found for offer", message.To.Id)
+		c.sendError(message.Type, newProtocolError(ErrorCodeTargetNotFound, "client %s not found", message.To.Id))
 		return
 	}
 	targetClient.Send(message)
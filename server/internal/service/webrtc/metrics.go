@@ -0,0 +1,124 @@
+package webrtc
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const metricsNamespace = "met"
+
+var (
+	messagesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "messages_received_total",
+		Help:      "Signaling messages received from clients by type, messages failing validation are counted as invalid.",
+	}, []string{"type"})
+
+	messagesDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "messages_dropped_total",
+		Help:      "Messages that could not be delivered to a client by reason.",
+	}, []string{"reason"})
+
+	// UpgradeFailures counts websocket handshakes that failed
+	UpgradeFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "websocket_upgrade_failures_total",
+		Help:      "Websocket upgrades that failed.",
+	})
+
+	signatureFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "signature_validation_failures_total",
+		Help:      "Join tokens rejected by reason.",
+	}, []string{"reason"})
+)
+
+// signatureFailureReasons labels the errors of ValidateSignature
+var signatureFailureReasons = map[error]string{
+	ErrMissingRequiredFields: "missing_fields",
+	ErrInvalidSignature:      "invalid",
+	ErrSignatureExpired:      "expired",
+	ErrUnknownKey:            "unknown_key",
+}
+
+// reasons of messagesDropped
+const (
+	dropQueueFull = "queue_full"
+	dropOverflow  = "pending_overflow"
+)
+
+var (
+	roomsDesc = prometheus.NewDesc(metricsNamespace+"_rooms",
+		"Rooms running on this node.", nil, nil)
+	clientsDesc = prometheus.NewDesc(metricsNamespace+"_clients",
+		"Clients connected to this node by state.", []string{"state"}, nil)
+	maxOnlineDesc = prometheus.NewDesc(metricsNamespace+"_room_max_online",
+		"Peak number of clients in a room.", []string{"room"}, nil)
+	sendQueueDesc = prometheus.NewDesc(metricsNamespace+"_client_send_queue_depth",
+		"Messages waiting to be written to each connected client of this node.", nil, nil)
+)
+
+// sendQueueBuckets covers an idle client up to a full send queue and pending buffer
+var sendQueueBuckets = []float64{0, 1, 4, 16, 64, 128, 256, 512}
+
+func init() {
+	prometheus.MustRegister(&collector{server: WsServer})
+}
+
+// collector reports the state of the rooms when metrics are scraped
+type collector struct {
+	server *Server
+}
+
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- roomsDesc
+	ch <- clientsDesc
+	ch <- maxOnlineDesc
+	ch <- sendQueueDesc
+}
+
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	rooms := c.server.allRooms()
+	ch <- prometheus.MustNewConstMetric(roomsDesc, prometheus.GaugeValue, float64(len(rooms)))
+
+	var connected, detached int
+	// 客户端数量不固定，队列长度以直方图汇总，避免按客户端打标签
+	var queued, sum uint64
+	buckets := make(map[float64]uint64, len(sendQueueBuckets))
+	for _, r := range rooms {
+		r.mu.RLock()
+		maxOnline := r.MaxOnline
+		r.mu.RUnlock()
+		ch <- prometheus.MustNewConstMetric(maxOnlineDesc, prometheus.GaugeValue, float64(maxOnline), r.Id)
+
+		for _, client := range r.AllClients() {
+			if !client.isLocal() {
+				continue
+			}
+			if client.detachedSince().IsZero() {
+				connected++
+			} else {
+				detached++
+			}
+			depth := client.queueDepth()
+			queued++
+			sum += uint64(depth)
+			for _, b := range sendQueueBuckets {
+				if float64(depth) <= b {
+					buckets[b]++
+				}
+			}
+		}
+	}
+	ch <- prometheus.MustNewConstHistogram(sendQueueDesc, queued, float64(sum), buckets)
+	ch <- prometheus.MustNewConstMetric(clientsDesc, prometheus.GaugeValue, float64(connected), "connected")
+	ch <- prometheus.MustNewConstMetric(clientsDesc, prometheus.GaugeValue, float64(detached), "detached")
+}
+
+// queueDepth returns the number of messages not yet written to the connection
+func (c *Client) queueDepth() int {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+	return len(c.send) + len(c.pending)
+}
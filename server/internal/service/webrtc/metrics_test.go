@@ -0,0 +1,44 @@
+package webrtc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollectorSendQueueDepth(t *testing.T) {
+	r := newTestRoom(t)
+	r.server.rooms[r.Id] = r
+	for i, depth := range []int{0, 3, 100} {
+		c := &Client{User: &User{Id: string(rune('a' + i))}, send: make(chan []byte, 256), room: r}
+		for range depth {
+			c.send <- nil
+		}
+		r.clients[c.Id] = c
+	}
+	// 其他节点上的客户端不计入
+	r.clients["remote"] = &Client{User: &User{Id: "remote"}, node: "n2", send: make(chan []byte, 256)}
+	for range 10 {
+		r.clients["remote"].send <- nil
+	}
+
+	want := `
+# HELP met_client_send_queue_depth Messages waiting to be written to each connected client of this node.
+# TYPE met_client_send_queue_depth histogram
+met_client_send_queue_depth_bucket{le="0"} 1
+met_client_send_queue_depth_bucket{le="1"} 1
+met_client_send_queue_depth_bucket{le="4"} 2
+met_client_send_queue_depth_bucket{le="16"} 2
+met_client_send_queue_depth_bucket{le="64"} 2
+met_client_send_queue_depth_bucket{le="128"} 3
+met_client_send_queue_depth_bucket{le="256"} 3
+met_client_send_queue_depth_bucket{le="512"} 3
+met_client_send_queue_depth_bucket{le="+Inf"} 3
+met_client_send_queue_depth_sum 103
+met_client_send_queue_depth_count 3
+`
+	if err := testutil.CollectAndCompare(&collector{server: r.server}, strings.NewReader(want), "met_client_send_queue_depth"); err != nil {
+		t.Fatal(err)
+	}
+}
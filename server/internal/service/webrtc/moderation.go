@@ -0,0 +1,71 @@
+package webrtc
+
+import (
+	"meeting/internal/model/entity"
+)
+
+// authorizeHost reports whether the sender is a host or co-host, answering with an error otherwise
+func (c *Client) authorizeHost(message *Message) bool {
+	if c.HasRole(entity.RoleModerator) {
+		return true
+	}
+	c.sendError(message.Type, newProtocolError(ErrorCodeForbidden, "only hosts can send %s", message.Type))
+
+	return false
+}
+
+// handleModerate relays a mute, stop-video or stop-screen request of a host to its target
+func (c *Client) handleModerate(message *Message) {
+	if !c.authorizeHost(message) {
+		return
+	}
+
+	target := c.room.FindClient(message.To.Id)
+	if target == nil {
+		c.sendError(message.Type, newProtocolError(ErrorCodeTargetNotFound, "client %s not found", message.To.Id))
+		return
+	}
+	target.Send(message)
+}
+
+// handleRaiseHand lets a participant raise or lower its own hand
+func (c *Client) handleRaiseHand(message *Message) {
+	c.room.Broadcast(message)
+}
+
+// handleLowerHands lowers the hands of every participant
+func (c *Client) handleLowerHands(message *Message) {
+	if !c.authorizeHost(message) {
+		return
+	}
+	c.room.Broadcast(message)
+}
+
+// handleEndMeeting asks every participant to leave and closes the room on every node
+func (c *Client) handleEndMeeting(message *Message) {
+	if !c.authorizeHost(message) {
+		return
+	}
+	message.To = nil
+	msg, err := message.Bytes()
+	if err != nil {
+		return
+	}
+	r := c.room
+	r.publish(&Envelope{Kind: EnvelopeEnd, From: c.Id, Data: msg})
+	r.end(msg)
+}
+
+// end delivers the end-meeting message, disconnects the local clients and stops the room,
+// it must not be called from the room loop
+func (r *Room) end(msg []byte) {
+	r.deliver(msg, "")
+	for _, c := range r.AllClients() {
+		if c.isLocal() {
+			r.UnregisterClient(c)
+			c.closeLater()
+		}
+	}
+	r.Close()
+	r.server.RemoveRoom(r.Id)
+}
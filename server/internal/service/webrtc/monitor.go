@@ -0,0 +1,121 @@
+package webrtc
+
+import (
+	"meeting/internal/model/entity"
+	"sync"
+	"time"
+)
+
+// monitorBufferSize is the number of events buffered for a slow subscriber before events are dropped
+const monitorBufferSize = 64
+
+// RoomEventType is the kind of a room lifecycle event
+type RoomEventType string
+
+const (
+	RoomEventStarted      RoomEventType = "room-started"
+	RoomEventClosed       RoomEventType = "room-closed"
+	RoomEventClientJoined RoomEventType = "client-joined"
+	RoomEventClientLeft   RoomEventType = "client-left"
+)
+
+// RoomEvent is delivered to monitoring subscribers when a room or its clients change
+type RoomEvent struct {
+	Type   RoomEventType `json:"type"`
+	RoomId string        `json:"roomId"`
+	Time   time.Time     `json:"time"`
+	// Room is the state of the room after the event, nil once the room is closed
+	Room   *RoomInfo   `json:"room,omitempty"`
+	Client *ClientInfo `json:"client,omitempty"`
+}
+
+// ClientInfo describes a client for monitoring
+type ClientInfo struct {
+	Id              string      `json:"id"`
+	Name            string      `json:"name"`
+	Avatar          string      `json:"avatar"`
+	Role            entity.Role `json:"role"`
+	RoleName        string      `json:"roleName"`
+	Node            string      `json:"node,omitempty"`
+	JoinTime        time.Time   `json:"joinTime"`
+	LastMessageTime time.Time   `json:"lastMessageTime"`
+	// SendQueue and SendQueueCap describe the outbound buffer of local clients
+	SendQueue    int  `json:"sendQueue"`
+	SendQueueCap int  `json:"sendQueueCap"`
+	Detached     bool `json:"detached"`
+}
+
+// monitor fans room events out to the subscribers of the monitoring stream
+type monitor struct {
+	mu          sync.Mutex
+	subscribers map[chan *RoomEvent]struct{}
+}
+
+// Subscribe returns a channel receiving room events until cancel is called
+func (s *Server) Subscribe() (events <-chan *RoomEvent, cancel func()) {
+	ch := make(chan *RoomEvent, monitorBufferSize)
+	s.monitor.mu.Lock()
+	if s.monitor.subscribers == nil {
+		s.monitor.subscribers = make(map[chan *RoomEvent]struct{})
+	}
+	s.monitor.subscribers[ch] = struct{}{}
+	s.monitor.mu.Unlock()
+
+	return ch, func() {
+		s.monitor.mu.Lock()
+		delete(s.monitor.subscribers, ch)
+		s.monitor.mu.Unlock()
+	}
+}
+
+// closeSubscribers ends every monitoring stream, it is called on shutdown
+func (s *Server) closeSubscribers() {
+	s.monitor.mu.Lock()
+	defer s.monitor.mu.Unlock()
+	for ch := range s.monitor.subscribers {
+		close(ch)
+		delete(s.monitor.subscribers, ch)
+	}
+}
+
+// notify sends an event to every subscriber without blocking the caller
+func (s *Server) notify(event *RoomEvent) {
+	event.Time = time.Now()
+	s.monitor.mu.Lock()
+	defer s.monitor.mu.Unlock()
+	for ch := range s.monitor.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// 订阅者处理过慢，丢弃事件，客户端可以重新拉取完整数据
+		}
+	}
+}
+
+// notifyClient reports a client joining or leaving the room, the caller must not hold r.mu
+func (r *Room) notifyClient(t RoomEventType, c *Client) {
+	r.server.notify(&RoomEvent{Type: t, RoomId: r.Id, Room: r.Info(), Client: c.Info()})
+}
+
+// Info returns a snapshot of the client for monitoring
+func (c *Client) Info() *ClientInfo {
+	role := c.currentRole()
+	info := &ClientInfo{
+		Id:       c.Id,
+		Name:     c.Name,
+		Avatar:   c.Avatar,
+		Role:     role,
+		RoleName: role.String(),
+		Node:     c.node,
+		JoinTime: c.joinTime,
+	}
+
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+	info.LastMessageTime = c.lastMessageTime
+	info.SendQueue = len(c.send) + len(c.pending)
+	info.SendQueueCap = cap(c.send)
+	info.Detached = !c.detachedAt.IsZero()
+
+	return info
+}
@@ -0,0 +1,260 @@
+package webrtc
+
+import (
+	"encoding/json"
+	"fmt"
+	"meeting/internal/model/entity"
+	"time"
+	"unicode/utf8"
+)
+
+// Signaling protocol versions.
+//
+// Version 1 is the original untyped protocol, clients that never send a hello
+// message are assumed to speak it. Version 2 adds the hello/welcome handshake,
+// typed payloads validated by the server and error replies. Both versions share
+// the same wire layout for the messages they have in common, so clients of
+// different versions can be in the same room.
+const (
+	ProtocolVersion    = 2
+	MinProtocolVersion = 1
+)
+
+const maxChatLength = 4000
+
+type ErrorCode string
+
+const (
+	ErrorCodeInvalidJSON        ErrorCode = "invalid_json"
+	ErrorCodeUnknownType        ErrorCode = "unknown_type"
+	ErrorCodeInvalidPayload     ErrorCode = "invalid_payload"
+	ErrorCodeTargetNotFound     ErrorCode = "target_not_found"
+	ErrorCodeUnsupportedVersion ErrorCode = "unsupported_version"
+	ErrorCodeForbidden          ErrorCode = "forbidden"
+	ErrorCodeConflict           ErrorCode = "conflict"
+	ErrorCodeInternal           ErrorCode = "internal_error"
+)
+
+// ProtocolError is reported to the sender of an invalid message
+type ProtocolError struct {
+	Code    ErrorCode
+	Message string
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func newProtocolError(code ErrorCode, format string, args ...any) *ProtocolError {
+	return &ProtocolError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// HelloPayload is sent by the client right after connecting
+type HelloPayload struct {
+	Version int `json:"version"`
+}
+
+// WelcomePayload answers a hello with the negotiated version
+type WelcomePayload struct {
+	Version       int    `json:"version"`
+	ServerVersion int    `json:"serverVersion"`
+	MinVersion    int    `json:"minVersion"`
+	ClientId      string `json:"clientId"`
+}
+
+// ErrorPayload is the data of an error message
+type ErrorPayload struct {
+	Code    ErrorCode   `json:"code"`
+	Message string      `json:"message"`
+	Type    MessageType `json:"type,omitempty"` // type of the rejected message
+}
+
+// SessionDescription is the data of an offer or answer webrtc-event
+type SessionDescription struct {
+	Type string `json:"type"`
+	SDP  string `json:"sdp"`
+}
+
+// IceCandidate is the data of an ice-candidate webrtc-event
+type IceCandidate struct {
+	Candidate        string  `json:"candidate"`
+	SDPMid           *string `json:"sdpMid,omitempty"`
+	SDPMLineIndex    *uint16 `json:"sdpMLineIndex,omitempty"`
+	UsernameFragment *string `json:"usernameFragment,omitempty"`
+}
+
+type WebRTCEventType string
+
+const (
+	WebRTCEventOffer        WebRTCEventType = "offer"
+	WebRTCEventAnswer       WebRTCEventType = "answer"
+	WebRTCEventIceCandidate WebRTCEventType = "ice-candidate"
+)
+
+// WebRTCEvent is the payload of a webrtc-event message
+type WebRTCEvent struct {
+	Type WebRTCEventType `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// MediaStatePayload is the data of a media-state message
+type MediaStatePayload struct {
+	Video        bool `json:"video"`
+	Audio        bool `json:"audio"`
+	Screen       bool `json:"screen"`
+	DesktopAudio bool `json:"desktopAudio"`
+}
+
+// ChatPayload is the data of a chat message
+type ChatPayload struct {
+	Id        string `json:"id"`
+	Content   string `json:"content"`
+	Timestamp int64  `json:"timestamp"`
+	// File is set by the server when the message shares an uploaded file
+	File *FilePayload `json:"file,omitempty"`
+}
+
+// FilePayload describes a file uploaded to the room, it is downloaded from the files API
+type FilePayload struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	MimeType  string    `json:"mimeType"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// LobbyDecisionPayload is the data of lobby-admit and lobby-decision messages
+type LobbyDecisionPayload struct {
+	ClientId string `json:"clientId"`
+	Admitted bool   `json:"admitted"`
+}
+
+// RolePayload is the data of a role-changed message
+type RolePayload struct {
+	ClientId     string              `json:"clientId"`
+	Role         entity.Role         `json:"role"`
+	Capabilities []entity.Capability `json:"capabilities,omitempty"`
+}
+
+// RaiseHandPayload is the data of a raise-hand message
+type RaiseHandPayload struct {
+	Raised bool `json:"raised"`
+}
+
+// RecordingStatePayload is the data of a recording-state message
+type RecordingStatePayload struct {
+	Active      bool       `json:"active"`
+	RecordingId string     `json:"recordingId,omitempty"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+}
+
+// decodePayload decodes the message data into v, unknown fields are ignored so that newer clients stay compatible
+func decodePayload(data json.RawMessage, v any) *ProtocolError {
+	if len(data) == 0 {
+		return newProtocolError(ErrorCodeInvalidPayload, "missing data")
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return newProtocolError(ErrorCodeInvalidPayload, "%v", err)
+	}
+
+	return nil
+}
+
+// validate checks the message against the schema of its type and normalizes its data
+func (m *Message) validate() *ProtocolError {
+	switch m.Type {
+	case MessageTypePing, MessageTypeAllClients:
+		return nil
+	case MessageTypeMute, MessageTypeStopVideo, MessageTypeStopScreen:
+		if m.To == nil || m.To.Id == "" {
+			return newProtocolError(ErrorCodeInvalidPayload, "to is required")
+		}
+		m.Data = nil
+		return nil
+	case MessageTypeLowerHands, MessageTypeEndMeeting, MessageTypeRecordingStart, MessageTypeRecordingStop:
+		m.Data = nil
+		return nil
+	case MessageTypeRaiseHand:
+		var hand RaiseHandPayload
+		if err := decodePayload(m.Data, &hand); err != nil {
+			return err
+		}
+		return m.setData(hand)
+	case MessageTypeHello:
+		var hello HelloPayload
+		if err := decodePayload(m.Data, &hello); err != nil {
+			return err
+		}
+		if hello.Version == 0 {
+			return newProtocolError(ErrorCodeInvalidPayload, "version is required")
+		}
+		if hello.Version < MinProtocolVersion {
+			return newProtocolError(ErrorCodeUnsupportedVersion, "minimum supported version is %d", MinProtocolVersion)
+		}
+		return nil
+	case MessageTypeWebRTCEvent:
+		var event WebRTCEvent
+		if err := decodePayload(m.Data, &event); err != nil {
+			return err
+		}
+		switch event.Type {
+		case WebRTCEventOffer, WebRTCEventAnswer:
+			var sd SessionDescription
+			if err := decodePayload(event.Data, &sd); err != nil {
+				return err
+			}
+			if sd.Type != string(event.Type) || sd.SDP == "" {
+				return newProtocolError(ErrorCodeInvalidPayload, "invalid %s session description", event.Type)
+			}
+		case WebRTCEventIceCandidate:
+			var candidate IceCandidate
+			if err := decodePayload(event.Data, &candidate); err != nil {
+				return err
+			}
+		default:
+			return newProtocolError(ErrorCodeInvalidPayload, "unknown webrtc event type %q", event.Type)
+		}
+		return nil
+	case MessageTypeMediaState:
+		var state MediaStatePayload
+		if err := decodePayload(m.Data, &state); err != nil {
+			return err
+		}
+		return m.setData(state)
+	case MessageTypeChat:
+		var chat ChatPayload
+		if err := decodePayload(m.Data, &chat); err != nil {
+			return err
+		}
+		if chat.Content == "" {
+			return newProtocolError(ErrorCodeInvalidPayload, "content is required")
+		}
+		if utf8.RuneCountInString(chat.Content) > maxChatLength {
+			return newProtocolError(ErrorCodeInvalidPayload, "content exceeds %d characters", maxChatLength)
+		}
+		// 文件消息只能由服务端在上传完成后发送
+		chat.File = nil
+		return m.setData(chat)
+	case MessageTypeLobbyAdmit:
+		var d LobbyDecisionPayload
+		if err := decodePayload(m.Data, &d); err != nil {
+			return err
+		}
+		if d.ClientId == "" {
+			return newProtocolError(ErrorCodeInvalidPayload, "clientId is required")
+		}
+		return m.setData(d)
+	default:
+		return newProtocolError(ErrorCodeUnknownType, "unknown message type %q", m.Type)
+	}
+}
+
+func (m *Message) setData(data any) *ProtocolError {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return newProtocolError(ErrorCodeInvalidPayload, "%v", err)
+	}
+	m.Data = b
+
+	return nil
+}
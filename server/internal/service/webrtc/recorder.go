@@ -0,0 +1,553 @@
+package webrtc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"meeting/internal/model/entity"
+	"meeting/pkg/config"
+	"meeting/pkg/database"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
+	pion "github.com/pion/webrtc/v4"
+	"gorm.io/gorm"
+)
+
+// RecorderClientId is the client id of the server side recorder
+const RecorderClientId = "recorder"
+
+// recordKeyframeInterval controls how often a keyframe is requested until a video track starts
+const recordKeyframeInterval = time.Second
+
+// recordHeartbeat is how often an active recording refreshes its row, recordings not refreshed for
+// three intervals were left behind by a node that stopped and are marked failed by FailInterruptedRecordings
+const recordHeartbeat = time.Minute
+
+// Recorder joins the room as a client and writes the media of every participant to files.
+//
+// In mesh rooms it holds one receive only PeerConnection per participant, negotiated
+// like any other peer. In SFU rooms it takes the packets forwarded by the SFU.
+type Recorder struct {
+	room *Room
+	// self is the client of the recorder in the room, messages sent to it are handled by pump
+	self      *Client
+	recording *entity.Recording
+	dir       string
+	api       *pion.API
+
+	mu     sync.Mutex
+	peers  map[string]*pion.PeerConnection
+	tracks map[string]*recordTrack
+	seq    int
+
+	closed   chan struct{}
+	stopOnce sync.Once
+}
+
+// recorderMessage is a message delivered to the recorder by the room
+type recorderMessage struct {
+	Type MessageType     `json:"type"`
+	From *User           `json:"from"`
+	Data json.RawMessage `json:"data"`
+}
+
+// handleRecordingStart starts recording the room on behalf of a host
+func (c *Client) handleRecordingStart(message *Message) {
+	if !c.authorizeHost(message) {
+		return
+	}
+	if c.room.FindClient(RecorderClientId) != nil {
+		c.sendError(message.Type, newProtocolError(ErrorCodeConflict, "recording is already active"))
+		return
+	}
+	if err := c.room.startRecording(c); err != nil {
+		log.Printf("start recording of room %s error: %v", c.room.Id, err)
+		c.sendError(message.Type, newProtocolError(ErrorCodeInternal, "failed to start recording"))
+	}
+}
+
+// handleRecordingStop asks the recorder of the room to stop, it may run on another node
+func (c *Client) handleRecordingStop(message *Message) {
+	if !c.authorizeHost(message) {
+		return
+	}
+	recorder := c.room.FindClient(RecorderClientId)
+	if recorder == nil {
+		c.sendError(message.Type, newProtocolError(ErrorCodeConflict, "recording is not active"))
+		return
+	}
+	recorder.Send(message)
+}
+
+// startRecording adds a recorder to the room and tells every participant
+func (r *Room) startRecording(by *Client) error {
+	now := time.Now()
+	rec := &Recorder{
+		room:   r,
+		peers:  make(map[string]*pion.PeerConnection),
+		tracks: make(map[string]*recordTrack),
+		closed: make(chan struct{}),
+		recording: &entity.Recording{
+			Uuid:      uuid.New().String(),
+			RoomId:    r.entityId(),
+			Status:    entity.RecordingStatusRecording,
+			StartedAt: now,
+		},
+	}
+	rec.self = &Client{
+		User:     &User{Id: RecorderClientId, Name: "Recorder", Role: entity.RoleViewer},
+		room:     r,
+		send:     make(chan []byte, 256),
+		joinTime: now,
+		protocol: ProtocolVersion,
+		recorder: rec,
+	}
+	if !r.recorder.CompareAndSwap(nil, rec) {
+		return fmt.Errorf("recording is already active")
+	}
+
+	if err := rec.prepare(by); err != nil {
+		r.recorder.CompareAndSwap(rec, nil)
+		return err
+	}
+
+	r.mu.Lock()
+	if _, ok := r.clients[RecorderClientId]; ok {
+		r.mu.Unlock()
+		r.recorder.CompareAndSwap(rec, nil)
+		rec.finish(entity.RecordingStatusFailed, 0)
+		return fmt.Errorf("recording is already active")
+	}
+	r.clients[RecorderClientId] = rec.self
+	r.mu.Unlock()
+
+	go rec.pump()
+	// mesh 模式下其他成员收到加入消息后会向录制端发起连接
+	r.emit(rec.self.newMessage(MessageTypeJoin, nil, nil))
+	r.emit(rec.self.newMessage(MessageTypeRecordingState, rec.state(true), nil))
+	log.Printf("recording %s of room %s started by %s", rec.recording.Uuid, r.Id, by.Id)
+
+	return nil
+}
+
+// prepare creates the directory and the database record of the recording
+func (rec *Recorder) prepare(by *Client) error {
+	db := database.DB(context.Background())
+	var user entity.User
+	if err := db.Where("uuid=?", by.Id).First(&user).Error; err != nil {
+		return err
+	}
+	rec.recording.StartedBy = user.Id
+
+	rec.dir = rec.recording.Dir(config.GetConfig().Recording.Dir, rec.room.Id)
+	if err := os.MkdirAll(rec.dir, 0o750); err != nil {
+		return err
+	}
+	if rec.room.sfu == nil {
+		api, err := newRecorderAPI()
+		if err != nil {
+			return err
+		}
+		rec.api = api
+	}
+
+	return db.Create(rec.recording).Error
+}
+
+// state returns the data of the recording-state message
+func (rec *Recorder) state(active bool) *RecordingStatePayload {
+	state := &RecordingStatePayload{Active: active, RecordingId: rec.recording.Uuid}
+	if active {
+		state.StartedAt = &rec.recording.StartedAt
+	}
+
+	return state
+}
+
+// Stop finishes the files of the recording and takes the recorder out of the room
+func (rec *Recorder) Stop() {
+	rec.stopOnce.Do(func() {
+		r := rec.room
+		r.recorder.CompareAndSwap(rec, nil)
+		close(rec.closed)
+
+		r.mu.Lock()
+		if c, ok := r.clients[RecorderClientId]; ok && c == rec.self {
+			delete(r.clients, RecorderClientId)
+		}
+		r.mu.Unlock()
+
+		rec.mu.Lock()
+		peers, tracks := rec.peers, rec.tracks
+		rec.peers, rec.tracks = nil, nil
+		rec.mu.Unlock()
+		for _, pc := range peers {
+			_ = pc.Close()
+		}
+		var size int64
+		for _, t := range tracks {
+			if t != nil {
+				size += t.close()
+			}
+		}
+		rec.finish(entity.RecordingStatusCompleted, size)
+
+		r.emit(rec.self.newMessage(MessageTypeLeave, nil, nil))
+		r.emit(rec.self.newMessage(MessageTypeRecordingState, rec.state(false), nil))
+		log.Printf("recording %s of room %s stopped", rec.recording.Uuid, r.Id)
+	})
+}
+
+// finish marks the recording as stopped
+func (rec *Recorder) finish(status string, size int64) {
+	now := time.Now()
+	rec.recording.Status = status
+	rec.recording.StoppedAt = &now
+	rec.recording.Size = size
+	if err := database.DB(context.Background()).Model(rec.recording).Updates(map[string]any{
+		"status":     status,
+		"stopped_at": now,
+		"size":       size,
+	}).Error; err != nil {
+		log.Printf("update recording %s error: %v", rec.recording.Uuid, err)
+	}
+}
+
+// pump handles the messages the room delivers to the recorder
+func (rec *Recorder) pump() {
+	heartbeat := time.NewTicker(recordHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case msg := <-rec.self.send:
+			rec.handle(msg)
+		case <-heartbeat.C:
+			if err := database.DB(context.Background()).Model(rec.recording).
+				Where("status = ?", entity.RecordingStatusRecording).UpdateColumn("updated_at", time.Now()).Error; err != nil {
+				log.Printf("refresh recording %s error: %v", rec.recording.Uuid, err)
+			}
+		case <-rec.closed:
+			return
+		}
+	}
+}
+
+// FailInterruptedRecordings marks the recordings left in the recording status by a node that exited
+// without stopping them, the files written so far are kept. With a single node every such recording
+// is interrupted, with several nodes only those no longer refreshed by a running node
+func FailInterruptedRecordings(ctx context.Context) (int64, error) {
+	query := database.DB(ctx).Model(&entity.Recording{}).Where("status = ?", entity.RecordingStatusRecording)
+	if strings.EqualFold(config.GetConfig().Broker.Driver, "redis") {
+		query = query.Where("updated_at < ?", time.Now().Add(-3*recordHeartbeat))
+	}
+	// 以最后一次刷新的时间作为停止时间
+	res := query.UpdateColumns(map[string]any{
+		"status":     entity.RecordingStatusFailed,
+		"stopped_at": gorm.Expr("updated_at"),
+	})
+	return res.RowsAffected, res.Error
+}
+
+func (rec *Recorder) handle(msg []byte) {
+	var message recorderMessage
+	if err := json.Unmarshal(msg, &message); err != nil || message.From == nil {
+		return
+	}
+
+	switch message.Type {
+	case MessageTypeRecordingStop:
+		// 停止请求已由发送者所在的节点校验过角色
+		if message.From.Role&entity.RoleModerator != 0 {
+			rec.Stop()
+		}
+	case MessageTypeJoin:
+		if rec.api != nil && message.From.Id != RecorderClientId {
+			rec.offer(message.From)
+		}
+	case MessageTypeLeave:
+		rec.removePeer(message.From.Id)
+	case MessageTypeWebRTCEvent:
+		if rec.api == nil {
+			return
+		}
+		var event WebRTCEvent
+		if err := json.Unmarshal(message.Data, &event); err != nil {
+			return
+		}
+		rec.handleEvent(message.From, &event)
+	}
+}
+
+// handleEvent processes a webrtc-event sent by a participant to the recorder
+func (rec *Recorder) handleEvent(from *User, event *WebRTCEvent) {
+	switch event.Type {
+	case WebRTCEventOffer:
+		var offer pion.SessionDescription
+		if err := json.Unmarshal(event.Data, &offer); err != nil {
+			return
+		}
+		pc := rec.findPeer(from.Id)
+		if pc != nil && pc.SignalingState() == pion.SignalingStateHaveLocalOffer {
+			// 双方同时发起协商时，录制端放弃自己的 offer，用新的连接应答
+			rec.removePeer(from.Id)
+			pc = nil
+		}
+		if pc == nil {
+			var err error
+			if pc, err = rec.newPeer(from); err != nil {
+				log.Printf("recorder: create peer connection for client %s error: %v", from.Id, err)
+				return
+			}
+		}
+		if err := pc.SetRemoteDescription(offer); err != nil {
+			log.Printf("recorder: set offer from client %s error: %v", from.Id, err)
+			return
+		}
+		answer, err := pc.CreateAnswer(nil)
+		if err != nil {
+			log.Printf("recorder: create answer for client %s error: %v", from.Id, err)
+			return
+		}
+		if err = pc.SetLocalDescription(answer); err != nil {
+			log.Printf("recorder: set answer for client %s error: %v", from.Id, err)
+			return
+		}
+		rec.signal(from.Id, WebRTCEventAnswer, answer)
+	case WebRTCEventAnswer:
+		var answer pion.SessionDescription
+		if err := json.Unmarshal(event.Data, &answer); err != nil {
+			return
+		}
+		if pc := rec.findPeer(from.Id); pc != nil {
+			if err := pc.SetRemoteDescription(answer); err != nil {
+				log.Printf("recorder: set answer from client %s error: %v", from.Id, err)
+			}
+		}
+	case WebRTCEventIceCandidate:
+		var candidate pion.ICECandidateInit
+		if err := json.Unmarshal(event.Data, &candidate); err != nil {
+			return
+		}
+		if pc := rec.findPeer(from.Id); pc != nil {
+			if err := pc.AddICECandidate(candidate); err != nil {
+				log.Printf("recorder: add ice candidate from client %s error: %v", from.Id, err)
+			}
+		}
+	}
+}
+
+// offer connects to a participant that joined after the recording started
+func (rec *Recorder) offer(peer *User) {
+	rec.removePeer(peer.Id)
+	pc, err := rec.newPeer(peer)
+	if err != nil {
+		log.Printf("recorder: create peer connection for client %s error: %v", peer.Id, err)
+		return
+	}
+	// 摄像头和屏幕共享各占一组音视频
+	for _, kind := range []pion.RTPCodecType{pion.RTPCodecTypeAudio, pion.RTPCodecTypeAudio, pion.RTPCodecTypeVideo, pion.RTPCodecTypeVideo} {
+		if _, err = pc.AddTransceiverFromKind(kind, pion.RTPTransceiverInit{Direction: pion.RTPTransceiverDirectionRecvonly}); err != nil {
+			log.Printf("recorder: add transceiver for client %s error: %v", peer.Id, err)
+			return
+		}
+	}
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		log.Printf("recorder: create offer for client %s error: %v", peer.Id, err)
+		return
+	}
+	if err = pc.SetLocalDescription(offer); err != nil {
+		log.Printf("recorder: set offer for client %s error: %v", peer.Id, err)
+		return
+	}
+	rec.signal(peer.Id, WebRTCEventOffer, offer)
+}
+
+func (rec *Recorder) findPeer(clientId string) *pion.PeerConnection {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.peers[clientId]
+}
+
+// newPeer creates the receive only PeerConnection of a participant
+func (rec *Recorder) newPeer(peer *User) (*pion.PeerConnection, error) {
+	pc, err := rec.api.NewPeerConnection(pion.Configuration{ICEServers: iceServers()})
+	if err != nil {
+		return nil, err
+	}
+
+	pc.OnICECandidate(func(candidate *pion.ICECandidate) {
+		if candidate != nil {
+			rec.signal(peer.Id, WebRTCEventIceCandidate, candidate.ToJSON())
+		}
+	})
+	pc.OnConnectionStateChange(func(state pion.PeerConnectionState) {
+		if state == pion.PeerConnectionStateFailed {
+			_ = pc.Close()
+		}
+	})
+	pc.OnTrack(func(remote *pion.TrackRemote, _ *pion.RTPReceiver) {
+		t := rec.track(peer, remote.ID(), remote.Codec())
+		if t == nil {
+			return
+		}
+		defer t.close()
+		if t.builder != nil {
+			go rec.requestKeyframe(pc, t, uint32(remote.SSRC()))
+		}
+		for {
+			pkt, _, err := remote.ReadRTP()
+			if err != nil {
+				return
+			}
+			t.writeRTP(pkt)
+		}
+	})
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.peers == nil {
+		_ = pc.Close()
+		return nil, fmt.Errorf("recording stopped")
+	}
+	rec.peers[peer.Id] = pc
+
+	return pc, nil
+}
+
+// removePeer closes the PeerConnection of a participant that left
+func (rec *Recorder) removePeer(clientId string) {
+	rec.mu.Lock()
+	pc, ok := rec.peers[clientId]
+	if ok {
+		delete(rec.peers, clientId)
+	}
+	rec.mu.Unlock()
+	if ok {
+		_ = pc.Close()
+	}
+}
+
+// requestKeyframe sends PLI until the first keyframe of a video track arrives
+func (rec *Recorder) requestKeyframe(pc *pion.PeerConnection, t *recordTrack, ssrc uint32) {
+	ticker := time.NewTicker(recordKeyframeInterval)
+	defer ticker.Stop()
+	for t.waitingKeyframe() {
+		if err := pc.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: ssrc}}); err != nil {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-rec.closed:
+			return
+		}
+	}
+}
+
+// track returns the file of a track published by a participant, creating it on the first packet.
+// It returns nil when the recording stopped or the codec cannot be recorded.
+func (rec *Recorder) track(owner *User, trackId string, codec pion.RTPCodecParameters) *recordTrack {
+	key := owner.Id + "/" + trackId
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.tracks == nil {
+		return nil
+	}
+	if t, ok := rec.tracks[key]; ok && (t == nil || !t.isClosed()) {
+		return t
+	}
+
+	rec.seq++
+	t, err := newRecordTrack(rec.dir, rec.recording.Id, owner, rec.seq, codec)
+	if err != nil {
+		log.Printf("recorder: record track %s of client %s error: %v", trackId, owner.Id, err)
+	}
+	// 不支持的编码也记录下来，避免每个包都重试
+	rec.tracks[key] = t
+
+	return t
+}
+
+// signal sends a webrtc-event from the recorder to a participant
+func (rec *Recorder) signal(clientId string, t WebRTCEventType, data any) {
+	c := rec.room.FindClient(clientId)
+	if c == nil {
+		return
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("recorder: marshal %s for client %s error: %v", t, clientId, err)
+		return
+	}
+	c.Send(NewMessage(MessageTypeWebRTCEvent, rec.self, &WebRTCEvent{Type: t, Data: b}))
+}
+
+// announceRecording tells a client that joined during a recording that the room is recorded
+func (r *Room) announceRecording(c *Client) {
+	recorder := r.FindClient(RecorderClientId)
+	if recorder == nil {
+		return
+	}
+	state := &RecordingStatePayload{Active: true, StartedAt: &recorder.joinTime}
+	if rec := r.recorder.Load(); rec != nil {
+		state = rec.state(true)
+	}
+	c.Send(NewMessage(MessageTypeRecordingState, recorder, state))
+}
+
+// stopRecordingIfAlone stops the recorder once every participant left the room
+func (r *Room) stopRecordingIfAlone() {
+	rec := r.recorder.Load()
+	if rec == nil {
+		return
+	}
+	r.mu.RLock()
+	alone := len(r.clients) == 1
+	r.mu.RUnlock()
+	if alone {
+		go rec.Stop()
+	}
+}
+
+// emit delivers a message of the recorder to every client, unlike Broadcast it
+// does not go through the room loop, so it can be used while the loop is stopping
+func (r *Room) emit(message *Message) {
+	msg, err := message.Bytes()
+	if err != nil {
+		return
+	}
+	r.deliver(msg, message.From.Id)
+	r.publish(newEnvelope(message, msg))
+}
+
+// newRecorderAPI restricts the recorder to the codecs it can write
+func newRecorderAPI() (*pion.API, error) {
+	m := &pion.MediaEngine{}
+	if err := m.RegisterCodec(pion.RTPCodecParameters{
+		RTPCodecCapability: pion.RTPCodecCapability{MimeType: pion.MimeTypeOpus, ClockRate: 48000, Channels: 2, SDPFmtpLine: "minptime=10;useinbandfec=1"},
+		PayloadType:        111,
+	}, pion.RTPCodecTypeAudio); err != nil {
+		return nil, err
+	}
+	videoFeedback := []pion.RTCPFeedback{{Type: "goog-remb"}, {Type: "ccm", Parameter: "fir"}, {Type: "nack"}, {Type: "nack", Parameter: "pli"}}
+	if err := m.RegisterCodec(pion.RTPCodecParameters{
+		RTPCodecCapability: pion.RTPCodecCapability{MimeType: pion.MimeTypeVP8, ClockRate: 90000, RTCPFeedback: videoFeedback},
+		PayloadType:        96,
+	}, pion.RTPCodecTypeVideo); err != nil {
+		return nil, err
+	}
+
+	i := &interceptor.Registry{}
+	if err := pion.RegisterDefaultInterceptors(m, i); err != nil {
+		return nil, err
+	}
+
+	return pion.NewAPI(pion.WithMediaEngine(m), pion.WithInterceptorRegistry(i)), nil
+}
@@ -0,0 +1,237 @@
+package webrtc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"meeting/internal/model/entity"
+	"meeting/pkg/database"
+	"meeting/pkg/webm"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	pion "github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+	"github.com/pion/webrtc/v4/pkg/media/oggwriter"
+	"github.com/pion/webrtc/v4/pkg/media/samplebuilder"
+)
+
+// recordMaxLate is the number of packets the sample builder waits for a missing packet
+const recordMaxLate = 256
+
+var errUnsupportedCodec = errors.New("unsupported codec")
+
+// recordTrack writes one received track to a file of the recording,
+// Opus audio goes to an Ogg file and VP8 video to a WebM file
+type recordTrack struct {
+	file *entity.RecordingFile
+	path string
+
+	mu     sync.Mutex
+	closed bool
+	// packets is the number of packets written, tracks without media are discarded
+	packets int
+
+	ogg *oggwriter.OggWriter
+
+	out     *os.File
+	builder *samplebuilder.SampleBuilder
+	webm    *webm.Writer
+	// lastTimestamp and elapsed convert RTP timestamps to the time since the first keyframe
+	lastTimestamp uint32
+	elapsed       int64
+	clockRate     uint32
+}
+
+// newRecordTrack creates the file of a track published by a participant
+func newRecordTrack(dir string, recordingId uint, owner *User, seq int, codec pion.RTPCodecParameters) (*recordTrack, error) {
+	f := &entity.RecordingFile{
+		RecordingId:     recordingId,
+		ParticipantUuid: owner.Id,
+		ParticipantName: owner.Name,
+		Codec:           codec.MimeType,
+		StartedAt:       time.Now(),
+	}
+	t := &recordTrack{file: f, clockRate: codec.ClockRate}
+	switch strings.ToLower(codec.MimeType) {
+	case strings.ToLower(pion.MimeTypeOpus):
+		f.Kind = entity.RecordingKindAudio
+		f.Name = fmt.Sprintf("%s-%s-%d.ogg", owner.Id, f.Kind, seq)
+		t.path = filepath.Join(dir, f.Name)
+		ogg, err := oggwriter.New(t.path, codec.ClockRate, max(codec.Channels, 1))
+		if err != nil {
+			return nil, err
+		}
+		t.ogg = ogg
+	case strings.ToLower(pion.MimeTypeVP8):
+		f.Kind = entity.RecordingKindVideo
+		f.Name = fmt.Sprintf("%s-%s-%d.webm", owner.Id, f.Kind, seq)
+		t.path = filepath.Join(dir, f.Name)
+		out, err := os.Create(t.path)
+		if err != nil {
+			return nil, err
+		}
+		t.out = out
+		t.builder = samplebuilder.New(recordMaxLate, &codecs.VP8Packet{}, codec.ClockRate)
+	default:
+		return nil, fmt.Errorf("%w %s", errUnsupportedCodec, codec.MimeType)
+	}
+
+	if err := database.DB(context.Background()).Create(f).Error; err != nil {
+		t.discard()
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// writeRTP appends a packet of the track to its file
+func (t *recordTrack) writeRTP(pkt *rtp.Packet) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	if t.ogg != nil {
+		if len(pkt.Payload) == 0 {
+			return
+		}
+		if err := t.ogg.WriteRTP(pkt); err != nil {
+			log.Printf("recorder: write %s error: %v", t.file.Name, err)
+			return
+		}
+		t.packets++
+		return
+	}
+
+	t.builder.Push(pkt)
+	for s := t.builder.Pop(); s != nil; s = t.builder.Pop() {
+		t.writeSample(s)
+	}
+}
+
+// writeSample writes a VP8 frame, frames before the first keyframe are dropped
+func (t *recordTrack) writeSample(s *media.Sample) {
+	if len(s.Data) == 0 {
+		return
+	}
+	// VP8 帧头第一个字节的最低位为 0 表示关键帧
+	keyframe := s.Data[0]&0x01 == 0
+	if t.webm == nil {
+		width, height, ok := vp8KeyframeSize(s.Data)
+		if !ok {
+			return
+		}
+		w, err := webm.NewWriter(t.out, webm.CodecVP8, width, height)
+		if err != nil {
+			log.Printf("recorder: write %s header error: %v", t.file.Name, err)
+			return
+		}
+		t.webm = w
+		t.lastTimestamp = s.PacketTimestamp
+		t.file.StartedAt = time.Now()
+	}
+
+	if err := t.webm.WriteFrame(keyframe, t.advance(s.PacketTimestamp), s.Data); err != nil {
+		log.Printf("recorder: write %s error: %v", t.file.Name, err)
+		return
+	}
+	t.packets++
+}
+
+// advance returns the time since the first keyframe at an RTP timestamp,
+// the timestamp may wrap around and late packets do not move the clock backwards
+func (t *recordTrack) advance(timestamp uint32) time.Duration {
+	// 时间戳可能回绕，按差值累加
+	if delta := int32(timestamp - t.lastTimestamp); delta > 0 {
+		t.elapsed += int64(delta)
+		t.lastTimestamp = timestamp
+	}
+	return time.Duration(t.elapsed) * time.Second / time.Duration(t.clockRate)
+}
+
+// vp8KeyframeSize returns the dimensions in the header of a VP8 keyframe, false for other frames
+func vp8KeyframeSize(frame []byte) (width, height int, ok bool) {
+	// 3 字节帧标记之后为起始码 9d 01 2a，然后是各 14 位的宽度和高度，高 2 位为缩放比例
+	if len(frame) < 10 || frame[0]&0x01 != 0 || frame[3] != 0x9d || frame[4] != 0x01 || frame[5] != 0x2a {
+		return 0, 0, false
+	}
+	width = int(frame[6]) | int(frame[7]&0x3f)<<8
+	height = int(frame[8]) | int(frame[9]&0x3f)<<8
+	return width, height, true
+}
+
+// waitingKeyframe reports whether a video track has not received its first keyframe yet
+func (t *recordTrack) waitingKeyframe() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return !t.closed && t.builder != nil && t.webm == nil
+}
+
+func (t *recordTrack) isClosed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.closed
+}
+
+// close finishes the file and records its size, it returns the size of the kept file
+func (t *recordTrack) close() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return t.file.Size
+	}
+	t.closed = true
+
+	if t.packets == 0 {
+		t.discard()
+		if err := database.DB(context.Background()).Delete(t.file).Error; err != nil {
+			log.Printf("recorder: delete empty file %s error: %v", t.file.Name, err)
+		}
+		return 0
+	}
+
+	var err error
+	if t.ogg != nil {
+		err = t.ogg.Close()
+	} else {
+		err = t.out.Close()
+	}
+	if err != nil {
+		log.Printf("recorder: close %s error: %v", t.file.Name, err)
+	}
+	if info, err := os.Stat(t.path); err == nil {
+		t.file.Size = info.Size()
+	}
+	now := time.Now()
+	t.file.EndedAt = &now
+	if err = database.DB(context.Background()).Model(t.file).Updates(map[string]any{
+		"size":       t.file.Size,
+		"started_at": t.file.StartedAt,
+		"ended_at":   t.file.EndedAt,
+	}).Error; err != nil {
+		log.Printf("recorder: update file %s error: %v", t.file.Name, err)
+	}
+
+	return t.file.Size
+}
+
+// discard removes a file that has no media
+func (t *recordTrack) discard() {
+	if t.out != nil {
+		_ = t.out.Close()
+	}
+	if t.ogg != nil {
+		// 没有写入音频包时不能补写结束页，直接丢弃文件
+		_ = t.ogg.Close()
+	}
+	if err := os.Remove(t.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("recorder: remove %s error: %v", t.path, err)
+	}
+}
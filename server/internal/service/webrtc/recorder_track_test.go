@@ -0,0 +1,100 @@
+package webrtc
+
+import (
+	"bytes"
+	"meeting/internal/model/entity"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+// vp8Keyframe returns the start of a VP8 keyframe of the given size
+func vp8Keyframe(width, height int) []byte {
+	return []byte{
+		0x10, 0x02, 0x00, // 帧标记，最低位为 0 表示关键帧
+		0x9d, 0x01, 0x2a,
+		byte(width), byte(width>>8) | 0x40, // 高 2 位为缩放比例，不计入宽度
+		byte(height), byte(height >> 8),
+		0xAA,
+	}
+}
+
+func TestVP8KeyframeSize(t *testing.T) {
+	width, height, ok := vp8KeyframeSize(vp8Keyframe(1920, 1080))
+	if !ok || width != 1920 || height != 1080 {
+		t.Fatalf("size = %dx%d %v, want 1920x1080", width, height, ok)
+	}
+
+	inter := vp8Keyframe(1920, 1080)
+	inter[0] |= 0x01
+	if _, _, ok := vp8KeyframeSize(inter); ok {
+		t.Fatal("interframe accepted as keyframe")
+	}
+	if _, _, ok := vp8KeyframeSize(vp8Keyframe(640, 480)[:9]); ok {
+		t.Fatal("truncated keyframe accepted")
+	}
+	corrupt := vp8Keyframe(640, 480)
+	corrupt[3] = 0
+	if _, _, ok := vp8KeyframeSize(corrupt); ok {
+		t.Fatal("keyframe without start code accepted")
+	}
+}
+
+func TestRecordTrackAdvanceWrapsAround(t *testing.T) {
+	tr := &recordTrack{clockRate: 90000, lastTimestamp: 0xFFFFFFFF - 1999}
+	steps := []struct {
+		timestamp uint32
+		want      time.Duration
+	}{
+		{0xFFFFFFFF - 1999, 0},
+		// 回绕后差值仍为 3000，即 1/30 秒
+		{1000, time.Second / 30},
+		{4000, 2 * time.Second / 30},
+		// 迟到的包不让时间倒退，也不影响后续的差值
+		{2000, 2 * time.Second / 30},
+		{7000, 3 * time.Second / 30},
+	}
+	for i, s := range steps {
+		if got := tr.advance(s.timestamp); got != s.want {
+			t.Fatalf("step %d: advance(%d) = %s, want %s", i, s.timestamp, got, s.want)
+		}
+	}
+}
+
+func TestRecordTrackWriteSample(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "video.webm")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	tr := &recordTrack{file: &entity.RecordingFile{Name: "video.webm"}, path: path, out: out, clockRate: 90000}
+
+	// 第一个关键帧之前的帧被丢弃
+	tr.writeSample(&media.Sample{Data: []byte{0x11, 0x00, 0x00, 0x01}, PacketTimestamp: 100})
+	if tr.webm != nil || tr.packets != 0 {
+		t.Fatal("interframe before the first keyframe was written")
+	}
+
+	start := uint32(0xFFFFFFFF - 1000)
+	tr.writeSample(&media.Sample{Data: vp8Keyframe(640, 360), PacketTimestamp: start})
+	tr.writeSample(&media.Sample{Data: []byte{0x11, 0x00, 0x00, 0x02}, PacketTimestamp: start + 3000})
+	if tr.packets != 2 {
+		t.Fatalf("wrote %d frames, want 2", tr.packets)
+	}
+	if got := tr.advance(start + 3000); got != time.Second/30 {
+		t.Fatalf("elapsed = %s after the timestamp wrapped, want %s", got, time.Second/30)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// PixelWidth 640 和 PixelHeight 360 各用 2 字节编码
+	if !bytes.Contains(data, []byte{0xB0, 0x82, 0x02, 0x80}) || !bytes.Contains(data, []byte{0xBA, 0x82, 0x01, 0x68}) {
+		t.Fatal("webm header does not hold the size of the keyframe")
+	}
+}
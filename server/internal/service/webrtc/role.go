@@ -0,0 +1,55 @@
+package webrtc
+
+import (
+	"encoding/json"
+	"log"
+	"meeting/internal/model/entity"
+)
+
+// SetRole changes the role of a connected client, see Server.SetRole
+func (r *Room) SetRole(clientId string, role entity.Role) {
+	select {
+	case r.roleChanges <- &RolePayload{ClientId: clientId, Role: role}:
+	case <-r.done:
+	}
+}
+
+// SetRole propagates a role change to the node holding the client, the room
+// does not need to be running on this node
+func (s *Server) SetRole(roomId, clientId string, role entity.Role) {
+	if r := s.FindRoom(roomId); r != nil {
+		r.SetRole(clientId, role)
+		return
+	}
+
+	b, _ := json.Marshal(&RolePayload{ClientId: clientId, Role: role})
+	s.publish(roomId, &Envelope{Kind: EnvelopeRole, To: clientId, Data: b})
+}
+
+// changeRole applies a role change made on this node and forwards it to the other nodes
+func (r *Room) changeRole(p *RolePayload) {
+	r.applyRole(p)
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		log.Println("marshal role change error:", err)
+		return
+	}
+	r.publish(&Envelope{Kind: EnvelopeRole, To: p.ClientId, Data: b})
+}
+
+// applyRole updates the client and tells the local clients about its new role, it must be called from the room loop
+func (r *Room) applyRole(p *RolePayload) {
+	client := r.FindClient(p.ClientId)
+	if client == nil {
+		return
+	}
+	client.setRole(p.Role)
+	p.Capabilities = p.Role.Capabilities()
+
+	msg, err := NewMessage(MessageTypeRoleChanged, client, p).Bytes()
+	if err != nil {
+		return
+	}
+	r.deliver(msg, "")
+}
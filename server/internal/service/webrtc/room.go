@@ -1,8 +1,11 @@
 package webrtc
 
 import (
+	"log"
+	"meeting/pkg/broker"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -10,6 +13,8 @@ import (
 type Room struct {
 	// Room Id
 	Id        string
+	Name      string
+	Mode      string
 	StartTime time.Time
 	MaxOnline int
 
@@ -31,7 +36,60 @@ type Room struct {
 	// unregister requests from clients.
 	unregister chan *Client
 
+	// Envelopes received from other nodes through the broker.
+	inbound chan *Envelope
+
+	// subscription of the room topic on the broker
+	subscription broker.Subscription
+
+	// envelopes waiting to be published to the broker, see publish
+	outbound chan *Envelope
+	// published is closed once the envelopes left by the room loop have been published
+	published chan struct{}
+
+	// last time an envelope was received from each remote node, only used by the room loop
+	nodes map[string]time.Time
+
+	// lobby makes non-host clients wait for admission
+	lobby atomic.Bool
+	// clients waiting in the lobby of this node
+	waiting map[string]*Client
+	// ids of the clients admitted by a host, they skip the lobby when reconnecting
+	admitted map[string]bool
+	// lobby decisions made by the hosts of this node
+	admission chan *LobbyDecisionPayload
+
+	// role changes made by the moderators of this node
+	roleChanges chan *RolePayload
+
+	// session resumption of local clients whose connection dropped
+	detach  chan *detachRequest
+	resume  chan *resumeRequest
+	expired chan *Client
+
+	// sfu forwards media when the room runs in entity.RoomModeSFU
+	sfu *SFU
+
+	// primary key of entity.Room, see WithEntityId
+	roomId uint
+
+	// meetingId is the persisted session recording the attendance, guarded by meetingMu
+	meetingMu sync.Mutex
+	meetingId uint
+
+	// attendance updates waiting for the database, see persist
+	persistMu  sync.Mutex
+	persisting bool
+	pending    []func()
+	persisted  sync.WaitGroup
+
+	// recorder is the active recording of this node
+	recorder atomic.Pointer[Recorder]
+
 	close chan struct{}
+
+	// done is closed when the room loop exits
+	done chan struct{}
 }
 
 func (r *Room) FindClient(clientId string) *Client {
@@ -40,6 +98,27 @@ func (r *Room) FindClient(clientId string) *Client {
 	return r.clients[clientId]
 }
 
+// Info returns a snapshot of the room for monitoring
+func (r *Room) Info() *RoomInfo {
+	clients := r.AllClients()
+	infos := make([]*ClientInfo, len(clients))
+	for i, c := range clients {
+		infos[i] = c.Info()
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return &RoomInfo{
+		Id:          r.Id,
+		Name:        r.Name,
+		ClientCount: len(clients),
+		StartTime:   r.StartTime,
+		MaxOnline:   r.MaxOnline,
+		LastActive:  r.lastAlive,
+		Clients:     infos,
+	}
+}
+
 func (r *Room) AllClients() []*Client {
 	var clients = make([]*Client, 0)
 	r.mu.RLock()
@@ -58,43 +137,59 @@ func (r *Room) AllClients() []*Client {
 func (r *Room) KickAllUser() {
 	for _, client := range r.AllClients() {
 		client.handleKick()
-		r.UnregisterClient(client)
+		// 其他节点上的客户端由所在节点在断开连接时注销
+		if client.isLocal() {
+			r.UnregisterClient(client)
+		}
 	}
 }
 
 func (r *Room) Broadcast(message *Message) {
-	r.broadcast <- message
+	select {
+	case r.broadcast <- message:
+	case <-r.done:
+	}
 }
 
 // Run starts the room's main loop
 func (r *Room) Run() {
-	ticker := time.NewTicker(10 * time.Second)
+	ticker := time.NewTicker(heartbeatInterval)
 	defer func() {
 		ticker.Stop()
+		if rec := r.recorder.Load(); rec != nil {
+			rec.Stop()
+		}
+		if r.sfu != nil {
+			r.sfu.Close()
+		}
+		if r.subscription != nil {
+			if err := r.subscription.Unsubscribe(); err != nil {
+				log.Printf("unsubscribe room %s error: %v", r.Id, err)
+			}
+		}
+		close(r.done)
 	}()
 	for {
 		select {
 		case client := <-r.register:
 			client.room = r
-			client.joinTime = time.Now()
-			r.mu.Lock()
-			if c, ok := r.clients[client.Id]; ok {
-				c.handleLeave()
-				c.handleKick()
-				c.room = nil
-			}
-			r.clients[client.Id] = client
-			clientsCount := len(r.clients)
-			if clientsCount > r.MaxOnline {
-				r.MaxOnline = clientsCount
+			if r.mustWait(client) {
+				r.wait(client)
+				continue
 			}
-			client.handleJoin()
-			r.mu.Unlock()
+			r.join(client)
+		case d := <-r.admission:
+			r.admit(d)
+		case p := <-r.roleChanges:
+			r.changeRole(p)
 		case client := <-r.unregister:
-			r.mu.Lock()
-			client.handleLeave()
-			delete(r.clients, client.Id)
-			r.mu.Unlock()
+			r.remove(client)
+		case req := <-r.detach:
+			r.detachClient(req)
+		case req := <-r.resume:
+			req.ok <- r.resumeClient(req)
+		case client := <-r.expired:
+			r.expire(client)
 		case message := <-r.broadcast:
 			if message.From == nil {
 				continue
@@ -104,43 +199,122 @@ func (r *Room) Run() {
 			if err != nil {
 				continue
 			}
-			r.mu.RLock()
-			for _, c := range r.clients {
-				// Don't send message back to sender
-				if c.Id != message.From.Id {
-					c.send <- msg
-				}
-			}
-			r.mu.RUnlock()
+			// Don't send message back to sender
+			r.deliver(msg, message.From.Id)
+			r.publish(newEnvelope(message, msg))
+		case env := <-r.inbound:
+			r.handleEnvelope(env)
 		case <-ticker.C:
-			r.mu.RLock()
-			if len(r.clients) > 0 {
+			if !r.lobby.Load() {
+				r.admitAll()
+			}
+			r.mu.Lock()
+			if len(r.clients) > 0 || len(r.waiting) > 0 {
 				r.lastAlive = time.Now()
 			}
-			r.mu.RUnlock()
+			r.mu.Unlock()
+			if r.hasLocalClients() {
+				r.publish(&Envelope{Kind: EnvelopeHeartbeat})
+			}
+			r.expireNodes(time.Now())
 			if r.lastAlive.Add(time.Minute * 30).Before(time.Now()) {
 				r.server.RemoveRoom(r.Id)
 				return
 			}
 		case <-r.close:
-			// todo 是否需要关闭通道
-			close(r.register)
-			close(r.unregister)
-			close(r.broadcast)
-			close(r.close)
+			for _, c := range r.waiting {
+				c.close()
+			}
 			return
 		}
 	}
 }
 
+// hasLocalClients reports whether a client of this node is in the room
+func (r *Room) hasLocalClients() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, c := range r.clients {
+		if c.isLocal() {
+			return true
+		}
+	}
+	return false
+}
+
+// join adds a client to the room, it must be called from the room loop
+func (r *Room) join(client *Client) {
+	client.joinTime = time.Now()
+	r.mu.Lock()
+	if c, ok := r.clients[client.Id]; ok && c.isLocal() {
+		c.handleLeave()
+		c.handleKick()
+		c.room = nil
+		r.server.removeSession(c)
+	}
+	r.clients[client.Id] = client
+	r.updateMaxOnline()
+	client.handleJoin()
+	r.mu.Unlock()
+	r.server.newSession(client, false)
+	r.persist(func() { r.recordJoin(client) })
+	r.notifyClient(RoomEventClientJoined, client)
+	// 回放不阻塞房间循环，客户端按消息 id 去重并按时间排序
+	go client.replayChat()
+	r.announceWaiting(client)
+	r.announceRecording(client)
+}
+
+// remove takes a client out of the room and tells the other clients, it must be called from the room loop
+func (r *Room) remove(client *Client) {
+	if client.recorder != nil {
+		go client.recorder.Stop()
+		return
+	}
+	r.leaveLobby(client)
+	r.mu.Lock()
+	c, ok := r.clients[client.Id]
+	left := ok && c == client
+	if left {
+		client.handleLeave()
+		delete(r.clients, client.Id)
+		if r.sfu != nil {
+			r.sfu.RemovePeer(client.Id)
+		}
+	}
+	r.mu.Unlock()
+	r.server.removeSession(client)
+	if left {
+		r.persist(func() { r.recordLeave(client) })
+		r.notifyClient(RoomEventClientLeft, client)
+		r.stopRecordingIfAlone()
+	}
+}
+
+// updateMaxOnline records the peak occupancy, the caller must hold r.mu
+func (r *Room) updateMaxOnline() {
+	if clientsCount := len(r.clients); clientsCount > r.MaxOnline {
+		r.MaxOnline = clientsCount
+	}
+}
+
 func (r *Room) RegisterClient(client *Client) {
-	r.register <- client
+	select {
+	case r.register <- client:
+	case <-r.done:
+	}
 }
 
 func (r *Room) UnregisterClient(client *Client) {
-	r.unregister <- client
+	select {
+	case r.unregister <- client:
+	case <-r.done:
+	}
 }
 
 func (r *Room) Close() {
-	r.close <- struct{}{}
+	select {
+	case r.close <- struct{}{}:
+	case <-r.done:
+	}
 }
@@ -1,49 +1,137 @@
 package webrtc
 
 import (
+	"log"
+	"meeting/internal/model/entity"
+	"meeting/pkg/broker"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var WsServer = &Server{
-	rooms: make(map[string]*Room),
+	rooms:    make(map[string]*Room),
+	sessions: make(map[string]*Client),
 }
 
 type RoomInfo struct {
-	Id          string    `json:"id"`
-	Name        string    `json:"name"`
-	ClientCount int       `json:"clientCount"`
-	StartTime   time.Time `json:"startTime"`
-	MaxOnline   int       `json:"maxOnline"`
-	LastActive  time.Time `json:"lastActive"`
-	Clients     []*Client `json:"clients"`
+	Id          string        `json:"id"`
+	Name        string        `json:"name"`
+	ClientCount int           `json:"clientCount"`
+	StartTime   time.Time     `json:"startTime"`
+	MaxOnline   int           `json:"maxOnline"`
+	LastActive  time.Time     `json:"lastActive"`
+	Clients     []*ClientInfo `json:"clients"`
 }
 
 type Server struct {
-	rooms map[string]*Room
-	mu    sync.RWMutex
+	rooms  map[string]*Room
+	mu     sync.RWMutex
+	Broker broker.Broker
+
+	// draining is set once Shutdown has been called
+	draining atomic.Bool
+
+	// monitor delivers room events to the monitoring stream
+	monitor monitor
+
+	// sessions maps resume tokens to the clients of this node
+	sessions  map[string]*Client
+	sessionMu sync.Mutex
+}
+
+func (s *Server) broker() broker.Broker {
+	if s.Broker == nil {
+		return broker.Default()
+	}
+	return s.Broker
+}
+
+// RoomOption configures a room when it is started
+type RoomOption func(r *Room)
+
+// WithMode selects how media is exchanged in the room, see entity.RoomModeMesh and entity.RoomModeSFU
+func WithMode(mode string) RoomOption {
+	return func(r *Room) {
+		r.Mode = mode
+	}
+}
+
+// WithName sets the display name of the room reported by GetRooms
+func WithName(name string) RoomOption {
+	return func(r *Room) {
+		r.Name = name
+	}
+}
+
+// WithEntityId sets the primary key of the persisted room, used by chat history, attendance and webhooks
+func WithEntityId(id uint) RoomOption {
+	return func(r *Room) {
+		r.roomId = id
+	}
 }
 
 // StartRoom find or create a new room
-func (s *Server) StartRoom(id string) *Room {
+func (s *Server) StartRoom(id string, options ...RoomOption) *Room {
+	if r := s.FindRoom(id); r != nil {
+		return r
+	}
+
+	r := &Room{
+		Id:          id,
+		server:      s,
+		broadcast:   make(chan *Message, 100), // Buffered channel
+		register:    make(chan *Client),
+		unregister:  make(chan *Client),
+		inbound:     make(chan *Envelope, 100),
+		outbound:    make(chan *Envelope, outboundSize),
+		published:   make(chan struct{}),
+		clients:     make(map[string]*Client),
+		nodes:       make(map[string]time.Time),
+		waiting:     make(map[string]*Client),
+		admitted:    make(map[string]bool),
+		admission:   make(chan *LobbyDecisionPayload),
+		roleChanges: make(chan *RolePayload),
+		detach:      make(chan *detachRequest),
+		resume:      make(chan *resumeRequest),
+		expired:     make(chan *Client),
+		close:       make(chan struct{}),
+		done:        make(chan struct{}),
+		StartTime:   time.Now(),
+		lastAlive:   time.Now(),
+		Mode:        entity.RoomModeMesh,
+	}
+	for _, option := range options {
+		option(r)
+	}
+	// broker 不可用时订阅会等待到超时，不能持有 s.mu
+	subscription, err := s.broker().Subscribe(roomTopic(id), r.receive)
+	if err != nil {
+		log.Printf("subscribe room %s error: %v", id, err)
+	}
+
 	s.mu.Lock()
-	defer s.mu.Unlock()
-	r, exists := s.rooms[id]
-	if !exists {
-		r = &Room{
-			Id:         id,
-			server:     s,
-			broadcast:  make(chan *Message, 100), // Buffered channel
-			register:   make(chan *Client),
-			unregister: make(chan *Client),
-			clients:    make(map[string]*Client),
-			close:      make(chan struct{}),
-			StartTime:  time.Now(),
-			lastAlive:  time.Now(),
+	if existing, ok := s.rooms[id]; ok {
+		// 订阅期间其他请求已经创建了房间
+		s.mu.Unlock()
+		if subscription != nil {
+			_ = subscription.Unsubscribe()
 		}
-		s.rooms[r.Id] = r
-		go r.Run()
+		close(r.done)
+		return existing
+	}
+	r.subscription = subscription
+	if r.Mode == entity.RoomModeSFU {
+		r.sfu = newSFU(r)
 	}
+	s.rooms[r.Id] = r
+	s.mu.Unlock()
+
+	go r.Run()
+	go r.runPublish()
+	s.notify(&RoomEvent{Type: RoomEventStarted, RoomId: r.Id, Room: r.Info()})
+	// 让其他节点通告已在房间中的客户端
+	r.publish(&Envelope{Kind: EnvelopeSync})
 
 	return r
 }
@@ -56,8 +144,13 @@ func (s *Server) FindRoom(id string) *Room {
 
 func (s *Server) RemoveRoom(id string) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	r, exists := s.rooms[id]
 	delete(s.rooms, id)
+	s.mu.Unlock()
+	if exists {
+		s.notify(&RoomEvent{Type: RoomEventClosed, RoomId: id})
+		r.persist(r.endMeetingSession)
+	}
 }
 
 func (s *Server) CloseRoom(id string) {
@@ -73,9 +166,7 @@ func (s *Server) GetRooms() []*RoomInfo {
 	defer s.mu.RUnlock()
 	var rooms = make([]*RoomInfo, 0)
 	for _, v := range s.rooms {
-		rooms = append(rooms, &RoomInfo{
-			Id: v.Id,
-		})
+		rooms = append(rooms, v.Info())
 	}
 
 	return rooms
@@ -0,0 +1,206 @@
+package webrtc
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"log"
+	"meeting/pkg/config"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxPendingMessages bounds the messages buffered for a disconnected client
+const maxPendingMessages = 256
+
+// SessionPayload is the data of a session message
+type SessionPayload struct {
+	// ResumeToken is passed as the resume query parameter when reconnecting
+	ResumeToken string `json:"resumeToken"`
+	// ResumeTimeout is how long in milliseconds the session is kept after the connection drops
+	ResumeTimeout int64 `json:"resumeTimeout"`
+	// Resumed is set when the connection resumed an existing session
+	Resumed bool `json:"resumed"`
+}
+
+type detachRequest struct {
+	client *Client
+	conn   *websocket.Conn
+}
+
+type resumeRequest struct {
+	client *Client
+	conn   *websocket.Conn
+	ok     chan bool
+}
+
+func resumeGrace() time.Duration {
+	return time.Duration(config.GetConfig().App.ResumeSeconds) * time.Second
+}
+
+// FindSession returns the client holding a resume token
+func (s *Server) FindSession(token string) *Client {
+	s.sessionMu.Lock()
+	defer s.sessionMu.Unlock()
+	return s.sessions[token]
+}
+
+// newSession issues a new resume token to the client and sends it
+func (s *Server) newSession(c *Client, resumed bool) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		log.Printf("generate resume token for client %s error: %v", c.Id, err)
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	s.sessionMu.Lock()
+	if c.resumeToken != "" {
+		delete(s.sessions, c.resumeToken)
+	}
+	c.resumeToken = token
+	s.sessions[token] = c
+	s.sessionMu.Unlock()
+
+	c.Send(NewMessage(MessageTypeSession, nil, &SessionPayload{
+		ResumeToken:   token,
+		ResumeTimeout: resumeGrace().Milliseconds(),
+		Resumed:       resumed,
+	}))
+}
+
+func (s *Server) removeSession(c *Client) {
+	s.sessionMu.Lock()
+	defer s.sessionMu.Unlock()
+	if c.resumeToken != "" && s.sessions[c.resumeToken] == c {
+		delete(s.sessions, c.resumeToken)
+	}
+}
+
+// DetachClient is called when the connection of a client drops, the client
+// keeps its place in the room until it resumes or the grace period elapses
+func (r *Room) DetachClient(c *Client, conn *websocket.Conn) {
+	select {
+	case r.detach <- &detachRequest{client: c, conn: conn}:
+	case <-r.done:
+	}
+}
+
+// Resume attaches a new connection to a detached client, it reports whether the session was still alive
+func (r *Room) Resume(c *Client, conn *websocket.Conn) bool {
+	req := &resumeRequest{client: c, conn: conn, ok: make(chan bool, 1)}
+	select {
+	case r.resume <- req:
+		return <-req.ok
+	case <-r.done:
+		return false
+	}
+}
+
+// detachClient keeps a disconnected client in the room without telling the other clients, it must be called from the room loop
+func (r *Room) detachClient(req *detachRequest) {
+	c := req.client
+	if r.FindClient(c.Id) != c || r.server.Draining() || c.resumeToken == "" {
+		r.remove(c)
+		return
+	}
+	if !c.detach(req.conn) {
+		return
+	}
+
+	grace := resumeGrace()
+	time.AfterFunc(grace, func() {
+		select {
+		case r.expired <- c:
+		case <-r.done:
+		}
+	})
+}
+
+// expire removes a client whose session was not resumed in time, it must be called from the room loop
+func (r *Room) expire(c *Client) {
+	if at := c.detachedSince(); !at.IsZero() && time.Since(at) >= resumeGrace() {
+		r.remove(c)
+	}
+}
+
+// resumeClient replays the buffered messages on the new connection, it must be called from the room loop
+func (r *Room) resumeClient(req *resumeRequest) bool {
+	c := req.client
+	if r.FindClient(c.Id) != c {
+		return false
+	}
+	// 旧连接可能尚未检测到断开，由新连接接管
+	if old, _ := c.connection(); c.detach(old) && old != nil {
+		old.Close()
+	}
+	c.attach(req.conn)
+	r.server.newSession(c, true)
+	r.persist(func() { r.recordReconnect(c) })
+
+	return true
+}
+
+// connection returns the current websocket connection and its send queue
+func (c *Client) connection() (*websocket.Conn, chan []byte) {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+	return c.conn, c.send
+}
+
+// detach starts buffering the messages of the client, conn is the connection that dropped
+func (c *Client) detach(conn *websocket.Conn) bool {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+	// 客户端已经通过新的连接恢复
+	if c.conn != conn || !c.detachedAt.IsZero() {
+		return false
+	}
+	c.detachedAt = time.Now()
+	// 发送队列中尚未写出的消息
+	for n := len(c.send); n > 0; n-- {
+		c.pending = append(c.pending, <-c.send)
+	}
+
+	return true
+}
+
+// attach switches the client to a new connection and queues the buffered messages on it
+func (c *Client) attach(conn *websocket.Conn) {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+	c.conn = conn
+	c.send = make(chan []byte, max(len(c.pending), 256))
+	for _, msg := range c.pending {
+		c.send <- msg
+	}
+	c.pending = nil
+	c.detachedAt = time.Time{}
+}
+
+func (c *Client) detachedSince() time.Time {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+	return c.detachedAt
+}
+
+// write queues an encoded message for the client, messages are buffered while it is detached
+func (c *Client) write(msg []byte) {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+	if !c.detachedAt.IsZero() {
+		if len(c.pending) >= maxPendingMessages {
+			c.pending = c.pending[1:]
+			messagesDropped.WithLabelValues(dropOverflow).Inc()
+		}
+		c.pending = append(c.pending, msg)
+		return
+	}
+
+	select {
+	case c.send <- msg:
+	default:
+		messagesDropped.WithLabelValues(dropQueueFull).Inc()
+		log.Printf("send queue of client %s is full, message dropped", c.Id)
+	}
+}
@@ -0,0 +1,436 @@
+package webrtc
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"meeting/internal/model/entity"
+	"meeting/pkg/config"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/rtcp"
+	pion "github.com/pion/webrtc/v4"
+)
+
+// SFUClientId is the pseudo client id used by the server side forwarding unit
+const SFUClientId = "sfu"
+
+// keyframeInterval controls how often publishers are asked for a new keyframe
+const keyframeInterval = 3 * time.Second
+
+// SFU terminates one PeerConnection per client and forwards every published
+// track to the other clients of the room.
+type SFU struct {
+	room *Room
+	// self is the sender of the signaling messages produced by the SFU
+	self *Client
+
+	mu    sync.Mutex
+	peers map[string]*sfuPeer
+	// tracks are keyed by trackKey, different clients may publish tracks with the same id
+	tracks map[string]*sfuTrack
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+type sfuPeer struct {
+	client *Client
+	pc     *pion.PeerConnection
+	// dirty is set when senders changed and the client needs a new offer
+	dirty atomic.Bool
+	// negotiation serializes offers and answers exchanged with the client
+	negotiation sync.Mutex
+}
+
+type sfuTrack struct {
+	owner string
+	local *pion.TrackLocalStaticRTP
+}
+
+// trackKey identifies a forwarded track by its publisher and its id
+func trackKey(owner, trackId string) string {
+	return owner + "/" + trackId
+}
+
+func newSFU(r *Room) *SFU {
+	s := &SFU{
+		room:   r,
+		self:   &Client{User: &User{Id: SFUClientId, Name: "SFU"}},
+		peers:  make(map[string]*sfuPeer),
+		tracks: make(map[string]*sfuTrack),
+		closed: make(chan struct{}),
+	}
+	go s.keyframeLoop()
+
+	return s
+}
+
+// HandleEvent processes a webrtc-event sent by a client to the SFU
+func (s *SFU) HandleEvent(c *Client, event *WebRTCEvent) {
+	switch event.Type {
+	case WebRTCEventOffer:
+		var offer pion.SessionDescription
+		if err := json.Unmarshal(event.Data, &offer); err != nil {
+			log.Printf("sfu: invalid offer from client %s: %v", c.Id, err)
+			return
+		}
+		p, err := s.peer(c)
+		if err != nil {
+			log.Printf("sfu: create peer connection for client %s error: %v", c.Id, err)
+			return
+		}
+		p.negotiation.Lock()
+		defer p.negotiation.Unlock()
+		// 双方同时发起协商时 SFU 保留自己的 offer，客户端回滚后会应答并重新发起协商
+		if p.pc.SignalingState() == pion.SignalingStateHaveLocalOffer {
+			log.Printf("sfu: ignore offer from client %s during negotiation", c.Id)
+			return
+		}
+		if err = p.pc.SetRemoteDescription(offer); err != nil {
+			log.Printf("sfu: set offer from client %s error: %v", c.Id, err)
+			return
+		}
+		// 将已有的轨道挂到客户端提供的 transceiver 上，减少重新协商
+		s.mu.Lock()
+		s.attachTracks(p)
+		s.mu.Unlock()
+		answer, err := p.pc.CreateAnswer(nil)
+		if err != nil {
+			log.Printf("sfu: create answer for client %s error: %v", c.Id, err)
+			return
+		}
+		if err = p.pc.SetLocalDescription(answer); err != nil {
+			log.Printf("sfu: set answer for client %s error: %v", c.Id, err)
+			return
+		}
+		s.signal(c, WebRTCEventAnswer, answer)
+		go s.signalPeers()
+	case WebRTCEventAnswer:
+		var answer pion.SessionDescription
+		if err := json.Unmarshal(event.Data, &answer); err != nil {
+			log.Printf("sfu: invalid answer from client %s: %v", c.Id, err)
+			return
+		}
+		if p := s.findPeer(c.Id); p != nil {
+			p.negotiation.Lock()
+			err := p.pc.SetRemoteDescription(answer)
+			p.negotiation.Unlock()
+			if err != nil {
+				log.Printf("sfu: set answer from client %s error: %v", c.Id, err)
+			}
+		}
+	case WebRTCEventIceCandidate:
+		var candidate pion.ICECandidateInit
+		if err := json.Unmarshal(event.Data, &candidate); err != nil {
+			log.Printf("sfu: invalid ice candidate from client %s: %v", c.Id, err)
+			return
+		}
+		if p := s.findPeer(c.Id); p != nil {
+			if err := p.pc.AddICECandidate(candidate); err != nil {
+				log.Printf("sfu: add ice candidate from client %s error: %v", c.Id, err)
+			}
+		}
+	}
+}
+
+// RemovePeer closes the PeerConnection of a client and stops forwarding its tracks
+func (s *SFU) RemovePeer(clientId string) {
+	s.mu.Lock()
+	p, ok := s.peers[clientId]
+	if ok {
+		delete(s.peers, clientId)
+	}
+	for id, t := range s.tracks {
+		if t.owner == clientId {
+			delete(s.tracks, id)
+		}
+	}
+	s.mu.Unlock()
+
+	if ok {
+		if err := p.pc.Close(); err != nil {
+			log.Printf("sfu: close peer connection of client %s error: %v", clientId, err)
+		}
+		s.signalPeers()
+	}
+}
+
+// Close releases every PeerConnection held by the SFU
+func (s *SFU) Close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+	s.mu.Lock()
+	peers := s.peers
+	s.peers = make(map[string]*sfuPeer)
+	s.tracks = make(map[string]*sfuTrack)
+	s.mu.Unlock()
+	for _, p := range peers {
+		_ = p.pc.Close()
+	}
+}
+
+func (s *SFU) findPeer(clientId string) *sfuPeer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.peers[clientId]
+}
+
+// peer returns the PeerConnection of the client, creating it on the first offer
+func (s *SFU) peer(c *Client) (*sfuPeer, error) {
+	s.mu.Lock()
+	if p, ok := s.peers[c.Id]; ok && p.client == c {
+		s.mu.Unlock()
+		return p, nil
+	}
+	s.mu.Unlock()
+	// 同一用户重新连接时，丢弃旧的连接
+	s.RemovePeer(c.Id)
+
+	pc, err := pion.NewPeerConnection(pion.Configuration{ICEServers: iceServers()})
+	if err != nil {
+		return nil, err
+	}
+	p := &sfuPeer{client: c, pc: pc}
+
+	pc.OnICECandidate(func(candidate *pion.ICECandidate) {
+		if candidate != nil {
+			s.signal(c, WebRTCEventIceCandidate, candidate.ToJSON())
+		}
+	})
+	pc.OnConnectionStateChange(func(state pion.PeerConnectionState) {
+		switch state {
+		case pion.PeerConnectionStateFailed:
+			_ = pc.Close()
+		case pion.PeerConnectionStateClosed:
+			if cur := s.findPeer(c.Id); cur == p {
+				s.RemovePeer(c.Id)
+			}
+		}
+	})
+	pc.OnTrack(func(remote *pion.TrackRemote, _ *pion.RTPReceiver) {
+		s.forward(c, remote)
+	})
+
+	s.mu.Lock()
+	s.peers[c.Id] = p
+	s.mu.Unlock()
+
+	return p, nil
+}
+
+// forward copies RTP packets of a published track to its local counterpart,
+// packets are dropped while the role of the publisher does not allow publishing the track
+func (s *SFU) forward(c *Client, remote *pion.TrackRemote) {
+	owner := c.Id
+	// stream id 使用发布者的客户端 id，便于客户端区分远端流
+	local, err := pion.NewTrackLocalStaticRTP(remote.Codec().RTPCodecCapability, remote.ID(), owner)
+	if err != nil {
+		log.Printf("sfu: create local track for client %s error: %v", owner, err)
+		return
+	}
+
+	key := trackKey(owner, local.ID())
+	s.mu.Lock()
+	s.tracks[key] = &sfuTrack{owner: owner, local: local}
+	s.mu.Unlock()
+	s.signalPeers()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.tracks, key)
+		s.mu.Unlock()
+		s.signalPeers()
+	}()
+
+	// 房间正在录制时，同时把包写入录制文件
+	var recorder *Recorder
+	var record *recordTrack
+	defer func() {
+		if record != nil {
+			record.close()
+		}
+	}()
+
+	for {
+		pkt, _, err := remote.ReadRTP()
+		if err != nil {
+			return
+		}
+		if !c.canPublish(remote.Kind()) {
+			continue
+		}
+		if rec := s.room.recorder.Load(); rec != recorder {
+			recorder, record = rec, nil
+			if rec != nil {
+				record = rec.track(c.User, remote.ID(), remote.Codec())
+			}
+		}
+		if record != nil {
+			record.writeRTP(pkt)
+		}
+		if err = local.WriteRTP(pkt); err != nil && !errors.Is(err, io.ErrClosedPipe) {
+			return
+		}
+	}
+}
+
+// canPublish reports whether the client may publish a track of the kind, the single video
+// track carries the camera or the screen depending on the announced media state
+func (c *Client) canPublish(kind pion.RTPCodecType) bool {
+	state := c.media.Load()
+	if state == nil {
+		state = &MediaStatePayload{}
+	}
+	switch kind {
+	case pion.RTPCodecTypeVideo:
+		if state.Screen {
+			return c.Can(entity.CapabilityScreenShare)
+		}
+		return c.Can(entity.CapabilityPublish)
+	case pion.RTPCodecTypeAudio:
+		// 桌面音频与麦克风混在同一轨道中
+		if c.Can(entity.CapabilityPublish) {
+			return true
+		}
+		return state.Screen && state.DesktopAudio && !state.Audio && c.Can(entity.CapabilityScreenShare)
+	}
+	return false
+}
+
+// attachTracks makes the senders of a peer match the forwarded tracks, the caller must hold s.mu
+func (s *SFU) attachTracks(p *sfuPeer) {
+	existing := make(map[string]bool)
+	for _, sender := range p.pc.GetSenders() {
+		track := sender.Track()
+		if track == nil {
+			continue
+		}
+		key := trackKey(track.StreamID(), track.ID())
+		existing[key] = true
+		if _, ok := s.tracks[key]; !ok {
+			if err := p.pc.RemoveTrack(sender); err == nil {
+				p.dirty.Store(true)
+			}
+		}
+	}
+
+	for key, t := range s.tracks {
+		if t.owner == p.client.Id || existing[key] {
+			continue
+		}
+		if _, err := p.pc.AddTrack(t.local); err != nil {
+			log.Printf("sfu: add track %s to client %s error: %v", key, p.client.Id, err)
+			continue
+		}
+		p.dirty.Store(true)
+	}
+}
+
+// signalPeers renegotiates with every client whose senders changed
+func (s *SFU) signalPeers() {
+	s.mu.Lock()
+	peers := make([]*sfuPeer, 0, len(s.peers))
+	for _, p := range s.peers {
+		if p.pc.ConnectionState() == pion.PeerConnectionStateClosed {
+			continue
+		}
+		s.attachTracks(p)
+		if p.dirty.Load() {
+			peers = append(peers, p)
+		}
+	}
+	s.mu.Unlock()
+
+	// 在 s.mu 之外协商和发送，避免阻塞转发
+	retry := false
+	for _, p := range peers {
+		offer, ok := s.offer(p)
+		if !ok {
+			retry = true
+			continue
+		}
+		if offer != nil {
+			s.signal(p.client, WebRTCEventOffer, offer)
+		}
+	}
+
+	if retry {
+		time.AfterFunc(time.Second, func() {
+			select {
+			case <-s.closed:
+			default:
+				s.signalPeers()
+			}
+		})
+	}
+}
+
+// offer creates a new offer for a dirty peer, ok is false when the negotiation must be retried later
+func (s *SFU) offer(p *sfuPeer) (offer *pion.SessionDescription, ok bool) {
+	p.negotiation.Lock()
+	defer p.negotiation.Unlock()
+	if !p.dirty.Load() {
+		return nil, true
+	}
+	// 上一次协商还未完成，稍后重试
+	if p.pc.SignalingState() != pion.SignalingStateStable {
+		return nil, false
+	}
+	p.dirty.Store(false)
+	o, err := p.pc.CreateOffer(nil)
+	if err == nil {
+		err = p.pc.SetLocalDescription(o)
+	}
+	if err != nil {
+		log.Printf("sfu: create offer for client %s error: %v", p.client.Id, err)
+		p.dirty.Store(true)
+		return nil, p.pc.ConnectionState() == pion.PeerConnectionStateClosed
+	}
+
+	return &o, true
+}
+
+// signal sends a webrtc-event from the SFU to a client
+func (s *SFU) signal(c *Client, t WebRTCEventType, data any) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("sfu: marshal %s for client %s error: %v", t, c.Id, err)
+		return
+	}
+	c.Send(NewMessage(MessageTypeWebRTCEvent, s.self, &WebRTCEvent{Type: t, Data: b}))
+}
+
+// keyframeLoop periodically sends PLI so that new subscribers get a picture quickly
+func (s *SFU) keyframeLoop() {
+	ticker := time.NewTicker(keyframeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			for _, p := range s.peers {
+				for _, receiver := range p.pc.GetReceivers() {
+					if track := receiver.Track(); track != nil {
+						_ = p.pc.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(track.SSRC())}})
+					}
+				}
+			}
+			s.mu.Unlock()
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+func iceServers() []pion.ICEServer {
+	urls := config.GetConfig().SFU.ICEServers
+	if len(urls) == 0 {
+		return nil
+	}
+	return []pion.ICEServer{{URLs: urls}}
+}
@@ -0,0 +1,29 @@
+package webrtc
+
+import (
+	"meeting/internal/model/entity"
+	"testing"
+
+	pion "github.com/pion/webrtc/v4"
+)
+
+func TestCanPublishChecksTheCapabilityOfTheTrack(t *testing.T) {
+	screenOnly := &Client{User: &User{Id: "a", Capabilities: []entity.Capability{entity.CapabilityScreenShare}}}
+	if screenOnly.canPublish(pion.RTPCodecTypeVideo) || screenOnly.canPublish(pion.RTPCodecTypeAudio) {
+		t.Fatal("screen share only client may forward its camera or microphone")
+	}
+	screenOnly.media.Store(&MediaStatePayload{Screen: true, DesktopAudio: true})
+	if !screenOnly.canPublish(pion.RTPCodecTypeVideo) || !screenOnly.canPublish(pion.RTPCodecTypeAudio) {
+		t.Fatal("screen share only client may not forward its screen")
+	}
+
+	publisher := &Client{User: &User{Id: "b", Capabilities: []entity.Capability{entity.CapabilityPublish}}}
+	publisher.media.Store(&MediaStatePayload{Video: true, Audio: true})
+	if !publisher.canPublish(pion.RTPCodecTypeVideo) || !publisher.canPublish(pion.RTPCodecTypeAudio) {
+		t.Fatal("publisher may not forward its camera or microphone")
+	}
+	publisher.media.Store(&MediaStatePayload{Screen: true})
+	if publisher.canPublish(pion.RTPCodecTypeVideo) {
+		t.Fatal("publisher without screen share may forward its screen")
+	}
+}
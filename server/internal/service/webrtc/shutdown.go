@@ -0,0 +1,108 @@
+package webrtc
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"time"
+)
+
+// drainPollInterval controls how often Shutdown checks whether the rooms are empty
+const drainPollInterval = 500 * time.Millisecond
+
+// ServerRestartingPayload is the data of a server-restarting message
+type ServerRestartingPayload struct {
+	// ReconnectAfter is the delay in milliseconds before the client should reconnect,
+	// it is spread over the drain period so that clients do not reconnect all at once
+	ReconnectAfter int64 `json:"reconnectAfter"`
+}
+
+// Draining reports whether the server is shutting down and refuses new clients
+func (s *Server) Draining() bool {
+	return s.draining.Load()
+}
+
+// Shutdown asks every local client to reconnect, waits up to drain for the
+// rooms to empty, then disconnects the remaining clients and stops the rooms.
+func (s *Server) Shutdown(ctx context.Context, drain time.Duration) {
+	s.draining.Store(true)
+	// 房间关闭事件发出后再结束监控事件流
+	defer s.closeSubscribers()
+
+	spread := max(int64(drain/2/time.Millisecond), 1)
+	for _, r := range s.allRooms() {
+		for _, c := range r.AllClients() {
+			if c.isLocal() {
+				c.Send(NewMessage(MessageTypeServerRestarting, nil, &ServerRestartingPayload{
+					ReconnectAfter: rand.Int64N(spread),
+				}))
+			}
+		}
+	}
+
+	timer := time.NewTimer(drain)
+	defer timer.Stop()
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for s.localClientCount() > 0 {
+		select {
+		case <-ticker.C:
+		case <-timer.C:
+			log.Printf("drain period elapsed, disconnecting %d clients", s.localClientCount())
+			s.closeRooms()
+			return
+		case <-ctx.Done():
+			s.closeRooms()
+			return
+		}
+	}
+	s.closeRooms()
+}
+
+func (s *Server) allRooms() []*Room {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rooms := make([]*Room, 0, len(s.rooms))
+	for _, r := range s.rooms {
+		rooms = append(rooms, r)
+	}
+
+	return rooms
+}
+
+func (s *Server) localClientCount() int {
+	count := 0
+	for _, r := range s.allRooms() {
+		for _, c := range r.AllClients() {
+			// 断线的客户端在关闭期间无法恢复会话，不再等待
+			if c.isLocal() && c.detachedSince().IsZero() && c.recorder == nil {
+				count++
+			}
+		}
+	}
+
+	return count
+}
+
+// closeRooms disconnects the remaining clients and stops every room loop
+func (s *Server) closeRooms() {
+	for _, r := range s.allRooms() {
+		// 录制文件需要在进程退出前写完
+		if rec := r.recorder.Load(); rec != nil {
+			rec.Stop()
+		}
+		for _, c := range r.AllClients() {
+			if c.isLocal() {
+				// 先注销，让其他节点收到离开消息
+				r.UnregisterClient(c)
+				c.close()
+			}
+		}
+		r.Close()
+		s.RemoveRoom(r.Id)
+		// 参会记录需要在进程退出前写完
+		r.persisted.Wait()
+		// 离开消息需要在进程退出前发给其他节点
+		<-r.published
+	}
+}
@@ -1,81 +1,156 @@
 package webrtc
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
 	"errors"
-	"fmt"
 	"meeting/internal/model/entity"
+	"meeting/pkg/keyring"
 	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
-const Secret = "X8#kP2!9mQ5$zR7*3fT1&bY4%nH6@gS0"
+const (
+	tokenIssuer   = "met"
+	tokenAudience = "met-websocket"
+	// join tokens must be used within this period
+	tokenTTL = 5 * time.Minute
+)
 
 var (
 	ErrMissingRequiredFields = errors.New("missing required fields")
 	ErrInvalidSignature      = errors.New("invalid signature")
 	ErrSignatureExpired      = errors.New("signature expired")
+	ErrUnknownKey            = errors.New("unknown signing key")
 )
 
-// SignatureRequest represents the request structure for generating signatures
+// SignatureRequest represents the identity granted to a user joining a room
 type SignatureRequest struct {
-	RoomId    string      `json:"roomId"    form:"roomId"`
-	UserId    string      `json:"userId"    form:"userId"`
-	Role      entity.Role `json:"role"      form:"role"`
-	Timestamp int64       `json:"timestamp" form:"timestamp"`
+	RoomId string      `json:"roomId" form:"roomId"`
+	UserId string      `json:"userId" form:"-"`
+	Name   string      `json:"name"   form:"-"`
+	Avatar string      `json:"avatar" form:"-"`
+	Role   entity.Role `json:"role"   form:"-"`
 }
 
 // SignatureResponse represents the response structure for generating signatures
 type SignatureResponse struct {
 	SignatureRequest
-	Name         string `json:"name" form:"name"`
-	Avatar       string `json:"avatar" form:"avatar"`
-	RoomName     string `json:"roomName" form:"roomName"`
-	RoomPassword string `json:"roomPassword" form:"roomPassword"`
-	Signature    string `json:"signature" form:"signature"`
+	RoomName string `json:"roomName"`
+	RoomMode string `json:"roomMode"`
+	// InviteCode is only returned to hosts and co-hosts
+	InviteCode string `json:"inviteCode,omitempty"`
+	// Token is the join credential passed to the websocket endpoint
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+// JoinClaims are the claims of a join token, the subject is the user uuid
+type JoinClaims struct {
+	RoomId       string              `json:"rid"`
+	Name         string              `json:"name"`
+	Avatar       string              `json:"avatar,omitempty"`
+	Role         entity.Role         `json:"role"`
+	Capabilities []entity.Capability `json:"caps"`
+	jwt.RegisteredClaims
+}
+
+// User returns the room user described by the token
+func (c *JoinClaims) User() *User {
+	return &User{
+		Id:           c.Subject,
+		Name:         c.Name,
+		Avatar:       c.Avatar,
+		Role:         c.Role,
+		Capabilities: c.Capabilities,
+	}
 }
 
-// GenerateSignature generates a signature for joining a room
+// GenerateSignature issues a signed join token for a room
 func GenerateSignature(req SignatureRequest) (*SignatureResponse, error) {
 	// Validate required fields
-	if req.RoomId == "" || req.UserId == "" || req.Timestamp == 0 {
+	if req.RoomId == "" || req.UserId == "" {
 		return nil, ErrMissingRequiredFields
 	}
 
-	data := fmt.Sprintf("%s%s%d%d", req.RoomId, req.UserId, req.Role, req.Timestamp)
-	// Create a new HMAC by defining the hash type and the key
-	h := hmac.New(sha256.New, []byte(Secret))
-
-	// Write the data to the HMAC
-	h.Write([]byte(data))
+	key := keyring.Default().ActiveKey()
+	if key == nil {
+		return nil, keyring.ErrNoActiveKey
+	}
 
-	// Get the hexadecimal encoding of the HMAC
-	signature := hex.EncodeToString(h.Sum(nil))
+	now := time.Now()
+	claims := &JoinClaims{
+		RoomId:       req.RoomId,
+		Name:         req.Name,
+		Avatar:       req.Avatar,
+		Role:         req.Role,
+		Capabilities: req.Role.Capabilities(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			Subject:   req.UserId,
+			Audience:  jwt.ClaimStrings{tokenAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(tokenTTL)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        uuid.New().String(),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = key.Id
+	signed, err := token.SignedString(key.Derive("join-token"))
+	if err != nil {
+		return nil, err
+	}
 
-	response := &SignatureResponse{
+	return &SignatureResponse{
 		SignatureRequest: req,
-		Signature:        signature,
+		Token:            signed,
+		ExpiresAt:        claims.ExpiresAt.UnixMilli(),
+	}, nil
+}
+
+// ValidateSignature verifies a join token and returns its claims
+func ValidateSignature(token string) (*JoinClaims, error) {
+	claims, err := validateSignature(token)
+	if err != nil {
+		signatureFailures.WithLabelValues(signatureFailureReasons[err]).Inc()
 	}
 
-	return response, nil
+	return claims, err
 }
 
-// ValidateSignature validates a signature for joining a room
-func ValidateSignature(req SignatureResponse) error {
-	resp, err := GenerateSignature(req.SignatureRequest)
-
-	if err != nil {
-		return err
+func validateSignature(token string) (*JoinClaims, error) {
+	if token == "" {
+		return nil, ErrMissingRequiredFields
 	}
 
-	if !hmac.Equal([]byte(req.Signature), []byte(resp.Signature)) {
-		return ErrInvalidSignature
+	var claims JoinClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		// 轮换期间已退役但未过期的密钥仍然有效
+		key := keyring.Default().Find(kid)
+		if key == nil {
+			return nil, ErrUnknownKey
+		}
+		return key.Derive("join-token"), nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(tokenIssuer),
+		jwt.WithAudience(tokenAudience),
+		jwt.WithExpirationRequired(),
+	)
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return nil, ErrSignatureExpired
+	case errors.Is(err, ErrUnknownKey):
+		return nil, ErrUnknownKey
+	case err != nil:
+		return nil, ErrInvalidSignature
 	}
 
-	if time.Now().UnixMilli() > req.Timestamp+5*60*1000 {
-		return ErrSignatureExpired
+	if claims.RoomId == "" || claims.Subject == "" {
+		return nil, ErrMissingRequiredFields
 	}
 
-	return nil
+	return &claims, nil
 }
@@ -0,0 +1,132 @@
+package webrtc
+
+import (
+	"errors"
+	"meeting/internal/model/entity"
+	"meeting/pkg/keyring"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// useTestKeys installs a key ring with an active, a retired and an expired key
+func useTestKeys(t *testing.T) (active, retired, expired *keyring.Key) {
+	t.Helper()
+	later := time.Now().Add(time.Hour)
+	earlier := time.Now().Add(-time.Hour)
+	active = &keyring.Key{Id: "active", Secret: "active-secret"}
+	retired = &keyring.Key{Id: "retired", Secret: "retired-secret", ExpiresAt: &later}
+	expired = &keyring.Key{Id: "expired", Secret: "expired-secret", ExpiresAt: &earlier}
+	keyring.Use(&keyring.KeyRing{Active: active.Id, Keys: []*keyring.Key{expired, retired, active}})
+
+	return active, retired, expired
+}
+
+func signTestToken(t *testing.T, method jwt.SigningMethod, kid string, key *keyring.Key, claims *JoinClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	var secret any = jwt.UnsafeAllowNoneSignatureType
+	if key != nil {
+		secret = key.Derive("join-token")
+	}
+	signed, err := token.SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func testClaims(modify func(c *JoinClaims)) *JoinClaims {
+	now := time.Now()
+	c := &JoinClaims{
+		RoomId: "room",
+		Name:   "alice",
+		Role:   entity.RoleUser,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			Subject:   "user",
+			Audience:  jwt.ClaimStrings{tokenAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(tokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	if modify != nil {
+		modify(c)
+	}
+	return c
+}
+
+func TestGenerateAndValidateSignature(t *testing.T) {
+	useTestKeys(t)
+	res, err := GenerateSignature(SignatureRequest{RoomId: "room", UserId: "user", Name: "alice", Role: entity.RoleViewer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := validateSignature(res.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := claims.User()
+	if claims.RoomId != "room" || u.Id != "user" || u.Name != "alice" || u.Role != entity.RoleViewer {
+		t.Fatalf("claims = %+v", claims)
+	}
+	if len(u.Capabilities) != len(entity.RoleViewer.Capabilities()) {
+		t.Fatalf("capabilities = %v, want those of a viewer", u.Capabilities)
+	}
+
+	if _, err = GenerateSignature(SignatureRequest{RoomId: "room"}); !errors.Is(err, ErrMissingRequiredFields) {
+		t.Fatalf("generate without user: %v, want ErrMissingRequiredFields", err)
+	}
+}
+
+func TestValidateSignatureFailures(t *testing.T) {
+	active, retired, expired := useTestKeys(t)
+	hs256 := jwt.SigningMethodHS256
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"valid", signTestToken(t, hs256, active.Id, active, testClaims(nil)), nil},
+		{"retired key during grace period", signTestToken(t, hs256, retired.Id, retired, testClaims(nil)), nil},
+		{"empty token", "", ErrMissingRequiredFields},
+		{"missing room", signTestToken(t, hs256, active.Id, active, testClaims(func(c *JoinClaims) { c.RoomId = "" })), ErrMissingRequiredFields},
+		{"missing subject", signTestToken(t, hs256, active.Id, active, testClaims(func(c *JoinClaims) { c.Subject = "" })), ErrMissingRequiredFields},
+		{"expired key", signTestToken(t, hs256, expired.Id, expired, testClaims(nil)), ErrUnknownKey},
+		{"unknown kid", signTestToken(t, hs256, "unknown", active, testClaims(nil)), ErrUnknownKey},
+		{"missing kid", signTestToken(t, hs256, "", active, testClaims(nil)), ErrUnknownKey},
+		{"expired token", signTestToken(t, hs256, active.Id, active, testClaims(func(c *JoinClaims) {
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+		})), ErrSignatureExpired},
+		{"missing expiry", signTestToken(t, hs256, active.Id, active, testClaims(func(c *JoinClaims) { c.ExpiresAt = nil })), ErrInvalidSignature},
+		{"not yet valid", signTestToken(t, hs256, active.Id, active, testClaims(func(c *JoinClaims) {
+			c.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Minute))
+		})), ErrInvalidSignature},
+		{"wrong audience", signTestToken(t, hs256, active.Id, active, testClaims(func(c *JoinClaims) { c.Audience = jwt.ClaimStrings{"other"} })), ErrInvalidSignature},
+		{"wrong issuer", signTestToken(t, hs256, active.Id, active, testClaims(func(c *JoinClaims) { c.Issuer = "other" })), ErrInvalidSignature},
+		{"signed with another key", signTestToken(t, hs256, active.Id, retired, testClaims(nil)), ErrInvalidSignature},
+		{"alg none", signTestToken(t, jwt.SigningMethodNone, active.Id, nil, testClaims(nil)), ErrInvalidSignature},
+		{"alg HS512", signTestToken(t, jwt.SigningMethodHS512, active.Id, active, testClaims(nil)), ErrInvalidSignature},
+		{"malformed", "not.a.token", ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := validateSignature(tt.token)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if err == nil && claims == nil {
+				t.Fatal("valid token returned no claims")
+			}
+			// 每种失败都有对应的指标标签
+			if err != nil && signatureFailureReasons[err] == "" {
+				t.Fatalf("no metric label for %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package webrtc
+
+import (
+	"meeting/internal/model/entity"
+	"meeting/internal/service/webhook"
+	"time"
+)
+
+// RoomStartedData is the data of a room.started webhook event, sent by the node opening the meeting session
+type RoomStartedData struct {
+	Mode      string    `json:"mode"`
+	StartTime time.Time `json:"startTime"`
+}
+
+// RoomEndedData is the data of a room.ended webhook event, sent by the node closing the meeting session
+type RoomEndedData struct {
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	MaxOnline int       `json:"maxOnline"`
+}
+
+// ChatMessageData is the data of a chat.message webhook event
+type ChatMessageData struct {
+	Id        string               `json:"id"`
+	Content   string               `json:"content"`
+	Timestamp int64                `json:"timestamp"`
+	File      *FilePayload         `json:"file,omitempty"`
+	From      *webhook.Participant `json:"from"`
+}
+
+// dispatchWebhook sends a webhook event of the room, events of remote clients are sent by their own node
+// it may be called while holding r.mu and never blocks the room loop
+func (r *Room) dispatchWebhook(t entity.WebhookEvent, data any) {
+	webhook.Dispatch(r.entityId(), &webhook.Event{Type: t, CreatedAt: time.Now(), Room: webhook.Room{Id: r.Id, Name: r.Name}, Data: data})
+}
+
+// participant describes the client in webhook events
+func (c *Client) participant() *webhook.Participant {
+	return &webhook.Participant{
+		Id:     c.Id,
+		Name:   c.Name,
+		Avatar: c.Avatar,
+		Role:   c.currentRole().String(),
+	}
+}
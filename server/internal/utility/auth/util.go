@@ -3,6 +3,8 @@ package auth
 import (
 	"meeting/internal/constants"
 	"meeting/internal/model/entity"
+	"meeting/pkg/config"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -28,3 +30,17 @@ func MustGetUserFromCtx(ctx *gin.Context) *entity.User {
 
 	return user
 }
+
+// IsAdmin reports whether the verified email of the user is listed in App.Admins
+func IsAdmin(user *entity.User) bool {
+	if user == nil || user.Email == "" || !user.EmailVerified {
+		return false
+	}
+	for _, email := range config.GetConfig().App.Admins {
+		if strings.EqualFold(email, user.Email) {
+			return true
+		}
+	}
+
+	return false
+}
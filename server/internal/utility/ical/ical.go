@@ -0,0 +1,124 @@
+package ical
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	timeFormat      = "20060102T150405Z"
+	localTimeFormat = "20060102T150405"
+)
+
+// Attendee is an invited participant of an event
+type Attendee struct {
+	Name  string
+	Email string
+}
+
+// Event is a VEVENT of an iCalendar file
+type Event struct {
+	Uid         string
+	Summary     string
+	Description string
+	URL         string
+	Start       time.Time
+	End         time.Time
+	// Frequency is the RRULE frequency, e.g. DAILY or WEEKLY, empty for a single event
+	Frequency string
+	Until     *time.Time
+	// Location writes DTSTART and DTEND with a TZID so that recurrences keep the local time across DST,
+	// the IANA name is used as TZID, which calendar clients resolve without a VTIMEZONE
+	Location  *time.Location
+	Organizer *Attendee
+	Attendees []Attendee
+}
+
+// Calendar renders the events as an iCalendar (RFC 5545) document
+func Calendar(events ...Event) []byte {
+	w := &writer{}
+	w.line("BEGIN:VCALENDAR")
+	w.line("VERSION:2.0")
+	w.line("PRODID:-//met//meeting//EN")
+	w.line("CALSCALE:GREGORIAN")
+	w.line("METHOD:PUBLISH")
+	now := time.Now()
+	for _, e := range events {
+		w.line("BEGIN:VEVENT")
+		w.line("UID:" + escape(e.Uid))
+		w.line("DTSTAMP:" + now.UTC().Format(timeFormat))
+		w.line("DTSTART" + e.dateTime(e.Start))
+		if !e.End.IsZero() {
+			w.line("DTEND" + e.dateTime(e.End))
+		}
+		w.line("SUMMARY:" + escape(e.Summary))
+		if e.Description != "" {
+			w.line("DESCRIPTION:" + escape(e.Description))
+		}
+		if e.URL != "" {
+			w.line("URL:" + e.URL)
+		}
+		if e.Frequency != "" {
+			rule := "RRULE:FREQ=" + e.Frequency
+			if e.Until != nil {
+				rule += ";UNTIL=" + e.Until.UTC().Format(timeFormat)
+			}
+			w.line(rule)
+		}
+		if e.Organizer != nil {
+			w.line("ORGANIZER;CN=" + param(e.Organizer.Name) + ":mailto:" + e.Organizer.Email)
+		}
+		for _, a := range e.Attendees {
+			w.line("ATTENDEE;CN=" + param(a.Name) + ";ROLE=REQ-PARTICIPANT:mailto:" + a.Email)
+		}
+		w.line("END:VEVENT")
+	}
+	w.line("END:VCALENDAR")
+
+	return []byte(w.String())
+}
+
+// dateTime formats t as the parameters and value of a DATE-TIME property
+func (e *Event) dateTime(t time.Time) string {
+	if e.Location == nil || e.Location == time.UTC {
+		return ":" + t.UTC().Format(timeFormat)
+	}
+	return ";TZID=" + e.Location.String() + ":" + t.In(e.Location).Format(localTimeFormat)
+}
+
+type writer struct {
+	strings.Builder
+}
+
+// maxLineOctets is the longest content line allowed by RFC 5545, the leading space of continuation lines included
+const maxLineOctets = 75
+
+// line writes a content line folded at 75 octets and terminated by CRLF
+func (w *writer) line(s string) {
+	// 续行以空格开头，只能再写 74 个字节
+	limit := maxLineOctets
+	for len(s) > limit {
+		cut := limit
+		// 不在 UTF-8 多字节字符中间折行
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.WriteString(s[:cut])
+		w.WriteString("\r\n ")
+		s = s[cut:]
+		limit = maxLineOctets - 1
+	}
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+func param(s string) string {
+	if strings.ContainsAny(s, ";:,") {
+		return `"` + strings.ReplaceAll(s, `"`, "") + `"`
+	}
+	return s
+}
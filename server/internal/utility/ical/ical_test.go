@@ -0,0 +1,43 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestLineFolding(t *testing.T) {
+	for _, summary := range []string{
+		strings.Repeat("a", 200),
+		strings.Repeat("周会", 60),
+		"x" + strings.Repeat("会议🎉", 30),
+	} {
+		w := &writer{}
+		w.line("SUMMARY:" + summary)
+		out := w.String()
+		if !strings.HasSuffix(out, "\r\n") {
+			t.Fatal("line is not terminated by CRLF")
+		}
+
+		lines := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+		var unfolded strings.Builder
+		for i, l := range lines {
+			if len(l) > maxLineOctets {
+				t.Fatalf("line %d is %d octets: %q", i, len(l), l)
+			}
+			if i > 0 {
+				if !strings.HasPrefix(l, " ") {
+					t.Fatalf("continuation line %d does not start with a space", i)
+				}
+				l = l[1:]
+			}
+			if !utf8.ValidString(l) {
+				t.Fatalf("line %d splits a character: %q", i, l)
+			}
+			unfolded.WriteString(l)
+		}
+		if unfolded.String() != "SUMMARY:"+summary {
+			t.Fatalf("unfolded to %q", unfolded.String())
+		}
+	}
+}
@@ -13,7 +13,7 @@ func main() {
 	c := &cli.Command{
 		Name:     "met",
 		Usage:    "met cli",
-		Commands: []*cli.Command{cmd.Serve},
+		Commands: []*cli.Command{cmd.Serve, cmd.Keys, cmd.Migrate},
 	}
 
 	if err := c.Run(context.Background(), os.Args); err != nil {
@@ -0,0 +1,46 @@
+package broker
+
+import (
+	"context"
+	"meeting/pkg/config"
+	"strings"
+	"sync"
+)
+
+// Handler receives a payload published on a subscribed topic.
+type Handler func(payload []byte)
+
+// Subscription is returned by Broker.Subscribe and stops delivery when unsubscribed.
+type Subscription interface {
+	Unsubscribe() error
+}
+
+// Broker is a topic based publish/subscribe transport shared by all server instances.
+type Broker interface {
+	Publish(ctx context.Context, topic string, payload []byte) error
+	Subscribe(topic string, handler Handler) (Subscription, error)
+	Close() error
+}
+
+var globalBroker Broker
+var once sync.Once
+
+func initBroker() {
+	c := config.GetConfig().Broker
+	switch strings.ToLower(c.Driver) {
+	case "redis":
+		globalBroker = NewRedisBroker(c.Addr, c.Password, c.DB, c.Prefix)
+	default:
+		globalBroker = NewMemoryBroker()
+	}
+}
+
+func InitializeBroker() {
+	once.Do(initBroker)
+}
+
+// Default returns the configured broker, falling back to an in-memory one.
+func Default() Broker {
+	InitializeBroker()
+	return globalBroker
+}
@@ -0,0 +1,274 @@
+package broker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryBrokerDeliversInOrder(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Close()
+
+	received := make(chan string, 3)
+	sub, err := b.Subscribe("room:1", func(payload []byte) {
+		received <- string(payload)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"a", "b", "c"} {
+		if err = b.Publish(context.Background(), "room:1", []byte(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = b.Publish(context.Background(), "room:2", []byte("other")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"a", "b", "c"} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+
+	_ = sub.Unsubscribe()
+	_ = b.Publish(context.Background(), "room:1", []byte("late"))
+	select {
+	case got := <-received:
+		t.Fatalf("received %q after unsubscribe", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRedisBrokerSubscribeTimeout(t *testing.T) {
+	// 模拟接受连接但从不应答的 Redis
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	b := NewRedisBroker(l.Addr().String(), "", 0, "test:")
+	defer b.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := b.Subscribe("room:1", func([]byte) {})
+		done <- err
+	}()
+	select {
+	case err = <-done:
+		if err == nil {
+			t.Fatal("subscribe to an unresponsive server succeeded")
+		}
+	case <-time.After(subscribeTimeout + 5*time.Second):
+		t.Fatal("subscribe did not time out")
+	}
+}
+
+// fakeRedis is a local stand-in for Redis that only implements RESP2 pub/sub
+type fakeRedis struct {
+	l  net.Listener
+	mu sync.Mutex
+	// subscribers of each channel
+	channels map[string]map[net.Conn]bool
+	// channels named in PUBLISH commands
+	published []string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRedis{l: l, channels: make(map[string]map[net.Conn]bool)}
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+
+	return r
+}
+
+func (r *fakeRedis) addr() string {
+	return r.l.Addr().String()
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer func() {
+		r.mu.Lock()
+		for _, subs := range r.channels {
+			delete(subs, conn)
+		}
+		r.mu.Unlock()
+		conn.Close()
+	}()
+
+	rd := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(rd)
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		switch strings.ToUpper(args[0]) {
+		case "SUBSCRIBE":
+			for i, ch := range args[1:] {
+				if r.channels[ch] == nil {
+					r.channels[ch] = make(map[net.Conn]bool)
+				}
+				r.channels[ch][conn] = true
+				fmt.Fprintf(conn, "*3\r\n$9\r\nsubscribe\r\n%s:%d\r\n", bulk(ch), i+1)
+			}
+		case "PUBLISH":
+			r.published = append(r.published, args[1])
+			for sub := range r.channels[args[1]] {
+				fmt.Fprintf(sub, "*3\r\n$7\r\nmessage\r\n%s%s", bulk(args[1]), bulk(args[2]))
+			}
+			fmt.Fprintf(conn, ":%d\r\n", len(r.channels[args[1]]))
+		case "PING":
+			fmt.Fprint(conn, "+PONG\r\n")
+		default:
+			// HELLO 和 CLIENT SETINFO 返回错误，客户端使用 RESP2
+			fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+		}
+		r.mu.Unlock()
+	}
+}
+
+// subscribers returns the number of connections subscribed to a channel
+func (r *fakeRedis) subscribers(channel string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.channels[channel])
+}
+
+func bulk(s string) string {
+	return "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n"
+}
+
+// readCommand reads a command sent as an array of bulk strings
+func readCommand(rd *bufio.Reader) ([]string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid command %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = rd.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+
+	return args, nil
+}
+
+func TestRedisBrokerDeliversInOrder(t *testing.T) {
+	redis := newFakeRedis(t)
+	// 两个节点使用相同前缀，另一个部署使用不同前缀
+	node1 := NewRedisBroker(redis.addr(), "", 0, "test:")
+	defer node1.Close()
+	node2 := NewRedisBroker(redis.addr(), "", 0, "test:")
+	defer node2.Close()
+	other := NewRedisBroker(redis.addr(), "", 0, "")
+	defer other.Close()
+
+	received := make(chan string, 10)
+	sub, err := node1.Subscribe("room:1", func(payload []byte) {
+		received <- string(payload)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, p := range []string{"a", "b", "c"} {
+		if err = node2.Publish(ctx, "room:1", []byte(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = node2.Publish(ctx, "room:2", []byte("other room")); err != nil {
+		t.Fatal(err)
+	}
+	if err = other.Publish(ctx, "room:1", []byte("other deployment")); err != nil {
+		t.Fatal(err)
+	}
+	if err = node2.Publish(ctx, "room:1", []byte("d")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"a", "b", "c", "d"} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+	redis.mu.Lock()
+	channels := strings.Join(redis.published, " ")
+	redis.mu.Unlock()
+	if channels != "test:room:1 test:room:1 test:room:1 test:room:2 met:room:1 test:room:1" {
+		t.Fatalf("published to %s", channels)
+	}
+
+	if err = sub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for redis.subscribers("test:room:1") > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("subscription was kept after unsubscribe")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_ = node2.Publish(ctx, "room:1", []byte("late"))
+	select {
+	case got := <-received:
+		t.Fatalf("received %q after unsubscribe", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
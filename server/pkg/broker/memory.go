@@ -0,0 +1,108 @@
+package broker
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryBroker delivers messages between subscribers of the same process.
+type MemoryBroker struct {
+	mu     sync.RWMutex
+	topics map[string]map[*memorySubscription]struct{}
+}
+
+type memorySubscription struct {
+	broker  *MemoryBroker
+	topic   string
+	handler Handler
+	queue   chan []byte
+	done    chan struct{}
+	once    sync.Once
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		topics: make(map[string]map[*memorySubscription]struct{}),
+	}
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, topic string, payload []byte) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for s := range b.topics[topic] {
+		select {
+		case s.queue <- payload:
+		case <-s.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(topic string, handler Handler) (Subscription, error) {
+	s := &memorySubscription{
+		broker:  b,
+		topic:   topic,
+		handler: handler,
+		queue:   make(chan []byte, 256),
+		done:    make(chan struct{}),
+	}
+	b.mu.Lock()
+	if b.topics[topic] == nil {
+		b.topics[topic] = make(map[*memorySubscription]struct{})
+	}
+	b.topics[topic][s] = struct{}{}
+	b.mu.Unlock()
+
+	// 每个订阅使用独立的协程投递，保证同一订阅内消息有序
+	go s.run()
+
+	return s, nil
+}
+
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	topics := b.topics
+	b.topics = make(map[string]map[*memorySubscription]struct{})
+	b.mu.Unlock()
+	for _, subs := range topics {
+		for s := range subs {
+			s.stop()
+		}
+	}
+
+	return nil
+}
+
+func (s *memorySubscription) run() {
+	for {
+		select {
+		case payload := <-s.queue:
+			s.handler(payload)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *memorySubscription) stop() {
+	s.once.Do(func() {
+		close(s.done)
+	})
+}
+
+func (s *memorySubscription) Unsubscribe() error {
+	s.broker.mu.Lock()
+	if subs, ok := s.broker.topics[s.topic]; ok {
+		delete(subs, s)
+		if len(subs) == 0 {
+			delete(s.broker.topics, s.topic)
+		}
+	}
+	s.broker.mu.Unlock()
+	s.stop()
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package broker
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// subscribeTimeout bounds the wait for Redis to confirm a subscription
+const subscribeTimeout = 5 * time.Second
+
+// RedisBroker fans messages out to every server instance through Redis pub/sub.
+type RedisBroker struct {
+	client *redis.Client
+	prefix string
+}
+
+type redisSubscription struct {
+	pubsub *redis.PubSub
+}
+
+func NewRedisBroker(addr, password string, db int, prefix string) *RedisBroker {
+	if prefix == "" {
+		prefix = "met:"
+	}
+	return &RedisBroker{
+		client: redis.NewClient(&redis.Options{
+			Addr:     addr,
+			Password: password,
+			DB:       db,
+		}),
+		prefix: prefix,
+	}
+}
+
+func (b *RedisBroker) Publish(ctx context.Context, topic string, payload []byte) error {
+	return b.client.Publish(ctx, b.prefix+topic, payload).Err()
+}
+
+func (b *RedisBroker) Subscribe(topic string, handler Handler) (Subscription, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), subscribeTimeout)
+	defer cancel()
+	pubsub := b.client.Subscribe(ctx, b.prefix+topic)
+	// 等待订阅确认，避免订阅建立前发布的消息丢失
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return nil, err
+	}
+
+	go func() {
+		for msg := range pubsub.Channel() {
+			handler([]byte(msg.Payload))
+		}
+	}()
+
+	return &redisSubscription{pubsub: pubsub}, nil
+}
+
+func (b *RedisBroker) Close() error {
+	return b.client.Close()
+}
+
+func (s *redisSubscription) Unsubscribe() error {
+	return s.pubsub.Close()
+}
@@ -17,15 +17,81 @@ var configOnce sync.Once
 type TomlConfig struct {
 	App struct {
 		Port uint16
+		URL  string // 前端访问地址，用于生成会议链接
+		// 关闭服务时等待房间清空的秒数
+		DrainSeconds int
+		// 断线后保留会话的秒数，期间重连不会触发离开和加入
+		ResumeSeconds int
+		// 管理员邮箱，可以查看系统监控
+		Admins []string
 	}
+	// Mysql is kept for existing deployments, Database.DSN takes precedence
 	Mysql struct {
 		DSN string
 	}
+	Database struct {
+		Driver string // mysql、postgres 或 sqlite
+		DSN    string
+	}
+	Broker struct {
+		Driver   string
+		Addr     string
+		Password string
+		DB       int
+		Prefix   string
+	}
+	Keys struct {
+		File    string
+		Active  string
+		Secrets map[string]string
+	}
+	SFU struct {
+		ICEServers []string
+	}
+	Metrics struct {
+		Addr string // Prometheus 指标的独立监听地址，为空时不提供指标
+	}
+	Schedule struct {
+		EarlyJoinMinutes int // 预约会议开始前允许提前加入的分钟数
+	}
 	Session struct {
 		SameSite     string
 		SameSiteMode http.SameSite
 		Secure       bool
 	}
+	Auth struct {
+		// 启用的登录方式：passport（第三方授权）、password（本地账号密码）、email（邮箱验证码）
+		Methods []string
+		// 是否允许注册本地账号，邮箱验证码登录时自动注册
+		Registration bool
+		// 邮箱验证码的有效分钟数
+		CodeMinutes int
+	}
+	Mailer struct {
+		Driver   string // log、file 或 smtp
+		Dir      string // file 驱动写入邮件的目录
+		Host     string
+		Port     int
+		Username string
+		Password string
+		From     string
+	}
+	Webhook struct {
+		Timeout       int // 单次投递的超时秒数
+		MaxAttempts   int // 失败后最多投递的次数
+		RetentionDays int // 投递记录保留的天数
+		// AllowPrivate 允许投递到回环、内网和链路本地地址，只应在可信的内网部署中开启
+		AllowPrivate bool
+	}
+	Recording struct {
+		Dir string // 录制文件的存储目录，多节点部署时应使用共享存储
+	}
+	Upload struct {
+		Dir         string // 聊天文件的存储目录，多节点部署时应使用共享存储
+		MaxFileMB   int64  // 单个文件的大小上限
+		RoomQuotaMB int64  // 每个房间未过期文件的总大小上限
+		ExpireHours int    // 文件上传后保留的小时数，未完成的上传同样到期删除
+	}
 	Passport struct {
 		URL          string
 		ClientId     string
@@ -35,25 +101,109 @@ type TomlConfig struct {
 		Scope        []string
 		GrantType    string
 	}
+	// OIDC 标准 OpenID Connect 登录，键为登录地址中的 provider 参数
+	OIDC map[string]OIDCProvider
+}
+
+// OIDCProvider configures an OpenID Connect identity provider
+type OIDCProvider struct {
+	Name         string // 登录按钮显示的名称
+	Issuer       string // 通过 Issuer + /.well-known/openid-configuration 发现端点
+	ClientId     string
+	ClientSecret string
+	RedirectURI  string
+	Scopes       []string
+	// Claims 用户字段对应的 claim 名称，为空时使用标准 claim
+	Claims struct {
+		Name   string
+		Email  string
+		Avatar string
+	}
 }
 
 func InitializeConfig(filepath string) {
 	configOnce.Do(func() {
-		if _, err := toml.DecodeFile(filepath, &globalConfig); err != nil && !errors.Is(err, os.ErrNotExist) {
+		meta, err := toml.DecodeFile(filepath, &globalConfig)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
 			panic(err)
 		}
 
-		initializeWithDefaults()
+		initializeWithDefaults(meta)
 	})
 }
 
-func initializeWithDefaults() {
+// initializeWithDefaults fills in unset options, meta tells options explicitly set to zero apart from missing ones
+func initializeWithDefaults(meta toml.MetaData) {
 	if globalConfig.App.Port == 0 {
 		globalConfig.App.Port = 8080
 	}
+	if globalConfig.App.URL == "" {
+		globalConfig.App.URL = "http://localhost:5173"
+	}
+	if globalConfig.Database.Driver == "" {
+		globalConfig.Database.Driver = "mysql"
+	}
 	if globalConfig.Mysql.DSN == "" {
 		globalConfig.Mysql.DSN = "root:root@tcp(127.0.0.1:3306)/met?charset=utf8mb4&parseTime=True&loc=Local"
 	}
+	if globalConfig.Database.DSN == "" && globalConfig.Database.Driver == "mysql" {
+		globalConfig.Database.DSN = globalConfig.Mysql.DSN
+	}
+	// 以下选项允许配置为 0，只在未配置时使用默认值
+	if !meta.IsDefined("App", "DrainSeconds") {
+		globalConfig.App.DrainSeconds = 30
+	}
+	if !meta.IsDefined("App", "ResumeSeconds") {
+		globalConfig.App.ResumeSeconds = 30
+	}
+	if !meta.IsDefined("Schedule", "EarlyJoinMinutes") {
+		globalConfig.Schedule.EarlyJoinMinutes = 10
+	}
+	if !meta.IsDefined("Metrics", "Addr") {
+		globalConfig.Metrics.Addr = "127.0.0.1:9100"
+	}
+	if globalConfig.Keys.File == "" && len(globalConfig.Keys.Secrets) == 0 {
+		globalConfig.Keys.File = "./keys.json"
+	}
+	if len(globalConfig.Auth.Methods) == 0 {
+		globalConfig.Auth.Methods = []string{"passport"}
+	}
+	if globalConfig.Auth.CodeMinutes == 0 {
+		globalConfig.Auth.CodeMinutes = 10
+	}
+	if globalConfig.Mailer.Driver == "" {
+		globalConfig.Mailer.Driver = "log"
+	}
+	if globalConfig.Webhook.Timeout == 0 {
+		globalConfig.Webhook.Timeout = 10
+	}
+	if globalConfig.Webhook.MaxAttempts == 0 {
+		globalConfig.Webhook.MaxAttempts = 6
+	}
+	if globalConfig.Webhook.RetentionDays == 0 {
+		globalConfig.Webhook.RetentionDays = 30
+	}
+	if globalConfig.Recording.Dir == "" {
+		globalConfig.Recording.Dir = "./storage/recordings"
+	}
+	if globalConfig.Upload.Dir == "" {
+		globalConfig.Upload.Dir = "./storage/uploads"
+	}
+	if globalConfig.Upload.MaxFileMB == 0 {
+		globalConfig.Upload.MaxFileMB = 100
+	}
+	if globalConfig.Upload.RoomQuotaMB == 0 {
+		globalConfig.Upload.RoomQuotaMB = 1024
+	}
+	if globalConfig.Upload.ExpireHours == 0 {
+		globalConfig.Upload.ExpireHours = 24
+	}
+	if globalConfig.Broker.Driver == "" {
+		globalConfig.Broker.Driver = "memory"
+	}
+	if globalConfig.Broker.Addr == "" {
+		globalConfig.Broker.Addr = "127.0.0.1:6379"
+	}
 	switch strings.ToLower(globalConfig.Session.SameSite) {
 	case "lax":
 		globalConfig.Session.SameSiteMode = http.SameSiteLaxMode
@@ -66,6 +216,22 @@ func initializeWithDefaults() {
 	}
 }
 
+// AuthEnabled reports whether the login method is listed in Auth.Methods
+func (c TomlConfig) AuthEnabled(method string) bool {
+	for _, m := range c.Auth.Methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// Use replaces the loaded config, tests use it to enable the options they cover
+func Use(c TomlConfig) {
+	configOnce.Do(func() {})
+	globalConfig = c
+}
+
 func GetConfig() TomlConfig {
 	return globalConfig
 }
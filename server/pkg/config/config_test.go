@@ -0,0 +1,34 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+func TestDefaultDSN(t *testing.T) {
+	globalConfig = TomlConfig{}
+	meta, err := toml.Decode("", &globalConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	initializeWithDefaults(meta)
+
+	want := "root:root@tcp(127.0.0.1:3306)/met?charset=utf8mb4&parseTime=True&loc=Local"
+	if globalConfig.Database.Driver != "mysql" || globalConfig.Database.DSN != want {
+		t.Fatalf("database = %s %q, want mysql %q", globalConfig.Database.Driver, globalConfig.Database.DSN, want)
+	}
+}
+
+func TestMysqlDSNKeptForExistingDeployments(t *testing.T) {
+	globalConfig = TomlConfig{}
+	meta, err := toml.Decode("[Mysql]\nDSN = \"u:p@tcp(db:3306)/met\"\n", &globalConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	initializeWithDefaults(meta)
+
+	if globalConfig.Database.DSN != "u:p@tcp(db:3306)/met" {
+		t.Fatalf("dsn = %q, want the Mysql.DSN", globalConfig.Database.DSN)
+	}
+}
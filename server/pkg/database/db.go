@@ -2,22 +2,49 @@ package database
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"meeting/pkg/config"
 	"os"
 	"sync"
 	"time"
 
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
+// 支持的数据库驱动
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// mysqlTableOptions 让 MySQL 建表时使用 utf8mb4，其他数据库默认即为 UTF-8
+const mysqlTableOptions = "ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci"
+
 // 保持向后兼容的全局变量和函数
 var globalDB *gorm.DB
 var once sync.Once
 
-func initMysql() {
+// dialector returns the gorm dialector of the configured driver
+func dialector(driver, dsn string) (gorm.Dialector, error) {
+	switch driver {
+	case DriverMySQL:
+		return mysql.Open(dsn), nil
+	case DriverPostgres:
+		return postgres.Open(dsn), nil
+	case DriverSQLite:
+		return sqlite.Open(dsn), nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+}
+
+func initDB() {
 	newLogger := logger.New(
 		log.New(os.Stdout, "\r\n", log.LstdFlags),
 		logger.Config{
@@ -27,18 +54,44 @@ func initMysql() {
 			Colorful:                  false,       // 禁用彩色打印
 		},
 	)
-	var err error
-	if globalDB, err = gorm.Open(mysql.Open(config.GetConfig().Mysql.DSN), &gorm.Config{
+	cfg := config.GetConfig().Database
+	d, err := dialector(cfg.Driver, cfg.DSN)
+	if err != nil {
+		panic(err)
+	}
+	if globalDB, err = gorm.Open(d, &gorm.Config{
 		Logger: newLogger,
 	}); err != nil {
 		panic(err)
 	}
+
+	if cfg.Driver == DriverSQLite {
+		// SQLite 只允许一个写连接，并发写入时等待而不是立即返回 SQLITE_BUSY
+		if sqlDB, err := globalDB.DB(); err == nil {
+			sqlDB.SetMaxOpenConns(1)
+		}
+	}
 }
 
 func InitializeDB() {
-	once.Do(initMysql)
+	once.Do(initDB)
+}
+
+// UseDB replaces the configured database, tests use it with an in-memory SQLite database
+func UseDB(db *gorm.DB) {
+	once.Do(func() {})
+	globalDB = db
 }
 
 func DB(ctx context.Context) *gorm.DB {
 	return globalDB.WithContext(ctx)
 }
+
+// TableOptions returns db with the table options of its dialect, use it when creating tables
+func TableOptions(db *gorm.DB) *gorm.DB {
+	if db.Dialector.Name() == DriverMySQL {
+		return db.Set("gorm:table_options", mysqlTableOptions)
+	}
+
+	return db
+}
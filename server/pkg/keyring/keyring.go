@@ -0,0 +1,266 @@
+package keyring
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"meeting/pkg/config"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrNoActiveKey = errors.New("no active signing key")
+
+// Key is a secret used to sign join credentials and session cookies
+type Key struct {
+	Id        string    `json:"id"`
+	Secret    string    `json:"secret"`
+	CreatedAt time.Time `json:"createdAt"`
+	// ExpiresAt is set when the key is retired, signatures made with it are accepted until then
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// KeyRing holds the active key and the retired keys still accepted during rotation
+type KeyRing struct {
+	Active string `json:"active"`
+	Keys   []*Key `json:"keys"`
+}
+
+// Bytes returns the raw secret
+func (k *Key) Bytes() []byte {
+	return []byte(k.Secret)
+}
+
+// Derive returns a sub key dedicated to purpose, so the same secret is never reused across usages
+func (k *Key) Derive(purpose string) []byte {
+	h := hmac.New(sha256.New, k.Bytes())
+	h.Write([]byte(purpose))
+	return h.Sum(nil)
+}
+
+func (k *Key) expired(now time.Time) bool {
+	return k.ExpiresAt != nil && now.After(*k.ExpiresAt)
+}
+
+// NewKey generates a random key
+func NewKey() (*Key, error) {
+	id := make([]byte, 6)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		Id:        base64.RawURLEncoding.EncodeToString(id),
+		Secret:    base64.RawURLEncoding.EncodeToString(secret),
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// Load reads a key ring from a json file
+func Load(path string) (*KeyRing, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var k KeyRing
+	if err = json.Unmarshal(b, &k); err != nil {
+		return nil, err
+	}
+
+	return &k, nil
+}
+
+// Save writes the key ring to a json file readable only by the owner
+func (k *KeyRing) Save(path string) error {
+	b, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, b, 0600)
+}
+
+// ActiveKey returns the key used for new signatures
+func (k *KeyRing) ActiveKey() *Key {
+	for _, key := range k.Keys {
+		if key.Id == k.Active {
+			return key
+		}
+	}
+
+	return nil
+}
+
+// Find returns a key that is still accepted for verification
+func (k *KeyRing) Find(id string) *Key {
+	now := time.Now()
+	for _, key := range k.Keys {
+		if key.Id == id && !key.expired(now) {
+			return key
+		}
+	}
+
+	return nil
+}
+
+// Valid returns the keys accepted for verification, the active key first
+func (k *KeyRing) Valid() []*Key {
+	now := time.Now()
+	keys := make([]*Key, 0, len(k.Keys))
+	for _, key := range k.Keys {
+		if !key.expired(now) {
+			keys = append(keys, key)
+		}
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].Id == k.Active && keys[j].Id != k.Active
+	})
+
+	return keys
+}
+
+// Rotate makes a new key active, retires the previous one after grace and drops expired keys
+func (k *KeyRing) Rotate(grace time.Duration) (*Key, error) {
+	key, err := NewKey()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if active := k.ActiveKey(); active != nil && active.ExpiresAt == nil {
+		expiresAt := now.Add(grace)
+		active.ExpiresAt = &expiresAt
+	}
+	keys := make([]*Key, 0, len(k.Keys)+1)
+	for _, old := range k.Keys {
+		if !old.expired(now) {
+			keys = append(keys, old)
+		}
+	}
+	k.Keys = append(keys, key)
+	k.Active = key.Id
+
+	return key, nil
+}
+
+var (
+	globalKeyRing *KeyRing
+	modTime       time.Time
+	mu            sync.RWMutex
+	once          sync.Once
+)
+
+// reloadInterval controls how often the key file is checked for rotations
+const reloadInterval = 30 * time.Second
+
+func initKeyRing() {
+	c := config.GetConfig().Keys
+	k, err := loadFile(c.File)
+	if err != nil {
+		panic(err)
+	}
+
+	mergeConfig(k)
+	if k.ActiveKey() == nil {
+		panic(ErrNoActiveKey)
+	}
+
+	globalKeyRing = k
+	if c.File != "" {
+		go watch(c.File)
+	}
+}
+
+// mergeConfig adds the keys of config.toml to the key ring, its active key is used
+// only when the key file has none
+func mergeConfig(k *KeyRing) {
+	c := config.GetConfig().Keys
+	if c.Active != "" && k.ActiveKey() == nil {
+		k.Active = c.Active
+	}
+	for id, secret := range c.Secrets {
+		k.Keys = append(k.Keys, &Key{Id: id, Secret: secret})
+	}
+}
+
+// loadFile loads the key file, creating it with a fresh key on first start
+func loadFile(path string) (*KeyRing, error) {
+	if path == "" {
+		return &KeyRing{}, nil
+	}
+	k, err := Load(path)
+	if errors.Is(err, os.ErrNotExist) {
+		k = &KeyRing{}
+		if _, err = k.Rotate(0); err != nil {
+			return nil, err
+		}
+		log.Printf("signing key file %s not found, generated a new one", path)
+		err = k.Save(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime()
+	}
+
+	return k, nil
+}
+
+// watch reloads the key file when it is rotated by `met keys rotate`
+func watch(path string) {
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		info, err := os.Stat(path)
+		if err != nil || !info.ModTime().After(modTime) {
+			continue
+		}
+		k, err := Load(path)
+		if err != nil {
+			log.Printf("reload signing key file %s error: %v", path, err)
+			continue
+		}
+
+		mergeConfig(k)
+		if k.ActiveKey() == nil {
+			log.Printf("reload signing key file %s error: %v", path, ErrNoActiveKey)
+			continue
+		}
+		mu.Lock()
+		globalKeyRing = k
+		modTime = info.ModTime()
+		mu.Unlock()
+		log.Printf("signing keys reloaded, active key %s", k.Active)
+	}
+}
+
+func InitializeKeyRing() {
+	once.Do(initKeyRing)
+}
+
+// Use replaces the configured key ring, tests use it to sign with known keys
+func Use(k *KeyRing) {
+	once.Do(func() {})
+	mu.Lock()
+	globalKeyRing = k
+	mu.Unlock()
+}
+
+// Default returns the key ring configured for this server
+func Default() *KeyRing {
+	InitializeKeyRing()
+	mu.RLock()
+	defer mu.RUnlock()
+	return globalKeyRing
+}
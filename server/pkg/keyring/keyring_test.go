@@ -0,0 +1,108 @@
+package keyring
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotateRetiresThePreviousKey(t *testing.T) {
+	k := &KeyRing{}
+	first, err := k.Rotate(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.ActiveKey() != first || first.ExpiresAt != nil {
+		t.Fatal("first key is not active without expiry")
+	}
+
+	second, err := k.Rotate(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.ActiveKey() != second || second.ExpiresAt != nil {
+		t.Fatal("rotated key is not active without expiry")
+	}
+	if first.ExpiresAt == nil || time.Until(*first.ExpiresAt) < 59*time.Minute {
+		t.Fatalf("retired key expires at %v, want in an hour", first.ExpiresAt)
+	}
+	// 退役的密钥在宽限期内仍可验证，但不再用于签名
+	if k.Find(first.Id) != first {
+		t.Fatal("retired key is not accepted during the grace period")
+	}
+	if valid := k.Valid(); len(valid) != 2 || valid[0] != second {
+		t.Fatalf("valid keys = %v, want the active key first", valid)
+	}
+
+	expired := time.Now().Add(-time.Second)
+	first.ExpiresAt = &expired
+	if k.Find(first.Id) != nil {
+		t.Fatal("expired key is accepted")
+	}
+	if valid := k.Valid(); len(valid) != 1 || valid[0] != second {
+		t.Fatalf("valid keys = %v, want only the active key", valid)
+	}
+
+	// 再次轮换时删除已过期的密钥
+	third, err := k.Rotate(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(k.Keys) != 2 || k.Keys[0] != second || k.Keys[1] != third {
+		t.Fatalf("keys after rotation = %v, want the retired and the new key", k.Keys)
+	}
+}
+
+func TestFindUnknownKey(t *testing.T) {
+	k := &KeyRing{}
+	if _, err := k.Rotate(0); err != nil {
+		t.Fatal(err)
+	}
+	if k.Find("unknown") != nil || k.Find("") != nil {
+		t.Fatal("unknown key id is accepted")
+	}
+}
+
+func TestDeriveSeparatesPurposes(t *testing.T) {
+	key, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(key.Derive("join-token"), key.Derive("session")) {
+		t.Fatal("sub keys of different purposes are equal")
+	}
+	if !bytes.Equal(key.Derive("join-token"), key.Derive("join-token")) {
+		t.Fatal("sub key is not stable")
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	k := &KeyRing{}
+	if _, err := k.Rotate(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.Rotate(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("key file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Active != k.Active || len(loaded.Keys) != 2 || loaded.Keys[0].ExpiresAt == nil {
+		t.Fatalf("loaded %+v, want %+v", loaded, k)
+	}
+}
@@ -0,0 +1,36 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9@._-]`)
+
+// FileMailer writes each email to a file in Dir, tests and offline deployments read them from there.
+type FileMailer struct {
+	Dir string
+}
+
+func NewFileMailer(dir string) *FileMailer {
+	if dir == "" {
+		dir = "./mail"
+	}
+	return &FileMailer{Dir: dir}
+}
+
+func (m *FileMailer) Send(_ context.Context, msg *Message) error {
+	if err := os.MkdirAll(m.Dir, 0o700); err != nil {
+		return err
+	}
+
+	// 同一收件人的邮件按时间排序
+	name := fmt.Sprintf("%s-%d.eml", unsafeFileChars.ReplaceAllString(msg.To, "_"), time.Now().UnixNano())
+	content := fmt.Sprintf("To: %s\r\nSubject: %s\r\nDate: %s\r\n\r\n%s\r\n", msg.To, msg.Subject, time.Now().Format(time.RFC1123Z), msg.Body)
+
+	return os.WriteFile(filepath.Join(m.Dir, name), []byte(content), 0o600)
+}
@@ -0,0 +1,18 @@
+package mailer
+
+import (
+	"context"
+	"log"
+)
+
+// LogMailer prints emails to the log instead of sending them, for development.
+type LogMailer struct{}
+
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+func (m *LogMailer) Send(_ context.Context, msg *Message) error {
+	log.Printf("mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
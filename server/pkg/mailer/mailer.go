@@ -0,0 +1,51 @@
+package mailer
+
+import (
+	"context"
+	"meeting/pkg/config"
+	"strings"
+	"sync"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails such as login codes.
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+var globalMailer Mailer
+var once sync.Once
+
+func initMailer() {
+	c := config.GetConfig().Mailer
+	switch strings.ToLower(c.Driver) {
+	case "smtp":
+		globalMailer = NewSMTPMailer(c.Host, c.Port, c.Username, c.Password, c.From)
+	case "file":
+		globalMailer = NewFileMailer(c.Dir)
+	default:
+		globalMailer = NewLogMailer()
+	}
+}
+
+func InitializeMailer() {
+	once.Do(initMailer)
+}
+
+// Use replaces the configured mailer, tests use it with a FileMailer to read the codes sent
+func Use(m Mailer) {
+	once.Do(func() {})
+	globalMailer = m
+}
+
+// Default returns the configured mailer, falling back to one that writes to the log.
+func Default() Mailer {
+	InitializeMailer()
+	return globalMailer
+}
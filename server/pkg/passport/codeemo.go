@@ -0,0 +1,125 @@
+package passport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"meeting/pkg/api"
+	"meeting/pkg/config"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// UserInfo is the user returned by the CodeEMO user info api
+type UserInfo struct {
+	Uuid            string
+	Name            string
+	Nickname        string
+	Gender          uint8
+	Email           string
+	EmailVerifiedAt time.Time
+	Avatar          string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// codeEMO logs in through the CodeEMO passport, it is not an OpenID provider
+type codeEMO struct {
+	url    string
+	oauth2 *oauth2.Config
+}
+
+func newCodeEMO() *codeEMO {
+	c := config.GetConfig().Passport
+	return &codeEMO{
+		url: c.URL,
+		oauth2: &oauth2.Config{
+			ClientID:     c.ClientId,
+			ClientSecret: c.ClientSecret,
+			Scopes:       c.Scope,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  c.URL + "/oauth/authorize",
+				TokenURL: c.URL + "/oauth/token",
+			},
+			RedirectURL: c.RedirectURI,
+		},
+	}
+}
+
+func (p *codeEMO) Id() string {
+	return CodeEMOId
+}
+
+func (p *codeEMO) Name() string {
+	return "CodeEMO"
+}
+
+func (p *codeEMO) AuthCodeURL(state, _ string) string {
+	return p.oauth2.AuthCodeURL(state, oauth2.AccessTypeOnline)
+}
+
+func (p *codeEMO) Exchange(ctx context.Context, code, _ string) (*Identity, error) {
+	token, err := p.oauth2.Exchange(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := p.userInfo(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if info.Uuid == "" {
+		return nil, errors.New("codeemo: user info without uuid")
+	}
+
+	// CodeEMO 的 uuid 就是已有用户的 uuid，邮箱由 CodeEMO 验证
+	return &Identity{
+		Provider:      CodeEMOId,
+		Subject:       info.Uuid,
+		Uuid:          info.Uuid,
+		Name:          info.Nickname,
+		Email:         info.Email,
+		EmailVerified: info.Email != "",
+		Avatar:        info.Avatar,
+	}, nil
+}
+
+func (p *codeEMO) userInfo(ctx context.Context, token *oauth2.Token) (*UserInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url+"/oauth/user/info", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Accept", "application/json")
+	token.SetAuthHeader(req)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("codeemo: user info status %d", res.StatusCode)
+	}
+
+	var response api.Response[*UserInfo]
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	if response.Data == nil {
+		return nil, fmt.Errorf("codeemo: user info failed: %s", response.Message)
+	}
+
+	return response.Data, nil
+}
+
+func (p *codeEMO) LogoutURL(_ context.Context, redirectURI string) string {
+	return p.url + "/logout?redirect_uri=" + url.QueryEscape(redirectURI)
+}
+
+func (p *codeEMO) UserCenterURL(redirectURI string) string {
+	return p.url + "/user/center?redirect_uri=" + url.QueryEscape(redirectURI)
+}
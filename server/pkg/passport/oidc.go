@@ -0,0 +1,208 @@
+package passport
+
+import (
+	"context"
+	"fmt"
+	"meeting/pkg/config"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// discoveryTimeout bounds fetching .well-known/openid-configuration
+const discoveryTimeout = 10 * time.Second
+
+// oidcProvider logs in through a standard OpenID Connect provider
+type oidcProvider struct {
+	id     string
+	config config.OIDCProvider
+
+	// 端点在首次使用时发现，发现失败时下次再试，启动时不依赖网络
+	mu         sync.Mutex
+	provider   *oidc.Provider
+	endSession string
+}
+
+func newOIDC(id string, c config.OIDCProvider) *oidcProvider {
+	if len(c.Scopes) == 0 {
+		c.Scopes = []string{oidc.ScopeOpenID, "profile", "email"}
+	}
+	if c.Claims.Name == "" {
+		c.Claims.Name = "name"
+	}
+	if c.Claims.Email == "" {
+		c.Claims.Email = "email"
+	}
+	if c.Claims.Avatar == "" {
+		c.Claims.Avatar = "picture"
+	}
+	if c.Name == "" {
+		c.Name = id
+	}
+
+	return &oidcProvider{id: id, config: c}
+}
+
+// discover loads the provider metadata from .well-known/openid-configuration
+func (p *oidcProvider) discover(ctx context.Context) (*oidc.Provider, error) {
+	p.mu.Lock()
+	provider := p.provider
+	p.mu.Unlock()
+	if provider != nil {
+		return provider, nil
+	}
+
+	// 网络请求不持有锁，并发的首次请求可能各自发现一次，只保留先完成的结果
+	ctx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+	provider, err := oidc.NewProvider(ctx, p.config.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("oidc %s: discovery: %w", p.id, err)
+	}
+	var metadata struct {
+		EndSessionEndpoint string `json:"end_session_endpoint"`
+	}
+	_ = provider.Claims(&metadata)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.provider == nil {
+		p.provider = provider
+		p.endSession = metadata.EndSessionEndpoint
+	}
+	return p.provider, nil
+}
+
+func (p *oidcProvider) oauth2Config(provider *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.config.ClientId,
+		ClientSecret: p.config.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  p.config.RedirectURI,
+		Scopes:       p.config.Scopes,
+	}
+}
+
+func (p *oidcProvider) Id() string {
+	return p.id
+}
+
+func (p *oidcProvider) Name() string {
+	return p.config.Name
+}
+
+func (p *oidcProvider) AuthCodeURL(state, nonce string) string {
+	provider, err := p.discover(context.Background())
+	if err != nil {
+		return ""
+	}
+
+	return p.oauth2Config(provider).AuthCodeURL(state, oidc.Nonce(nonce))
+}
+
+func (p *oidcProvider) Exchange(ctx context.Context, code, nonce string) (*Identity, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	oauth2Config := p.oauth2Config(provider)
+	token, err := oauth2Config.Exchange(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("oidc %s: token response without id_token", p.id)
+	}
+
+	// 校验签名、issuer、audience 和有效期
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.config.ClientId}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("oidc %s: %w", p.id, err)
+	}
+	if nonce == "" || idToken.Nonce != nonce {
+		return nil, fmt.Errorf("oidc %s: nonce mismatch", p.id)
+	}
+	if idToken.Subject == "" {
+		return nil, fmt.Errorf("oidc %s: id token without subject", p.id)
+	}
+
+	claims := map[string]any{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+	// ID token 中缺少的资料从 userinfo 端点补充
+	if provider.UserInfoEndpoint() != "" {
+		if info, err := provider.UserInfo(ctx, oauth2Config.TokenSource(ctx, token)); err == nil && info.Subject == idToken.Subject {
+			extra := map[string]any{}
+			if err := info.Claims(&extra); err == nil {
+				for k, v := range extra {
+					if _, ok := claims[k]; !ok {
+						claims[k] = v
+					}
+				}
+			}
+		}
+	}
+
+	// 服务没有声明 email_verified 时邮箱视为未验证
+	return &Identity{
+		Provider:      p.id,
+		Subject:       idToken.Subject,
+		Name:          claimString(claims, p.config.Claims.Name),
+		Email:         claimString(claims, p.config.Claims.Email),
+		EmailVerified: claimBool(claims, "email_verified"),
+		Avatar:        claimString(claims, p.config.Claims.Avatar),
+	}, nil
+}
+
+// LogoutURL uses RP-initiated logout when the provider advertises an end_session_endpoint
+func (p *oidcProvider) LogoutURL(ctx context.Context, redirectURI string) string {
+	if _, err := p.discover(ctx); err != nil {
+		return ""
+	}
+	p.mu.Lock()
+	endSession := p.endSession
+	p.mu.Unlock()
+	if endSession == "" {
+		return ""
+	}
+
+	u, err := url.Parse(endSession)
+	if err != nil {
+		return ""
+	}
+	q := u.Query()
+	q.Set("client_id", p.config.ClientId)
+	q.Set("post_logout_redirect_uri", redirectURI)
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+func (p *oidcProvider) UserCenterURL(string) string {
+	return ""
+}
+
+func claimString(claims map[string]any, name string) string {
+	if s, ok := claims[name].(string); ok {
+		return s
+	}
+	return ""
+}
+
+// claimBool also accepts the "true" strings sent by some providers
+func claimBool(claims map[string]any, name string) bool {
+	switch v := claims[name].(type) {
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(v, "true")
+	}
+	return false
+}
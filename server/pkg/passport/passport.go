@@ -0,0 +1,97 @@
+package passport
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"log"
+	"meeting/pkg/config"
+	"sort"
+	"sync"
+)
+
+// CodeEMOId is the provider id of the CodeEMO passport configured in [Passport]
+const CodeEMOId = "codeemo"
+
+// Identity is the user returned by a provider after a successful login.
+type Identity struct {
+	Provider string
+	// Subject is the stable id of the user at the provider
+	Subject string
+	// Uuid is set by providers whose subject is also the uuid of existing users
+	Uuid   string
+	Name   string
+	Email  string
+	Avatar string
+	// EmailVerified reports whether the provider confirmed the user owns Email
+	EmailVerified bool
+}
+
+// Provider is an external identity provider using the authorization code flow.
+type Provider interface {
+	Id() string
+	Name() string
+	// AuthCodeURL returns the login page of the provider, nonce is bound to the id token when supported
+	AuthCodeURL(state, nonce string) string
+	// Exchange redeems the authorization code and returns the logged in user
+	Exchange(ctx context.Context, code, nonce string) (*Identity, error)
+	// LogoutURL returns the url ending the session at the provider, empty when not supported
+	LogoutURL(ctx context.Context, redirectURI string) string
+	// UserCenterURL returns the profile page of the provider, empty when not supported
+	UserCenterURL(redirectURI string) string
+}
+
+var (
+	providers []Provider
+	once      sync.Once
+)
+
+func initPassport() {
+	c := config.GetConfig()
+	if c.Passport.URL != "" && c.Passport.ClientId != "" {
+		providers = append(providers, newCodeEMO())
+	}
+
+	ids := make([]string, 0, len(c.OIDC))
+	for id := range c.OIDC {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		p := c.OIDC[id]
+		if id == CodeEMOId || p.Issuer == "" || p.ClientId == "" {
+			log.Printf("oidc provider %s is invalid, skipped", id)
+			continue
+		}
+		providers = append(providers, newOIDC(id, p))
+	}
+}
+
+func InitializePassport() {
+	once.Do(initPassport)
+}
+
+// Providers returns the configured providers, CodeEMO first and the OIDC providers sorted by id
+func Providers() []Provider {
+	InitializePassport()
+	return providers
+}
+
+// Find returns the provider with the id, an empty id selects the first provider
+func Find(id string) Provider {
+	for _, p := range Providers() {
+		if id == "" || p.Id() == id {
+			return p
+		}
+	}
+	return nil
+}
+
+// RandomString returns a url safe random string used as state and nonce
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,189 @@
+// Package webm writes a single video track to a WebM file.
+//
+// The segment and clusters are written with an unknown size, like the files
+// produced by MediaRecorder, so frames can be streamed to disk without seeking.
+// Players handle such files but cannot seek until they are remuxed.
+package webm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// CodecVP8 is the codec id of VP8 video
+const CodecVP8 = "V_VP8"
+
+// EBML element ids
+const (
+	idEBML               = 0x1A45DFA3
+	idEBMLVersion        = 0x4286
+	idEBMLReadVersion    = 0x42F7
+	idEBMLMaxIDLength    = 0x42F2
+	idEBMLMaxSizeLength  = 0x42F3
+	idDocType            = 0x4282
+	idDocTypeVersion     = 0x4287
+	idDocTypeReadVersion = 0x4285
+	idSegment            = 0x18538067
+	idInfo               = 0x1549A966
+	idTimecodeScale      = 0x2AD7B1
+	idMuxingApp          = 0x4D80
+	idWritingApp         = 0x5741
+	idTracks             = 0x1654AE6B
+	idTrackEntry         = 0xAE
+	idTrackNumber        = 0xD7
+	idTrackUID           = 0x73C5
+	idTrackType          = 0x83
+	idCodecID            = 0x86
+	idVideo              = 0xE0
+	idPixelWidth         = 0xB0
+	idPixelHeight        = 0xBA
+	idCluster            = 0x1F43B675
+	idTimecode           = 0xE7
+	idSimpleBlock        = 0xA3
+)
+
+const (
+	// unknownSize marks a master element whose size is not known in advance
+	unknownSize = 0x01FFFFFFFFFFFFFF
+	// clusterDuration is the minimum length of a cluster, a new cluster starts at the next keyframe
+	clusterDuration = 5 * time.Second
+	// maxBlockOffset keeps the relative timecode of a block within int16 milliseconds
+	maxBlockOffset = 30 * time.Second
+)
+
+var ErrNegativeTimestamp = errors.New("webm: timestamp is before the previous cluster")
+
+// Writer writes the frames of one video track
+type Writer struct {
+	w io.Writer
+	// cluster is the timestamp of the open cluster, -1 before the first frame
+	cluster time.Duration
+}
+
+// NewWriter writes the header of a WebM file holding one video track of the given codec and size
+func NewWriter(w io.Writer, codec string, width, height int) (*Writer, error) {
+	var header bytes.Buffer
+	writeMaster(&header, idEBML, func(b *bytes.Buffer) {
+		writeUint(b, idEBMLVersion, 1)
+		writeUint(b, idEBMLReadVersion, 1)
+		writeUint(b, idEBMLMaxIDLength, 4)
+		writeUint(b, idEBMLMaxSizeLength, 8)
+		writeString(b, idDocType, "webm")
+		writeUint(b, idDocTypeVersion, 4)
+		writeUint(b, idDocTypeReadVersion, 2)
+	})
+	writeID(&header, idSegment)
+	writeSize(&header, unknownSize)
+	writeMaster(&header, idInfo, func(b *bytes.Buffer) {
+		// 时间单位为毫秒
+		writeUint(b, idTimecodeScale, uint64(time.Millisecond))
+		writeString(b, idMuxingApp, "met")
+		writeString(b, idWritingApp, "met")
+	})
+	writeMaster(&header, idTracks, func(b *bytes.Buffer) {
+		writeMaster(b, idTrackEntry, func(b *bytes.Buffer) {
+			writeUint(b, idTrackNumber, 1)
+			writeUint(b, idTrackUID, 1)
+			writeUint(b, idTrackType, 1)
+			writeString(b, idCodecID, codec)
+			writeMaster(b, idVideo, func(b *bytes.Buffer) {
+				writeUint(b, idPixelWidth, uint64(width))
+				writeUint(b, idPixelHeight, uint64(height))
+			})
+		})
+	})
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return nil, err
+	}
+
+	return &Writer{w: w, cluster: -1}, nil
+}
+
+// WriteFrame appends a frame presented at timestamp, measured from the start of the file
+func (w *Writer) WriteFrame(keyframe bool, timestamp time.Duration, frame []byte) error {
+	var b bytes.Buffer
+	if w.cluster < 0 || timestamp-w.cluster >= maxBlockOffset || (keyframe && timestamp-w.cluster >= clusterDuration) {
+		writeID(&b, idCluster)
+		writeSize(&b, unknownSize)
+		writeUint(&b, idTimecode, uint64(timestamp.Milliseconds()))
+		w.cluster = timestamp
+	}
+	offset := (timestamp - w.cluster).Milliseconds()
+	if offset < 0 {
+		return ErrNegativeTimestamp
+	}
+
+	writeID(&b, idSimpleBlock)
+	writeSize(&b, uint64(4+len(frame)))
+	// track number 为 1 的 vint 编码
+	b.WriteByte(0x81)
+	_ = binary.Write(&b, binary.BigEndian, int16(offset))
+	var flags byte
+	if keyframe {
+		flags |= 0x80
+	}
+	b.WriteByte(flags)
+	b.Write(frame)
+
+	_, err := w.w.Write(b.Bytes())
+	return err
+}
+
+func writeID(b *bytes.Buffer, id uint32) {
+	switch {
+	case id > 0xFFFFFF:
+		b.Write([]byte{byte(id >> 24), byte(id >> 16), byte(id >> 8), byte(id)})
+	case id > 0xFFFF:
+		b.Write([]byte{byte(id >> 16), byte(id >> 8), byte(id)})
+	case id > 0xFF:
+		b.Write([]byte{byte(id >> 8), byte(id)})
+	default:
+		b.WriteByte(byte(id))
+	}
+}
+
+// writeSize encodes a size as a variable length integer
+func writeSize(b *bytes.Buffer, size uint64) {
+	if size == unknownSize {
+		b.Write([]byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF})
+		return
+	}
+	n := 1
+	// 全 1 的值保留为未知大小
+	for n < 8 && size >= 1<<(7*n)-1 {
+		n++
+	}
+	v := size | 1<<(7*n)
+	for i := n - 1; i >= 0; i-- {
+		b.WriteByte(byte(v >> (8 * i)))
+	}
+}
+
+func writeUint(b *bytes.Buffer, id uint32, v uint64) {
+	n := 1
+	for n < 8 && v >= 1<<(8*n) {
+		n++
+	}
+	writeID(b, id)
+	writeSize(b, uint64(n))
+	for i := n - 1; i >= 0; i-- {
+		b.WriteByte(byte(v >> (8 * i)))
+	}
+}
+
+func writeString(b *bytes.Buffer, id uint32, s string) {
+	writeID(b, id)
+	writeSize(b, uint64(len(s)))
+	b.WriteString(s)
+}
+
+func writeMaster(b *bytes.Buffer, id uint32, children func(b *bytes.Buffer)) {
+	var body bytes.Buffer
+	children(&body)
+	writeID(b, id)
+	writeSize(b, uint64(body.Len()))
+	b.Write(body.Bytes())
+}
@@ -0,0 +1,173 @@
+package webm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+// parsed is the content of a file read back by parse
+type parsed struct {
+	docType  string
+	codec    string
+	width    uint64
+	height   uint64
+	clusters []time.Duration
+	blocks   []block
+}
+
+type block struct {
+	keyframe  bool
+	timestamp time.Duration
+	frame     []byte
+}
+
+// parse reads the elements written by Writer, master elements are entered and leaves decoded
+func parse(t *testing.T, data []byte) *parsed {
+	t.Helper()
+	masters := map[uint32]bool{
+		idEBML: true, idSegment: true, idInfo: true, idTracks: true,
+		idTrackEntry: true, idVideo: true, idCluster: true,
+	}
+	p := &parsed{}
+	var cluster time.Duration
+	for len(data) > 0 {
+		id, n := readVint(t, data, false)
+		data = data[n:]
+		size, n := readVint(t, data, true)
+		data = data[n:]
+		if masters[uint32(id)] {
+			continue
+		}
+		if size > uint64(len(data)) {
+			t.Fatalf("element %x of %d bytes overflows the file", id, size)
+		}
+		body := data[:size]
+		data = data[size:]
+
+		switch uint32(id) {
+		case idDocType:
+			p.docType = string(body)
+		case idCodecID:
+			p.codec = string(body)
+		case idPixelWidth:
+			p.width = readUint(body)
+		case idPixelHeight:
+			p.height = readUint(body)
+		case idTimecode:
+			cluster = time.Duration(readUint(body)) * time.Millisecond
+			p.clusters = append(p.clusters, cluster)
+		case idSimpleBlock:
+			if body[0] != 0x81 {
+				t.Fatalf("block of track %x", body[0])
+			}
+			offset := int16(binary.BigEndian.Uint16(body[1:3]))
+			p.blocks = append(p.blocks, block{
+				keyframe:  body[3]&0x80 != 0,
+				timestamp: cluster + time.Duration(offset)*time.Millisecond,
+				frame:     body[4:],
+			})
+		}
+	}
+
+	return p
+}
+
+// readVint decodes an EBML variable length integer, ids keep their length marker
+func readVint(t *testing.T, data []byte, size bool) (uint64, int) {
+	t.Helper()
+	if len(data) == 0 || data[0] == 0 {
+		t.Fatal("invalid variable length integer")
+	}
+	n := 1
+	for data[0]&(0x80>>(n-1)) == 0 {
+		n++
+	}
+	if len(data) < n {
+		t.Fatal("truncated variable length integer")
+	}
+	v := uint64(data[0])
+	if size {
+		v &= uint64(0xFF >> n)
+	}
+	for i := 1; i < n; i++ {
+		v = v<<8 | uint64(data[i])
+	}
+	if size && v == 1<<(7*n)-1 {
+		return unknownSize, n
+	}
+	return v, n
+}
+
+func readUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	var out bytes.Buffer
+	w, err := NewWriter(&out, CodecVP8, 1280, 720)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frames := []block{
+		{keyframe: true, timestamp: 0, frame: []byte{1, 2, 3}},
+		{timestamp: 33 * time.Millisecond, frame: []byte{4}},
+		// 4+123 字节正好是 1 字节长度的保留值，需要用 2 字节编码
+		{timestamp: 66 * time.Millisecond, frame: bytes.Repeat([]byte{5}, 123)},
+		// 距离簇开始不足 clusterDuration 的关键帧不开始新簇
+		{keyframe: true, timestamp: 2 * time.Second, frame: []byte{6}},
+		{keyframe: true, timestamp: 5100 * time.Millisecond, frame: []byte{7}},
+		{timestamp: 6 * time.Second, frame: bytes.Repeat([]byte{8}, 5000)},
+		// 没有关键帧时超过 maxBlockOffset 也要开始新簇
+		{timestamp: 40 * time.Second, frame: []byte{9}},
+	}
+	for _, f := range frames {
+		if err := w.WriteFrame(f.keyframe, f.timestamp, f.frame); err != nil {
+			t.Fatalf("write frame at %s: %v", f.timestamp, err)
+		}
+	}
+
+	p := parse(t, out.Bytes())
+	if p.docType != "webm" || p.codec != CodecVP8 || p.width != 1280 || p.height != 720 {
+		t.Fatalf("header = %q %q %dx%d", p.docType, p.codec, p.width, p.height)
+	}
+	want := []time.Duration{0, 5100 * time.Millisecond, 40 * time.Second}
+	if len(p.clusters) != len(want) {
+		t.Fatalf("clusters = %v, want %v", p.clusters, want)
+	}
+	for i := range want {
+		if p.clusters[i] != want[i] {
+			t.Fatalf("clusters = %v, want %v", p.clusters, want)
+		}
+	}
+	if len(p.blocks) != len(frames) {
+		t.Fatalf("read %d blocks, want %d", len(p.blocks), len(frames))
+	}
+	for i, f := range frames {
+		b := p.blocks[i]
+		if b.keyframe != f.keyframe || b.timestamp != f.timestamp || !bytes.Equal(b.frame, f.frame) {
+			t.Fatalf("block %d = key %v at %s (%d bytes), want key %v at %s (%d bytes)",
+				i, b.keyframe, b.timestamp, len(b.frame), f.keyframe, f.timestamp, len(f.frame))
+		}
+	}
+}
+
+func TestWriterRejectsNegativeOffset(t *testing.T) {
+	w, err := NewWriter(&bytes.Buffer{}, CodecVP8, 640, 480)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFrame(true, 10*time.Second, []byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFrame(false, 9*time.Second, []byte{2}); !errors.Is(err, ErrNegativeTimestamp) {
+		t.Fatalf("err = %v, want ErrNegativeTimestamp", err)
+	}
+}
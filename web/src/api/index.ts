@@ -1,4 +1,7 @@
 import axios from 'axios'
+import { apiUrl } from '@/config'
+import type { CreateInviteRequest, CreateWebhookRequest, UpdateWebhookRequest } from '@/types/room'
+import type { CreateTokenRequest } from '@/types/user'
 
 export function login() {
   return axios.get('/api/login')
@@ -8,6 +11,36 @@ export function getUserInfo() {
   return axios.get('/api/info')
 }
 
+// 服务端启用的登录方式
+export function getAuthMethods() {
+  return axios.get('/api/auth/methods')
+}
+
+// 注册本地账号，成功后自动登录
+export function register(data: { username: string; name?: string; email?: string; password: string }) {
+  return axios.post('/api/auth/register', data)
+}
+
+// 使用用户名或已验证的邮箱和密码登录
+export function loginWithPassword(data: { username: string; password: string }) {
+  return axios.post('/api/auth/login', data)
+}
+
+// 发送邮箱登录验证码
+export function sendLoginCode(data: { email: string }) {
+  return axios.post('/api/auth/email/code', data)
+}
+
+// 使用邮箱验证码登录，未注册的邮箱自动注册
+export function loginWithEmailCode(data: { email: string; code: string }) {
+  return axios.post('/api/auth/email/login', data)
+}
+
+// 使用发送到注册邮箱的验证码确认邮箱，验证前邮箱不能用于登录
+export function verifyEmail(data: { code: string }) {
+  return axios.post('/api/auth/email/verify', data)
+}
+
 export function generateSignature(params: any) {
   return axios.get('/api/signature', { params })
 }
@@ -16,6 +49,11 @@ export function getMinitorData() {
   return axios.get('/api/monitoring')
 }
 
+// 监控事件流，连接建立后先收到 snapshot 事件
+export function openMonitoringEvents() {
+  return new EventSource(`${apiUrl}/api/monitoring/events`, { withCredentials: true })
+}
+
 export function getRoomInfo(id: string) {
   return axios.get(`/api/room/${id}`)
 }
@@ -36,10 +74,20 @@ export function deleteRoom(uuid: string) {
 }
 
 // 加入房间
-export function joinRoom(uuid: string, data: { password?: string }) {
+export function joinRoom(uuid: string, data: { password?: string; code?: string }) {
   return axios.post(`/api/rooms/${uuid}/join`, data)
 }
 
+// 获取邀请码和邀请链接（主持人）
+export function getInviteCode(uuid: string) {
+  return axios.get(`/api/rooms/${uuid}/invite-code`)
+}
+
+// 重置邀请码，之前分享的链接失效
+export function resetInviteCode(uuid: string) {
+  return axios.post(`/api/rooms/${uuid}/invite-code`)
+}
+
 // 更新房间信息
 export function updateRoom(uuid: string, data: { name?: string; password?: string }) {
   return axios.put(`/api/rooms/${uuid}/update`, data)
@@ -55,7 +103,131 @@ export function blockUser(uuid: string, data: { userId: number }) {
   return axios.post(`/api/rooms/${uuid}/block`, data)
 }
 
+// 设置成员角色
+export function updateMemberRole(uuid: string, userId: number, role: string) {
+  return axios.put(`/api/rooms/${uuid}/members/${userId}/role`, { role })
+}
+
 // 获取房间成员
 export function getRoomMembers(uuid: string) {
   return axios.get(`/api/rooms/${uuid}/members`)
-}
\ No newline at end of file
+}
+
+// 获取邀请链接
+export function getInvites(uuid: string) {
+  return axios.get(`/api/rooms/${uuid}/invites`)
+}
+
+// 创建邀请链接
+export function createInvite(uuid: string, data: CreateInviteRequest) {
+  return axios.post(`/api/rooms/${uuid}/invites`, data)
+}
+
+// 撤销邀请链接
+export function revokeInvite(uuid: string, code: string) {
+  return axios.delete(`/api/rooms/${uuid}/invites/${code}`)
+}
+
+// 兑换邀请链接，成为房间成员
+export function redeemInvite(code: string) {
+  return axios.post(`/api/invites/${code}/redeem`)
+}
+
+// 获取个人令牌
+export function getTokens() {
+  return axios.get('/api/tokens')
+}
+
+// 创建个人令牌，返回的令牌明文只显示一次
+export function createToken(data: CreateTokenRequest) {
+  return axios.post('/api/tokens', data)
+}
+
+// 撤销个人令牌
+export function revokeToken(id: number) {
+  return axios.delete(`/api/tokens/${id}`)
+}
+
+// 获取服务账号
+export function getServiceAccounts() {
+  return axios.get('/api/service-accounts')
+}
+
+// 创建服务账号
+export function createServiceAccount(name: string) {
+  return axios.post('/api/service-accounts', { name })
+}
+
+// 删除服务账号，同时撤销它的全部令牌
+export function deleteServiceAccount(uuid: string) {
+  return axios.delete(`/api/service-accounts/${uuid}`)
+}
+
+// 获取服务账号令牌
+export function getServiceAccountTokens(uuid: string) {
+  return axios.get(`/api/service-accounts/${uuid}/tokens`)
+}
+
+// 创建服务账号令牌
+export function createServiceAccountToken(uuid: string, data: CreateTokenRequest) {
+  return axios.post(`/api/service-accounts/${uuid}/tokens`, data)
+}
+
+// 撤销服务账号令牌
+export function revokeServiceAccountToken(uuid: string, id: number) {
+  return axios.delete(`/api/service-accounts/${uuid}/tokens/${id}`)
+}
+
+// 获取房间 Webhook
+export function getWebhooks(uuid: string) {
+  return axios.get(`/api/rooms/${uuid}/webhooks`)
+}
+
+// 创建房间 Webhook，返回的签名密钥只显示一次
+export function createWebhook(uuid: string, data: CreateWebhookRequest) {
+  return axios.post(`/api/rooms/${uuid}/webhooks`, data)
+}
+
+// 修改房间 Webhook
+export function updateWebhook(uuid: string, id: number, data: UpdateWebhookRequest) {
+  return axios.put(`/api/rooms/${uuid}/webhooks/${id}`, data)
+}
+
+// 删除房间 Webhook
+export function deleteWebhook(uuid: string, id: number) {
+  return axios.delete(`/api/rooms/${uuid}/webhooks/${id}`)
+}
+
+// 获取 Webhook 投递记录
+export function getWebhookDeliveries(uuid: string, id: number, params?: { status?: string; before?: number; limit?: number }) {
+  return axios.get(`/api/rooms/${uuid}/webhooks/${id}/deliveries`, { params })
+}
+
+// 获取会议场次和参会记录
+export function getRoomSessions(uuid: string, params?: { before?: number; limit?: number }) {
+  return axios.get(`/api/rooms/${uuid}/sessions`, { params })
+}
+
+// 导出参会记录 CSV
+export function exportSessionAttendance(uuid: string, sessionId: number) {
+  return axios.get(`/api/rooms/${uuid}/sessions/${sessionId}/attendance.csv`, { responseType: 'blob' })
+}
+// 获取房间的服务端录制
+export function getRecordings(uuid: string, params?: { limit?: number }) {
+  return axios.get(`/api/rooms/${uuid}/recordings`, { params })
+}
+
+// 下载录制的单个文件
+export function downloadRecordingFile(uuid: string, recordingId: string, fileId: number) {
+  return axios.get(`/api/rooms/${uuid}/recordings/${recordingId}/files/${fileId}`, { responseType: 'blob' })
+}
+
+// 打包下载录制的全部文件
+export function downloadRecording(uuid: string, recordingId: string) {
+  return axios.get(`/api/rooms/${uuid}/recordings/${recordingId}/download`, { responseType: 'blob' })
+}
+
+// 删除录制（仅房主）
+export function deleteRecording(uuid: string, recordingId: string) {
+  return axios.delete(`/api/rooms/${uuid}/recordings/${recordingId}`)
+}
@@ -28,6 +28,20 @@ const enUS = {
         startMeeting: 'Start Your Meeting',
         loginToCreateOrJoin: 'Login to create or join a meeting',
         login: 'Login',
+        passwordLoginTab: 'Password',
+        emailLoginTab: 'Email Code',
+        username: 'Username',
+        usernameOrEmail: 'Username or email',
+        displayName: 'Display name (optional)',
+        email: 'Email',
+        emailOptional: 'Email (optional)',
+        emailCode: 'Verification code',
+        sendCode: 'Send code',
+        codeSent: 'Code sent, please check your email',
+        register: 'Register',
+        noAccount: 'No account? Register',
+        haveAccount: 'Already have an account? Login',
+        loginWithPassport: 'Login with {name}',
         logout: 'Logout',
         logoutConfirmTitle: 'Confirm Logout',
         logoutConfirmMessage: 'Are you sure you want to logout?',
@@ -48,6 +62,7 @@ const enUS = {
         createMeetingTab: 'Create Meeting',
         joinMeetingTab: 'Join Meeting',
         roomPassword: 'Room Password (Optional)',
+        inviteCode: 'Invite Code',
         roomPasswordPlaceholder: 'Set room password, leave empty for no password',
         joinPassword: 'Room Password (If Required)',
         joinPasswordPlaceholder: 'Enter room password',
@@ -83,9 +98,11 @@ const enUS = {
         meetingInProgress: 'Meeting in Progress',
         participants: 'participants',
         roomManagement: 'Room Management',
+        serverRecording: 'Recording',
+        startServerRecording: 'Start server recording',
+        stopServerRecording: 'Stop server recording',
         inviteToJoin: 'Invite you to join the room',
         orDirectLink: 'Or directly open the link to enter the room',
-        enterPassword: 'enter password',
         copy: 'Copy',
         roomInfoUpdated: 'Room information updated',
         cannotGetMicAudio: 'Cannot get microphone audio, will only record desktop audio',
@@ -103,6 +120,7 @@ const enUS = {
         enterMeetingId: 'Please enter meeting ID',
         enterMeetingName: 'Please enter meeting name',
         wrongPassword: 'Wrong room password',
+        loginFailed: 'Login failed',
         userBlacklisted: 'You have been blacklisted from this room',
         roomNotFound: 'Room does not exist',
         joinRoomFailed: 'Failed to join room',
@@ -216,7 +234,11 @@ const enUS = {
         viewDetails: 'View Details',
         roomDetails: 'Room Details',
         roomInfo: 'Room Information',
-        roomMembers: 'Room Members'
+        roomMembers: 'Room Members',
+        joinTime: 'Joined',
+        lastMessage: 'Last message',
+        sendQueue: 'Send queue',
+        detached: 'Reconnecting'
       }
     }
   },
@@ -254,6 +276,20 @@ const zhCN = {
         startMeeting: '开始您的会议',
         loginToCreateOrJoin: '登录后即可创建或加入会议',
         login: '登录',
+        passwordLoginTab: '账号密码',
+        emailLoginTab: '邮箱验证码',
+        username: '用户名',
+        usernameOrEmail: '用户名或邮箱',
+        displayName: '昵称（可选）',
+        email: '邮箱',
+        emailOptional: '邮箱（可选）',
+        emailCode: '验证码',
+        sendCode: '发送验证码',
+        codeSent: '验证码已发送，请查收邮件',
+        register: '注册',
+        noAccount: '没有账号？注册',
+        haveAccount: '已有账号？登录',
+        loginWithPassport: '使用 {name} 登录',
         logout: '退出',
         logoutConfirmTitle: '确认退出',
         logoutConfirmMessage: '您确定要退出登录吗？',
@@ -274,6 +310,7 @@ const zhCN = {
         createMeetingTab: '创建会议',
         joinMeetingTab: '加入会议',
         roomPassword: '房间密码 (可选)',
+        inviteCode: '邀请码',
         roomPasswordPlaceholder: '设置房间密码，留空则无密码',
         joinPassword: '房间密码 (如需要)',
         joinPasswordPlaceholder: '输入房间密码',
@@ -309,9 +346,11 @@ const zhCN = {
         meetingInProgress: '会议进行中',
         participants: '人参与',
         roomManagement: '房间管理',
+        serverRecording: '录制中',
+        startServerRecording: '开始服务端录制',
+        stopServerRecording: '停止服务端录制',
         inviteToJoin: '邀请你加入房间',
         orDirectLink: '也可直接打开链接',
-        enterPassword: '输入密码',
         copy: '复制',
         roomInfoUpdated: '房间信息已更新',
         cannotGetMicAudio: '无法获取麦克风音频，将只录制桌面音频',
@@ -329,6 +368,7 @@ const zhCN = {
         enterMeetingId: '请输入会议ID',
         enterMeetingName: '请输入会议名称',
         wrongPassword: '房间密码错误',
+        loginFailed: '登录失败',
         userBlacklisted: '您已被该房间拉黑',
         roomNotFound: '房间不存在',
         joinRoomFailed: '加入房间失败',
@@ -442,7 +482,11 @@ const zhCN = {
         viewDetails: '查看详情',
         roomDetails: '房间详情',
         roomInfo: '房间信息',
-        roomMembers: '房间成员'
+        roomMembers: '房间成员',
+        joinTime: '加入时间',
+        lastMessage: '最后消息',
+        sendQueue: '发送队列',
+        detached: '重连中'
       }
     }
   },
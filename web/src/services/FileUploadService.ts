@@ -0,0 +1,105 @@
+import { apiUrl } from '@/config'
+import type { SharedFile } from '@/types/webrtc'
+
+// 经服务端中转的文件按 tus 1.0.0 协议分片上传，中断后从服务端记录的偏移继续
+const TUS_VERSION = '1.0.0'
+const CHUNK_SIZE = 4 * 1024 * 1024 // 4MB chunks
+const MAX_RETRIES = 3
+const RETRY_DELAY = 1000
+
+function encodeMetadata(value: string): string {
+  let binary = ''
+  for (const byte of new TextEncoder().encode(value)) {
+    binary += String.fromCharCode(byte)
+  }
+  return btoa(binary)
+}
+
+async function errorMessage(response: Response): Promise<string> {
+  try {
+    const data = await response.json()
+    return data.message || response.statusText
+  } catch {
+    return response.statusText
+  }
+}
+
+// 查询服务端已经收到的字节数
+async function fetchOffset(url: string): Promise<number> {
+  const response = await fetch(url, {
+    method: 'HEAD',
+    credentials: 'include',
+    headers: { 'Tus-Resumable': TUS_VERSION }
+  })
+  if (!response.ok) {
+    throw new Error(`Failed to resume upload: ${response.status}`)
+  }
+  return Number(response.headers.get('Upload-Offset'))
+}
+
+export function roomFileUrl(roomId: string, fileId: string): string {
+  return `${apiUrl}/api/rooms/${roomId}/files/${fileId}`
+}
+
+/**
+ * Uploads a file to the room, the server announces it in the chat once completed
+ */
+export async function uploadRoomFile(
+  roomId: string,
+  file: File,
+  onProgress?: (uploaded: number) => void
+): Promise<SharedFile> {
+  const metadata = [`filename ${encodeMetadata(file.name)}`]
+  if (file.type) {
+    metadata.push(`filetype ${encodeMetadata(file.type)}`)
+  }
+  const created = await fetch(`${apiUrl}/api/rooms/${roomId}/files`, {
+    method: 'POST',
+    credentials: 'include',
+    headers: {
+      'Tus-Resumable': TUS_VERSION,
+      'Upload-Length': String(file.size),
+      'Upload-Metadata': metadata.join(',')
+    }
+  })
+  if (!created.ok) {
+    throw new Error(await errorMessage(created))
+  }
+  const { data } = await created.json()
+  const url = `${apiUrl}${created.headers.get('Location')}`
+
+  let offset = 0
+  let retries = 0
+  while (offset < file.size) {
+    try {
+      const response = await fetch(url, {
+        method: 'PATCH',
+        credentials: 'include',
+        headers: {
+          'Tus-Resumable': TUS_VERSION,
+          'Upload-Offset': String(offset),
+          'Content-Type': 'application/offset+octet-stream'
+        },
+        body: file.slice(offset, offset + CHUNK_SIZE)
+      })
+      // 4xx 除偏移冲突外不可重试，例如文件已过期或被删除
+      if (!response.ok && response.status !== 409 && response.status < 500) {
+        throw Object.assign(new Error(await errorMessage(response)), { fatal: true })
+      }
+      if (!response.ok) {
+        throw new Error(await errorMessage(response))
+      }
+      offset = Number(response.headers.get('Upload-Offset'))
+      retries = 0
+      onProgress?.(offset)
+    } catch (error: any) {
+      if (error.fatal || ++retries > MAX_RETRIES) {
+        throw error
+      }
+      await new Promise((resolve) => setTimeout(resolve, RETRY_DELAY * retries))
+      offset = await fetchOffset(url)
+    }
+  }
+
+  return { id: data.id, name: data.name, size: data.size, mimeType: data.mimeType, expiresAt: data.expiresAt }
+}
@@ -1,15 +1,22 @@
+import { generateSignature } from '@/api'
 import { iceServers } from '@/config'
 import {
   MessageType,
+  PROTOCOL_VERSION,
   WebRTCEventType,
   type ChatMessage,
   type FileTransfer,
   type MediaState,
   type Peer,
   type PeerConnection,
+  type RecordingState,
   type SignalMessage
 } from '@/types/webrtc'
 
+const SFU_PEER_ID = 'sfu'
+// 服务端录制以该 id 加入房间，不显示为参会者
+const RECORDER_PEER_ID = 'recorder'
+
 export class WebRTCService {
   private ws: WebSocket | null = null
   private readonly localStream: MediaStream
@@ -36,6 +43,11 @@ export class WebRTCService {
   private maxReconnectDelay: number = 30000 // Maximum delay of 30 seconds
   private reconnectTimeout: number | null = null
   private isManuallyDisconnected: boolean = false
+  // 会话恢复：断线后在 resumeTimeout 内重连不会触发离开和加入
+  private resumeToken: string | null = null
+  private resumeTimeout: number = 0
+  private disconnectedAt: number = 0
+  private resuming: boolean = false
 
   // Event callbacks
   public onParticipantJoined?: (peer: Peer) => void
@@ -48,6 +60,16 @@ export class WebRTCService {
   public onConnectionStateChanged?: (
     state: 'connecting' | 'connected' | 'disconnected' | 'reconnecting'
   ) => void
+  // 等候室：自己等待准入，或作为主持人收到准入请求
+  public onLobbyWait?: () => void
+  public onLobbyRequest?: (peer: Peer) => void
+  public onLobbyResolved?: (clientId: string, admitted: boolean) => void
+  // 主持人控制：本地媒体被关闭、举手状态变化
+  public onModerated?: (mediaState: MediaState) => void
+  public onHandRaised?: (peerId: string, raised: boolean) => void
+  public onHandsLowered?: () => void
+  public onRoleChanged?: (peerId: string, role: number, capabilities: string[]) => void
+  public onRecordingStateChanged?: (state: RecordingState) => void
 
   private fileTransfers: Map<string, FileTransfer> = new Map()
   private readonly CHUNK_SIZE = 16384 // 16KB chunks
@@ -63,15 +85,34 @@ export class WebRTCService {
     this.isManuallyDisconnected = false
     this.onConnectionStateChanged?.('connecting')
 
+    // 加入令牌有效期很短，重连前重新获取
+    if (this.signedData.expiresAt && this.signedData.expiresAt <= Date.now()) {
+      try {
+        const res = await generateSignature({ roomId: this.signedData.roomId })
+        this.signedData = { ...this.signedData, ...res.data }
+      } catch (error) {
+        console.error('Failed to refresh signature:', error)
+      }
+    }
+
     return new Promise((resolve, reject) => {
-      const query = new URLSearchParams(this.signedData)
+      // 加入令牌包含了全部身份信息
+      const query = new URLSearchParams({ token: this.signedData.token })
+      this.resuming = this.canResume()
+      if (this.resuming) {
+        query.set('resume', this.resumeToken!)
+      }
       this.ws = new WebSocket(`${wsUrl}?${query.toString()}`)
 
       this.ws.onopen = () => {
         console.log('WebSocket connected')
         this.reconnectAttempts = 0
         this.onConnectionStateChanged?.('connected')
-        this.sendMessage({ type: MessageType.AllClients })
+        this.sendMessage({ type: MessageType.Hello, data: { version: PROTOCOL_VERSION } })
+        // 恢复会话时等待 session 消息，确认恢复失败后再重新建立连接
+        if (!this.resuming) {
+          this.enterRoom()
+        }
         // Start sending PING messages periodically
         this.startPing()
         resolve()
@@ -101,6 +142,9 @@ export class WebRTCService {
       this.ws.onclose = (event) => {
         console.log('WebSocket disconnected', event)
         this.stopPing()
+        if (!this.disconnectedAt) {
+          this.disconnectedAt = Date.now()
+        }
 
         // 如果不是手动断开连接，则尝试重连
         if (!this.isManuallyDisconnected) {
@@ -120,7 +164,20 @@ export class WebRTCService {
       case MessageType.Join:
         if (from?.id !== this.clientId) {
           console.log('Peer joined:', from?.id)
-          await this.handlePeerJoined(from!)
+          if (this.isSFU()) {
+            // SFU 模式下媒体由服务端转发，无需与其他成员直连
+            if (from!.id === RECORDER_PEER_ID) {
+              break
+            }
+            this.onParticipantJoined?.({
+              id: from!.id,
+              name: from!.name,
+              avatar: from!.avatar,
+              mediaState: { video: false, audio: false, screen: false, desktopAudio: false }
+            })
+          } else {
+            await this.handlePeerJoined(from!)
+          }
         }
         break
 
@@ -129,13 +186,136 @@ export class WebRTCService {
         this.handlePeerLeft(from!)
         break
 
+      case MessageType.Mute:
+        if (this.mediaState.audio) {
+          await this.toggleAudio()
+        }
+        this.onModerated?.({ ...this.mediaState })
+        break
+
+      case MessageType.StopVideo:
+        if (this.mediaState.video && !this.mediaState.screen) {
+          await this.stopCamera()
+        }
+        this.onModerated?.({ ...this.mediaState })
+        break
+
+      case MessageType.StopScreen:
+        if (this.mediaState.screen) {
+          await this.stopScreenShare()
+        }
+        this.onModerated?.({ ...this.mediaState })
+        break
+
+      case MessageType.RaiseHand:
+        this.onHandRaised?.(from!.id, data.raised)
+        break
+
+      case MessageType.LowerHands:
+        this.onHandsLowered?.()
+        break
+
+      case MessageType.RoleChanged:
+        if (data.clientId === this.clientId) {
+          this.signedData.role = data.role
+          await this.applyCapabilities(data.capabilities || [])
+        }
+        this.onRoleChanged?.(data.clientId, data.role, data.capabilities || [])
+        break
+
+      case MessageType.RecordingState:
+        this.onRecordingStateChanged?.(data)
+        break
+
+      case MessageType.ServerRestarting:
+        // 服务端即将关闭，按提示的时间主动断开，由重连逻辑连接到其他节点
+        console.log(`Server restarting, reconnecting in ${data.reconnectAfter}ms`)
+        this.reconnectAttempts = 0
+        window.setTimeout(() => this.ws?.close(), data.reconnectAfter || 0)
+        break
+
+      case MessageType.Session:
+        this.resumeToken = data.resumeToken
+        this.resumeTimeout = data.resumeTimeout || 0
+        this.disconnectedAt = 0
+        if (this.resuming && !data.resumed) {
+          // 会话已过期，服务端按新成员处理
+          this.cleanupPeersOnly()
+          this.enterRoom()
+        }
+        this.resuming = false
+        break
+
+      case MessageType.EndMeeting:
+        this.disconnect()
+        window.location.href = '/'
+        break
+
       case MessageType.Kick:
         window.location.href = '/'
         break
 
+      case MessageType.Chat:
+        this.onChatMessage?.({
+          id: data.id,
+          senderId: from!.id,
+          senderName: from!.name,
+          content: data.content,
+          timestamp: data.timestamp,
+          type: data.file ? 'file' : 'text',
+          read: from!.id === this.clientId,
+          // 服务端中转的文件上传完成后随聊天消息下发
+          ...(data.file && {
+            fileId: data.file.id,
+            fileName: data.file.name,
+            fileSize: data.file.size,
+            fileType: data.file.mimeType
+          })
+        })
+        break
+
+      case MessageType.Welcome:
+        console.log('Signaling protocol version:', data.version)
+        break
+
+      case MessageType.Error:
+        console.warn(`Signaling error for ${data.type || 'message'}: [${data.code}] ${data.message}`)
+        break
+
+      case MessageType.LobbyWait:
+        // 准入前发出的消息会被拒绝，准入后重新建立连接
+        this.resuming = false
+        this.closePeer(SFU_PEER_ID)
+        this.onLobbyWait?.()
+        break
+
+      case MessageType.LobbyRequest:
+        this.onLobbyRequest?.({
+          id: from!.id,
+          name: from!.name,
+          avatar: from!.avatar,
+          mediaState: { video: false, audio: false, screen: false, desktopAudio: false }
+        })
+        break
+
+      case MessageType.LobbyCancel:
+        this.onLobbyResolved?.(from!.id, false)
+        break
+
+      case MessageType.LobbyDecision:
+        this.onLobbyResolved?.(data.clientId, data.admitted)
+        if (data.clientId === this.clientId) {
+          if (data.admitted) {
+            this.enterRoom()
+          } else {
+            this.disconnect()
+          }
+        }
+        break
+
       case MessageType.AllClients:
         for (const client of data) {
-          if (client.id !== this.clientId) {
+          if (client.id !== this.clientId && client.id !== RECORDER_PEER_ID) {
             this.onParticipantJoined?.({
               id: client.id,
               name: client.name,
@@ -169,6 +349,90 @@ export class WebRTCService {
     }
   }
 
+  private enterRoom(): void {
+    this.sendMessage({ type: MessageType.AllClients })
+    if (this.isSFU()) {
+      this.connectSFU()
+    }
+  }
+
+  private closePeer(peerId: string): void {
+    const peer = this.peers.get(peerId)
+    if (peer) {
+      peer.connection.close()
+      this.peers.delete(peerId)
+    }
+  }
+
+  // 角色变更后停止不再允许发布的媒体
+  private async applyCapabilities(capabilities: string[]): Promise<void> {
+    if (!capabilities.includes('screen-share') && this.mediaState.screen) {
+      await this.stopScreenShare()
+    }
+    if (!capabilities.includes('publish')) {
+      if (this.mediaState.video && !this.mediaState.screen) {
+        await this.stopCamera()
+      }
+      if (this.mediaState.audio) {
+        await this.toggleAudio()
+      }
+    }
+    this.onModerated?.({ ...this.mediaState })
+  }
+
+  // 主持人控制其他成员的媒体
+  moderate(type: MessageType.Mute | MessageType.StopVideo | MessageType.StopScreen, peerId: string): void {
+    this.sendMessage({ type, to: { id: peerId } })
+  }
+
+  raiseHand(raised: boolean): void {
+    this.sendMessage({ type: MessageType.RaiseHand, data: { raised } })
+  }
+
+  lowerHands(): void {
+    this.sendMessage({ type: MessageType.LowerHands })
+  }
+
+  endMeeting(): void {
+    this.sendMessage({ type: MessageType.EndMeeting })
+  }
+
+  // 主持人开始或停止服务端录制
+  startRecording(): void {
+    this.sendMessage({ type: MessageType.RecordingStart })
+  }
+
+  stopRecording(): void {
+    this.sendMessage({ type: MessageType.RecordingStop })
+  }
+
+  // 主持人准入或拒绝等候室中的成员
+  admit(clientId: string, admitted: boolean): void {
+    this.sendMessage({ type: MessageType.LobbyAdmit, data: { clientId, admitted } })
+  }
+
+  private isSFU(): boolean {
+    return this.signedData?.roomMode === 'sfu'
+  }
+
+  private async connectSFU(): Promise<void> {
+    if (this.peers.has(SFU_PEER_ID)) {
+      return
+    }
+    const peerConnection = await this.createPeerConnection(SFU_PEER_ID)
+    const offer = await peerConnection.connection.createOffer()
+    await peerConnection.connection.setLocalDescription(offer)
+
+    this.sendMessage({
+      type: MessageType.WebRTCEvent,
+      to: { id: SFU_PEER_ID },
+      data: {
+        type: WebRTCEventType.Offer,
+        data: offer
+      }
+    })
+  }
+
   private async handlePeerJoined(peer: Peer): Promise<void> {
     if (this.peers.has(peer.id)) {
       return
@@ -193,12 +457,15 @@ export class WebRTCService {
       })
     }
 
-    this.onParticipantJoined?.({
-      id: peer.id,
-      name: peer.name,
-      avatar: peer.avatar,
-      mediaState: { video: false, audio: false, screen: false, desktopAudio: false }
-    })
+    // 录制端只接收媒体，不显示为参会者
+    if (peer.id !== RECORDER_PEER_ID) {
+      this.onParticipantJoined?.({
+        id: peer.id,
+        name: peer.name,
+        avatar: peer.avatar,
+        mediaState: { video: false, audio: false, screen: false, desktopAudio: false }
+      })
+    }
     console.log('Peer joined:', peer.id, this.mediaState)
     this.broadcastMediaState()
   }
@@ -210,6 +477,8 @@ export class WebRTCService {
       pc.dataChannel?.close()
       this.onParticipantLeft?.(peer.id)
       this.peers.delete(peer.id)
+    } else if (this.isSFU()) {
+      this.onParticipantLeft?.(peer.id)
     }
   }
 
@@ -367,7 +636,8 @@ export class WebRTCService {
         return
       }
       console.log('Received remote stream from:', peerId, remoteStream)
-      this.onRemoteStream?.(peerId, remoteStream)
+      // SFU 转发的流以发布者的客户端 id 作为 stream id
+      this.onRemoteStream?.(peerId === SFU_PEER_ID ? remoteStream.id : peerId, remoteStream)
 
       const peer = this.peers.get(peerId)
       if (peer) {
@@ -955,14 +1225,17 @@ export class WebRTCService {
 
   sendChatMessage(name: string, content: string): void {
     const message = {
-      type: 'chat',
       id: Date.now().toString(),
       senderName: name,
       content,
       timestamp: Date.now()
     }
 
-    this.broadcastToDataChannels(message)
+    // 通过信令服务器发送，服务端会保存聊天记录
+    this.sendMessage({
+      type: MessageType.Chat,
+      data: { id: message.id, content: message.content, timestamp: message.timestamp }
+    })
 
     // Add to own chat
     this.onChatMessage?.({
@@ -1290,8 +1563,10 @@ export class WebRTCService {
       return
     }
 
-    // 清理当前连接
-    this.cleanupPeersOnly()
+    // 会话仍可恢复时保留现有连接，否则清理
+    if (!this.canResume()) {
+      this.cleanupPeersOnly()
+    }
 
     // 增加重连尝试次数
     this.reconnectAttempts++
@@ -1311,6 +1586,10 @@ export class WebRTCService {
     }, delay)
   }
 
+  private canResume(): boolean {
+    return this.resumeToken !== null && Date.now() - this.disconnectedAt < this.resumeTimeout
+  }
+
   private cleanupPeersOnly(): void {
     // 只清理peer连接，保留本地流
     this.peers.forEach((peer) => {
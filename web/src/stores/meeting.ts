@@ -1,9 +1,17 @@
 import { WebRTCService } from '@/services/WebRTCService'
-import type { ChatMessage, FileTransfer, MediaState, Peer } from '@/types/webrtc'
+import { uploadRoomFile } from '@/services/FileUploadService'
+import {
+    MessageType,
+    type ChatMessage,
+    type FileTransfer,
+    type MediaState,
+    type Peer,
+    type RecordingState
+} from '@/types/webrtc'
 import { defineStore } from 'pinia'
 import { computed, ref } from 'vue'
 import { useUserStore } from './user'
-import { Role } from '@/types/room'
+import { isModerator } from '@/types/room'
 
 export const useMeetingStore = defineStore('meeting', () => {
     // State
@@ -18,8 +26,11 @@ export const useMeetingStore = defineStore('meeting', () => {
     const currentUser = ref<Peer | null>(null)
     const roomId = ref('')
     const roomName = ref('')
-    const roomPassword = ref('')
+    const inviteCode = ref('')
     const clientId = ref('')
+    const waitingInLobby = ref(false)
+    const lobbyRequests = ref<Map<string, Peer>>(new Map())
+    const raisedHands = ref<Set<string>>(new Set())
 
     // Additional state for HomeView.vue.bak compatibility
     const inMeeting = ref(false)
@@ -29,6 +40,8 @@ export const useMeetingStore = defineStore('meeting', () => {
     const localMediaState = ref({ microphone: true, camera: true, screenSharing: false })
     const participantCount = ref(0)
     const isRecording = ref(false)
+    // 服务端录制状态，所有参会者可见
+    const serverRecording = ref<RecordingState>({ active: false })
     const unreadMessages = ref(0)
     const showChatPanel = ref(false)
 
@@ -46,10 +59,10 @@ export const useMeetingStore = defineStore('meeting', () => {
         isJoining.value = true
         roomId.value = signedData.roomId
         roomName.value = signedData.roomName
-        roomPassword.value = signedData.roomPassword || ''
+        inviteCode.value = signedData.inviteCode || ''
         clientId.value = signedData.userId
-        // 设置是否为房间管理员 (role: 1 = master, 2 = user)
-        isHost.value = signedData.role === Role.Master
+        // 设置是否为房间管理员，房主和联席主持人都可以管理成员
+        isHost.value = isModerator(signedData.role)
 
         try {
             // Create WebRTC service
@@ -94,18 +107,72 @@ export const useMeetingStore = defineStore('meeting', () => {
             remoteStreams.value.delete(participantId)
         }
 
+        webrtcService.value.onLobbyWait = () => {
+            waitingInLobby.value = true
+        }
+
+        webrtcService.value.onLobbyRequest = (peer: Peer) => {
+            lobbyRequests.value.set(peer.id, peer)
+        }
+
+        webrtcService.value.onLobbyResolved = (id: string) => {
+            lobbyRequests.value.delete(id)
+            if (id === clientId.value) {
+                waitingInLobby.value = false
+            }
+        }
+
+        webrtcService.value.onModerated = (mediaState: MediaState) => {
+            if (currentUser.value) {
+                currentUser.value.mediaState = mediaState
+            }
+            localStream.value = webrtcService.value?.getLocalStream() ?? null
+        }
+
+        webrtcService.value.onHandRaised = (id: string, raised: boolean) => {
+            if (raised) {
+                raisedHands.value.add(id)
+            } else {
+                raisedHands.value.delete(id)
+            }
+        }
+
+        webrtcService.value.onHandsLowered = () => {
+            raisedHands.value.clear()
+        }
+
+        webrtcService.value.onRoleChanged = (id: string, role: number) => {
+            if (id === clientId.value) {
+                isHost.value = isModerator(role)
+            }
+        }
+
+        webrtcService.value.onRecordingStateChanged = (state: RecordingState) => {
+            serverRecording.value = state
+        }
+
         webrtcService.value.onRemoteStream = (participantId: string, stream: MediaStream) => {
             remoteStreams.value.set(participantId, stream)
         }
 
         webrtcService.value.onChatMessage = (message: ChatMessage) => {
+            // 重连后服务端会回放聊天记录，忽略已收到的消息
+            if (chatMessages.value.some((m) => m.id === message.id && m.senderId === message.senderId)) {
+                return
+            }
             // 如果消息不是来自当前用户，标记为未读
             if (message.senderId !== clientId.value) {
                 message.read = false
             } else {
                 message.read = true
             }
-            chatMessages.value.push(message)
+            // 回放的历史消息可能晚于新消息到达，按时间插入
+            const index = chatMessages.value.findIndex((m) => m.timestamp > message.timestamp)
+            if (index === -1) {
+                chatMessages.value.push(message)
+            } else {
+                chatMessages.value.splice(index, 0, message)
+            }
         }
 
         webrtcService.value.onFileReceived = (file: File) => {
@@ -174,6 +241,48 @@ export const useMeetingStore = defineStore('meeting', () => {
         }
     }
 
+    function admitParticipant(id: string, admitted: boolean) {
+        webrtcService.value?.admit(id, admitted)
+    }
+
+    function raiseHand(raised: boolean) {
+        if (raised) {
+            raisedHands.value.add(clientId.value)
+        } else {
+            raisedHands.value.delete(clientId.value)
+        }
+        webrtcService.value?.raiseHand(raised)
+    }
+
+    function lowerAllHands() {
+        raisedHands.value.clear()
+        webrtcService.value?.lowerHands()
+    }
+
+    function muteParticipant(id: string) {
+        webrtcService.value?.moderate(MessageType.Mute, id)
+    }
+
+    function stopParticipantVideo(id: string) {
+        webrtcService.value?.moderate(MessageType.StopVideo, id)
+    }
+
+    function stopParticipantScreen(id: string) {
+        webrtcService.value?.moderate(MessageType.StopScreen, id)
+    }
+
+    function endMeetingForAll() {
+        webrtcService.value?.endMeeting()
+    }
+
+    function toggleServerRecording() {
+        if (serverRecording.value.active) {
+            webrtcService.value?.stopRecording()
+        } else {
+            webrtcService.value?.startRecording()
+        }
+    }
+
     async function startCamera(videoDeviceId?: string) {
         if (!webrtcService.value) return
 
@@ -383,9 +492,48 @@ export const useMeetingStore = defineStore('meeting', () => {
         webrtcService.value.sendChatMessage(currentUser.value?.name || '', content)
     }
 
+    // 经服务端中转上传，完成后服务端发送带文件的聊天消息，接收方离线或无法直连时也能下载
+    async function uploadFile(file: File) {
+        const transfer: FileTransfer = {
+            id: `upload-${Date.now()}`,
+            name: file.name,
+            size: file.size,
+            type: file.type,
+            progress: 0,
+            status: 'transferring',
+            chunks: [],
+            totalChunks: 0
+        }
+        fileTransfers.value.push(transfer)
+        const update = (changes: Partial<FileTransfer>) => {
+            const index = fileTransfers.value.findIndex((t) => t.id === transfer.id)
+            if (index >= 0) {
+                fileTransfers.value[index] = { ...fileTransfers.value[index], ...changes }
+            }
+        }
+
+        try {
+            await uploadRoomFile(roomId.value, file, (uploaded) => {
+                update({ progress: file.size ? (uploaded / file.size) * 100 : 100 })
+            })
+            update({ progress: 100, status: 'completed' })
+        } catch (error) {
+            update({ status: 'failed' })
+            throw error
+        }
+    }
+
     async function sendFile(file: File) {
         if (!webrtcService.value) return
 
+        // 优先经服务端中转，超出大小限制或上传失败时退回点对点发送
+        try {
+            await uploadFile(file)
+            return
+        } catch (error) {
+            console.warn('Failed to upload file, sending it to peers directly:', error)
+        }
+
         try {
             // 添加文件消息到发送方的聊天记录
             const fileMessage: ChatMessage = {
@@ -498,8 +646,11 @@ export const useMeetingStore = defineStore('meeting', () => {
         webrtcService.value = null
         roomId.value = ''
         roomName.value = ''
-        roomPassword.value = ''
+        inviteCode.value = ''
         clientId.value = ''
+        waitingInLobby.value = false
+        lobbyRequests.value.clear()
+        raisedHands.value.clear()
 
         // 重置额外状态
         inMeeting.value = false
@@ -509,6 +660,7 @@ export const useMeetingStore = defineStore('meeting', () => {
         localMediaState.value = { microphone: true, camera: true, screenSharing: false }
         participantCount.value = 0
         isRecording.value = false
+        serverRecording.value = { active: false }
         unreadMessages.value = 0
         showChatPanel.value = false
     }
@@ -525,8 +677,11 @@ export const useMeetingStore = defineStore('meeting', () => {
         currentUser,
         roomId,
         roomName,
-        roomPassword,
+        inviteCode,
         clientId,
+        waitingInLobby,
+        lobbyRequests,
+        raisedHands,
         webrtcService, // 导出webrtcService
 
         // Additional state
@@ -537,6 +692,7 @@ export const useMeetingStore = defineStore('meeting', () => {
         localMediaState,
         participantCount,
         isRecording,
+        serverRecording,
         unreadMessages,
         showChatPanel,
 
@@ -547,6 +703,14 @@ export const useMeetingStore = defineStore('meeting', () => {
 
         // Actions
         joinMeeting,
+        admitParticipant,
+        raiseHand,
+        lowerAllHands,
+        muteParticipant,
+        stopParticipantVideo,
+        stopParticipantScreen,
+        endMeetingForAll,
+        toggleServerRecording,
         startCamera,
         stopCamera,
         startScreenShare,
@@ -1,3 +1,5 @@
+import type { MemberRole } from './room'
+
 export interface RoomInfo {
   id: string
   name: string
@@ -11,5 +13,24 @@ export interface RoomInfo {
 export interface ClientInfo {
   id: string
   name: string
-  role: string
+  avatar: string
+  role: number
+  roleName: MemberRole
+  node?: string
+  joinTime: string
+  lastMessageTime: string
+  // 待发送消息数与发送缓冲区容量
+  sendQueue: number
+  sendQueueCap: number
+  detached: boolean
+}
+
+export type RoomEventType = 'room-started' | 'room-closed' | 'client-joined' | 'client-left'
+
+export interface RoomEvent {
+  type: RoomEventType
+  roomId: string
+  time: string
+  room?: RoomInfo
+  client?: ClientInfo
 }
@@ -12,6 +12,8 @@ export interface CreateRoomRequest {
 
 export interface JoinRoomRequest {
     password?: string
+    // 邀请码，可以代替密码加入房间
+    code?: string
 }
 
 export interface UpdateRoomRequest {
@@ -19,14 +21,148 @@ export interface UpdateRoomRequest {
     password?: string
 }
 
+// 角色为位图，与服务端 entity.Role 一致
 export enum Role {
     Master = 1,
     Member = 2,
+    CoHost = 4,
+    Presenter = 8,
+    Viewer = 16,
+    Guest = 32,
+}
+
+export type MemberRole = 'host' | 'co-host' | 'presenter' | 'attendee' | 'viewer' | 'guest'
+
+export const ROLE_LABELS: Record<MemberRole, string> = {
+    host: '管理员',
+    'co-host': '联席主持人',
+    presenter: '演讲者',
+    attendee: '成员',
+    viewer: '仅观看',
+    guest: '访客',
+}
+
+export function isModerator(role: Role): boolean {
+    return (role & (Role.Master | Role.CoHost)) !== 0
 }
 
 export interface RoomMemberInfo {
     userId: number
     userName: string
-    role: Role
+    role: MemberRole
     blocked: boolean
-}
\ No newline at end of file
+}
+export interface CreateInviteRequest {
+    role?: MemberRole
+    // 0 表示不限次数
+    maxUses?: number
+    expiresAt?: string
+}
+
+export interface InviteInfo {
+    code: string
+    link: string
+    role: MemberRole
+    maxUses: number
+    uses: number
+    expiresAt?: string
+    revokedAt?: string
+    usable: boolean
+    createdBy: string
+    createdAt: string
+}
+
+export type WebhookEvent =
+    | 'room.started'
+    | 'room.ended'
+    | 'participant.joined'
+    | 'participant.left'
+    | 'participant.kicked'
+    | 'participant.blocked'
+    | 'chat.message'
+
+// 房间 Webhook，secret 只在创建或重置时返回
+export interface WebhookInfo {
+    id: number
+    url: string
+    // 为空时订阅全部事件
+    events: WebhookEvent[]
+    active: boolean
+    createdAt: string
+    updatedAt: string
+    secret?: string
+}
+
+export interface CreateWebhookRequest {
+    url: string
+    events?: WebhookEvent[]
+    active?: boolean
+}
+
+export interface UpdateWebhookRequest {
+    url?: string
+    events?: WebhookEvent[]
+    active?: boolean
+    rotateSecret?: boolean
+}
+
+export interface WebhookDelivery {
+    id: number
+    eventId: string
+    event: WebhookEvent
+    payload: string
+    status: 'pending' | 'succeeded' | 'failed'
+    attempts: number
+    nextAttemptAt?: string
+    responseStatus: number
+    error: string
+    deliveredAt?: string
+    createdAt: string
+    updatedAt: string
+}
+
+// 参会记录，duration 为在会议中的总秒数
+export interface AttendanceInfo {
+    userId: string
+    name: string
+    joinedAt: string
+    leftAt?: string
+    duration: number
+    reconnects: number
+    online: boolean
+}
+
+// 会议场次，进行中的会议没有 endedAt
+export interface SessionInfo {
+    id: number
+    startedAt: string
+    endedAt?: string
+    duration: number
+    maxOnline: number
+    participants: number
+    attendances: AttendanceInfo[]
+}
+
+// 服务端录制中一个成员的一条音频或视频轨道
+export interface RecordingFile {
+    id: number
+    participantId: string
+    participantName: string
+    kind: 'audio' | 'video'
+    codec: string
+    name: string
+    size: number
+    startedAt: string
+    endedAt?: string
+}
+
+// 服务端录制，status 为 recording、completed 或 failed
+export interface RecordingInfo {
+    id: string
+    status: 'recording' | 'completed' | 'failed'
+    startedBy: string
+    startedAt: string
+    stoppedAt?: string
+    size: number
+    files: RecordingFile[]
+}
@@ -1,5 +1,51 @@
 export interface User {
   uuid: string
+  // 本地账号的登录名
+  username?: string
   name: string
+  email?: string
+  // 邮箱通过验证码确认后才能用于登录
+  email_verified?: boolean
   avatar: string
+  // 服务账号
+  bot?: boolean
+  // 管理员可以查看系统监控
+  admin?: boolean
+}
+
+// 服务端启用的登录方式
+export interface AuthMethods {
+  passport: boolean
+  // 第三方登录服务，通过 /login?provider=id 登录
+  providers: { id: string; name: string }[]
+  password: boolean
+  email: boolean
+  registration: boolean
+}
+
+// API 令牌，token 只在创建时返回
+export interface ApiToken {
+  id: number
+  name: string
+  prefix: string
+  scopes: string[]
+  expiresAt?: string
+  lastUsedAt?: string
+  revokedAt?: string
+  active: boolean
+  createdAt: string
+  token?: string
+}
+
+export interface CreateTokenRequest {
+  name: string
+  scopes: string[]
+  expiresAt?: string
+}
+
+// 当前用户创建的服务账号
+export interface ServiceAccount {
+  uuid: string
+  name: string
+  createdAt: string
 }
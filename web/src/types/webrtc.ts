@@ -4,16 +4,47 @@ export enum MessageType {
   Join = 'join',
   Leave = 'leave',
   AllClients = 'all-clients',
+  Chat = 'chat',
   WebRTCEvent = 'webrtc-event',
-  Kick = 'kick'
+  Kick = 'kick',
+  Hello = 'hello',
+  Welcome = 'welcome',
+  Error = 'error',
+  LobbyWait = 'lobby-wait',
+  LobbyRequest = 'lobby-request',
+  LobbyCancel = 'lobby-cancel',
+  LobbyAdmit = 'lobby-admit',
+  LobbyDecision = 'lobby-decision',
+  Mute = 'mute',
+  StopVideo = 'stop-video',
+  StopScreen = 'stop-screen',
+  RaiseHand = 'raise-hand',
+  LowerHands = 'lower-hands',
+  EndMeeting = 'end-meeting',
+  RoleChanged = 'role-changed',
+  RecordingStart = 'recording-start',
+  RecordingStop = 'recording-stop',
+  RecordingState = 'recording-state',
+  ServerRestarting = 'server-restarting',
+  Session = 'session'
 }
 
+// 信令协议版本，见 server/docs/signaling-protocol.md
+export const PROTOCOL_VERSION = 2
+
 export enum WebRTCEventType {
   Offer = 'offer',
   Answer = 'answer',
   IceCandidate = 'ice-candidate'
 }
 
+// 服务端录制状态，见 recording-state 消息
+export interface RecordingState {
+  active: boolean
+  recordingId?: string
+  startedAt?: string
+}
+
 export interface SignalMessage {
   type: MessageType
   from?: Peer
@@ -43,6 +74,17 @@ export interface ChatMessage {
   fileUrl?: string
   fileName?: string
   fileSize?: number
+  // 经服务端中转的文件 id，通过文件接口下载
+  fileId?: string
+}
+
+// 经服务端中转、在聊天中分享的文件
+export interface SharedFile {
+  id: string
+  name: string
+  size: number
+  mimeType: string
+  expiresAt: string
 }
 
 export interface FileTransfer {